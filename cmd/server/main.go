@@ -6,6 +6,7 @@ import (
 	"fastgin/internal/middleware"
 	"fastgin/internal/repository"
 	"fastgin/internal/router"
+	"fastgin/internal/service"
 	"log"
 	"net/http"
 	"os"
@@ -21,6 +22,9 @@ import (
 // @description FastGin 服务API文档
 // @host localhost:8080
 // @BasePath /api
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 func main() {
 	// 初始化配置
 	if err := config.Init(); err != nil {
@@ -30,7 +34,25 @@ func main() {
 	// 初始化日志
 	middleware.InitLogger()
 
-	// 启动配置热重载
+	// 加载 JWT 密钥
+	if err := middleware.InitJWTKeys(config.GlobalConfig.JWT); err != nil {
+		middleware.Logger.Fatal("JWT密钥初始化失败", zap.Error(err))
+	}
+
+	// 设置密码哈希算法
+	service.InitPasswordHasher(config.GlobalConfig.Password)
+
+	// 设置邮件发送器
+	service.InitMailer(config.GlobalConfig.Mail)
+
+	// 启动配置热重载，新增或轮换的 JWT 密钥、密码哈希参数、邮件配置即时生效
+	config.OnConfigChange(func(conf config.Config) {
+		if err := middleware.InitJWTKeys(conf.JWT); err != nil {
+			middleware.Logger.Error("JWT密钥重载失败", zap.Error(err))
+		}
+		service.InitPasswordHasher(conf.Password)
+		service.InitMailer(conf.Mail)
+	})
 	config.WatchConfig()
 
 	// 初始化数据库连接
@@ -45,6 +67,14 @@ func main() {
 	// 初始化 路由
 	r := router.InitRouter(db, conf)
 
+	// 后台发送发件箱中的邮件
+	outboxCtx, stopOutbox := context.WithCancel(context.Background())
+	outboxDone := make(chan struct{})
+	go func() {
+		defer close(outboxDone)
+		service.RunMailOutbox(outboxCtx)
+	}()
+
 	// 创建 HTTP 服务器
 	srv := &http.Server{
 		Addr:    port,
@@ -73,6 +103,16 @@ func main() {
 		middleware.Logger.Fatal("服务器强制关闭", zap.Error(err))
 	}
 
+	// 停止发件任务，未发送的邮件下次启动后继续发送
+	stopOutbox()
+	<-outboxDone
+
+	// 停止权限策略同步
+	middleware.ClosePolicyWatcher()
+
+	// 写入尚未保存的鉴权审计记录
+	middleware.CloseDecisionAudit()
+
 	// 等待数据库连接关闭
 	sqlDB, err := db.DB()
 	if err != nil {
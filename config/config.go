@@ -2,6 +2,9 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -12,6 +15,128 @@ type Config struct {
 	Database DatabaseConfig
 	JWT      JWTConfig
 	Log      LogConfig
+	OAuth    OAuthConfig
+	Login    LoginConfig
+	Password PasswordConfig
+	Captcha  CaptchaConfig
+	Register RegisterConfig
+	Mail     MailConfig
+	Casbin   CasbinConfig
+}
+
+// CasbinConfig 权限模型和默认策略配置
+type CasbinConfig struct {
+	Model         string // 模型文件，默认为 config/rbac_model.conf
+	DefaultPolicy string // 默认策略文件，casbin_rule 中没有任何 p 策略时导入，默认为 config/rbac_policy.csv
+	Watcher       CasbinWatcherConfig
+	Audit         CasbinAuditConfig
+}
+
+// CasbinAuditConfig 鉴权决策审计，按比例抽样写入 authz_decisions 表，用于排查权限问题
+type CasbinAuditConfig struct {
+	Enabled   bool     // 是否记录鉴权决策，启用后鉴权时同时记录命中的策略
+	AllowRate float64  // 允许的请求的抽样比例（0-1），默认为 0，不记录
+	DenyRate  *float64 // 拒绝的请求的抽样比例（0-1），未配置时为 1，全部记录；0 表示不记录
+	Retention int      // 审计记录保留时长（秒），默认为 604800（7 天）
+}
+
+// CasbinWatcherConfig 多实例部署时同步策略变更，时间单位均为秒
+type CasbinWatcherConfig struct {
+	Driver       string // db（默认，轮询 casbin_change 表，不依赖其他组件）, pubsub（使用通过 RegisterPubSub 注册的发布订阅）, none（单实例）
+	PollInterval int    // db 轮询间隔，默认为 2
+	Retention    int    // db 变更记录保留时长，默认为 600，节点停止轮询超过该时长后全量重新加载
+	PubSub       string // pubsub 使用的实现名称
+	Channel      string // pubsub 频道，默认为 fastgin:casbin
+}
+
+// RegisterConfig 自助注册和找回密码配置，时间单位均为秒
+type RegisterConfig struct {
+	Enabled      bool   // 是否开放 /api/register 自助注册
+	DefaultRole  string // 注册用户的角色，默认为 user
+	VerifyURL    string // 邮件中的邮箱验证链接，令牌追加在 token 参数中，默认为 http://localhost:8080/api/register/verify
+	ResetURL     string // 邮件中的重置密码页面地址，令牌追加在 token 参数中，默认为 http://localhost:8080/reset-password
+	VerifyExpire int    // 邮箱验证链接有效期，默认为 86400
+	ResetExpire  int    // 重置密码链接有效期，默认为 1800
+}
+
+// MailConfig 邮件发送配置，邮件先写入发件箱，由后台任务发送并在失败时重试
+type MailConfig struct {
+	Driver       string // log（默认，只写日志）, file（写入 Dir 目录下的 .eml 文件）, smtp
+	From         string // 发件人地址
+	Dir          string // file 驱动的输出目录，默认为 mail
+	Host         string // SMTP 服务器地址
+	Port         int    // SMTP 端口，465 使用 TLS 直连，其他端口在服务器支持时使用 STARTTLS
+	Username     string
+	Password     string
+	MaxAttempts  int // 发送失败的最大尝试次数，默认为 5
+	PollInterval int // 发件箱轮询间隔（秒），默认为 5
+}
+
+// CaptchaConfig 登录验证码配置，验证码在本地生成，不依赖外部服务
+type CaptchaConfig struct {
+	Mode             string // off（默认）, always, failures：同一用户名或 IP 登录失败达到阈值后才要求验证码
+	FailureThreshold int    // failures 模式下的失败次数阈值，默认为 3
+	Type             string // digit（默认，数字验证码）, math（算术验证码）
+	Length           int    // 数字验证码位数，默认为 4
+	Expire           int    // 验证码有效期（秒），默认为 300
+	Store            string // 验证码存储：memory（默认，仅单实例）, db
+	Width            int    // 图片宽度，默认为 120
+	Height           int    // 图片高度，默认为 40
+}
+
+// PasswordConfig 密码策略配置，创建用户、修改密码时校验
+type PasswordConfig struct {
+	MinLength     int    // 最小长度，默认为 8
+	MaxLength     int    // 最大长度，默认为 64
+	RequireUpper  bool   // 必须包含大写字母
+	RequireLower  bool   // 必须包含小写字母
+	RequireDigit  bool   // 必须包含数字
+	RequireSymbol bool   // 必须包含特殊字符
+	CheckCommon   bool   // 拒绝内置常见弱密码列表中的密码
+	BlocklistFile string // 额外的弱密码列表文件，每行一个
+	HistorySize   int    // 不允许重复使用最近 N 次的密码，0 表示不限制
+
+	Algorithm         string // 新密码使用的哈希算法：argon2id（默认）, bcrypt
+	BcryptCost        int    // bcrypt 计算成本，默认为 10
+	Argon2Memory      uint32 // argon2id 内存开销（KiB），默认为 65536
+	Argon2Iterations  uint32 // argon2id 迭代次数，默认为 3
+	Argon2Parallelism uint8  // argon2id 并行度，默认为 4
+}
+
+// LoginConfig 登录防暴力破解配置，时间单位均为秒
+type LoginConfig struct {
+	Store              string // 失败计数存储：db, memory（仅单实例）
+	MaxAttempts        int    // 同一用户名在窗口期内允许的连续失败次数
+	IPMaxAttempts      int    // 同一 IP 在窗口期内允许的失败次数
+	Window             int    // 失败计数窗口期
+	LockoutDuration    int    // 首次锁定时长，之后每次锁定翻倍
+	MaxLockoutDuration int    // 最长锁定时长
+}
+
+// OAuthConfig 外部身份提供方（SSO）配置
+type OAuthConfig struct {
+	Providers []OIDCProviderConfig
+}
+
+type OIDCProviderConfig struct {
+	Name           string // 提供方名称，用于路由 /api/oauth/:provider
+	Issuer         string // OIDC Issuer，通过 {issuer}/.well-known/openid-configuration 自动发现端点
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string   // 回调地址，指向 /api/oauth/:provider/callback
+	Scopes         []string // 默认为 openid profile email
+	UsernameClaim  string   // 用作本地用户名的声明，默认为 preferred_username
+	GroupsClaim    string   // 用户组声明，默认为 groups
+	LinkByUsername bool     // 首次登录时是否关联同名的本地用户，要求双方邮箱已验证且一致，管理员不会被关联
+	SyncRoles      bool     // IdP 是角色的权威来源：每次登录按用户组同步已有用户的主角色，关闭时只在创建用户时设置
+	DefaultRole    string   // 未匹配任何用户组时的角色，默认为 user
+	RoleMappings   []OIDCRoleMapping
+}
+
+// OIDCRoleMapping 将 IdP 用户组映射为 Casbin 角色，按顺序匹配第一个
+type OIDCRoleMapping struct {
+	Group string
+	Role  string
 }
 
 type LogConfig struct {
@@ -26,6 +151,9 @@ type LogConfig struct {
 type ServerConfig struct {
 	Port string
 	Mode string
+	// TrustedProxies 可信的反向代理 IP 或 CIDR，只有来自这些地址的请求才读取 X-Forwarded-For 和 X-Real-IP，
+	// 默认为空，不信任任何代理，客户端 IP 取连接的对端地址
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -38,8 +166,25 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret string
-	Expire int
+	Secret          string   // 未配置 Keys 时使用的单一密钥，签发的令牌不带 kid
+	Expire          int      // 访问令牌有效期（秒）
+	RefreshExpire   int      // 刷新令牌有效期（秒）
+	RevocationStore string   // 令牌吊销存储：db, memory
+	ActiveKid       string   // 签发令牌使用的密钥 kid，为空时使用 Keys 中的第一个
+	Keys            []JWTKey // 所有有效的签名密钥，轮换期间新旧密钥同时保留
+}
+
+type JWTKey struct {
+	Kid            string
+	Algorithm      string // 签名算法：HS256（默认）, RS256, ES256, EdDSA 等
+	Secret         string // HMAC 算法使用的密钥
+	PrivateKeyFile string // 非对称算法的私钥 PEM 文件，仅用于校验的旧密钥可不配置
+	PublicKeyFile  string // 非对称算法的公钥 PEM 文件，未配置时由私钥推导
+}
+
+// IsHMAC 判断密钥是否使用对称算法
+func (k JWTKey) IsHMAC() bool {
+	return k.Algorithm == "" || strings.HasPrefix(k.Algorithm, "HS")
 }
 
 var GlobalConfig Config
@@ -51,9 +196,65 @@ func (c *Config) Validate() error {
 	if c.Database.Host == "" || c.Database.Port == "" {
 		return errors.New("数据库配置不完整")
 	}
-	if c.JWT.Secret == "" {
+	if c.JWT.Secret == "" && len(c.JWT.Keys) == 0 {
 		return errors.New("JWT密钥不能为空")
 	}
+	kids := make(map[string]bool, len(c.JWT.Keys))
+	for _, key := range c.JWT.Keys {
+		if key.Kid == "" {
+			return errors.New("JWT密钥的kid不能为空")
+		}
+		if key.IsHMAC() && key.Secret == "" {
+			return fmt.Errorf("JWT密钥secret不能为空: %s", key.Kid)
+		}
+		if !key.IsHMAC() && key.PrivateKeyFile == "" && key.PublicKeyFile == "" {
+			return fmt.Errorf("JWT密钥未配置PEM文件: %s", key.Kid)
+		}
+		if kids[key.Kid] {
+			return fmt.Errorf("JWT密钥kid重复: %s", key.Kid)
+		}
+		kids[key.Kid] = true
+	}
+	if c.JWT.ActiveKid != "" && !kids[c.JWT.ActiveKid] {
+		return fmt.Errorf("JWT签名密钥不存在: %s", c.JWT.ActiveKid)
+	}
+	switch c.Password.Algorithm {
+	case "", "argon2id", "bcrypt":
+	default:
+		return fmt.Errorf("不支持的密码哈希算法: %s", c.Password.Algorithm)
+	}
+	switch c.Captcha.Mode {
+	case "", "off", "always", "failures":
+	default:
+		return fmt.Errorf("不支持的验证码模式: %s", c.Captcha.Mode)
+	}
+	switch c.Captcha.Type {
+	case "", "digit", "math":
+	default:
+		return fmt.Errorf("不支持的验证码类型: %s", c.Captcha.Type)
+	}
+	switch c.Mail.Driver {
+	case "", "log", "file":
+	case "smtp":
+		if c.Mail.Host == "" || c.Mail.Port == 0 {
+			return errors.New("SMTP服务器配置不完整")
+		}
+	default:
+		return fmt.Errorf("不支持的邮件驱动: %s", c.Mail.Driver)
+	}
+	switch c.Casbin.Watcher.Driver {
+	case "", "db", "none":
+	case "pubsub":
+		if c.Casbin.Watcher.PubSub == "" {
+			return errors.New("未配置策略同步使用的发布订阅实现")
+		}
+	default:
+		return fmt.Errorf("不支持的策略同步方式: %s", c.Casbin.Watcher.Driver)
+	}
+	if deny := c.Casbin.Audit.DenyRate; c.Casbin.Audit.AllowRate < 0 || c.Casbin.Audit.AllowRate > 1 ||
+		deny != nil && (*deny < 0 || *deny > 1) {
+		return errors.New("鉴权审计的抽样比例必须在 0 到 1 之间")
+	}
 	return nil
 }
 
@@ -73,10 +274,29 @@ func Init() error {
 	return GlobalConfig.Validate()
 }
 
+var changeHooks []func(Config)
+
+// OnConfigChange 注册配置热重载后的回调，回调参数为新的配置
+func OnConfigChange(fn func(Config)) {
+	changeHooks = append(changeHooks, fn)
+}
+
 func WatchConfig() {
 	viper.WatchConfig()
 	viper.OnConfigChange(func(e fsnotify.Event) {
-		if err := viper.Unmarshal(&GlobalConfig); err != nil {
+		var conf Config
+		if err := viper.Unmarshal(&conf); err != nil {
+			log.Printf("配置重载失败: %v", err)
+			return
+		}
+		if err := conf.Validate(); err != nil {
+			log.Printf("配置校验失败，继续使用旧配置: %v", err)
+			return
+		}
+
+		GlobalConfig = conf
+		for _, fn := range changeHooks {
+			fn(conf)
 		}
 	})
 }
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CreateAPIKey 创建 API Key
+// @Summary 创建 API Key
+// @Description 为当前用户创建 API Key，可通过 X-API-Key 或 Authorization: ApiKey 请求头调用需要鉴权的接口；权限范围为空时继承用户角色的全部权限。完整密钥只返回一次
+// @Tags API Key
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.CreateAPIKeyRequests true "创建 API Key 请求参数"
+// @Success 200 {object} utils.Response{data=service.APIKeyResponses} "创建成功，返回完整密钥"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 500 {object} utils.Response{data=string} "创建失败"
+// @Router /me/api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	var req service.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger.Warn("创建API Key：无效的请求参数", zap.Error(err))
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	resp, err := service.CreateAPIKey(c.GetUint("userID"), &req)
+	if errors.Is(err, service.ErrInvalidAPIKeyScope) {
+		utils.Error(c, 400, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("创建API Key失败", zap.Error(err))
+		utils.Error(c, 500, "创建API Key失败")
+		return
+	}
+
+	utils.Success(c, resp)
+}
+
+// ListAPIKeys 查询 API Key
+// @Summary 查询 API Key
+// @Description 查询当前用户的 API Key，只返回前缀不返回完整密钥
+// @Tags API Key
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=[]service.APIKeyResponses} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /me/api-keys [get]
+func ListAPIKeys(c *gin.Context) {
+	listAPIKeys(c, c.GetUint("userID"))
+}
+
+// RevokeAPIKey 吊销 API Key
+// @Summary 吊销 API Key
+// @Description 吊销当前用户的 API Key，吊销后立即失效
+// @Tags API Key
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "API Key ID"
+// @Success 200 {object} utils.Response{data=string} "吊销成功"
+// @Failure 404 {object} utils.Response{data=string} "API Key不存在"
+// @Failure 500 {object} utils.Response{data=string} "吊销失败"
+// @Router /me/api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	keyID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	revokeAPIKey(c, c.GetUint("userID"), uint(keyID))
+}
+
+// ListUserAPIKeys 查询用户的 API Key
+// @Summary 查询用户的 API Key
+// @Description 管理员查询指定用户的 API Key
+// @Tags API Key
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "用户ID"
+// @Success 200 {object} utils.Response{data=[]service.APIKeyResponses} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /users/{id}/api-keys [get]
+func ListUserAPIKeys(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	listAPIKeys(c, uint(userID))
+}
+
+// RevokeUserAPIKey 吊销用户的 API Key
+// @Summary 吊销用户的 API Key
+// @Description 管理员吊销指定用户的 API Key，用于密钥泄露等情况
+// @Tags API Key
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "用户ID"
+// @Param keyId path uint true "API Key ID"
+// @Success 200 {object} utils.Response{data=string} "吊销成功"
+// @Failure 404 {object} utils.Response{data=string} "API Key不存在"
+// @Failure 500 {object} utils.Response{data=string} "吊销失败"
+// @Router /users/{id}/api-keys/{keyId} [delete]
+func RevokeUserAPIKey(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	keyID, _ := strconv.ParseUint(c.Param("keyId"), 10, 64)
+	revokeAPIKey(c, uint(userID), uint(keyID))
+}
+
+func listAPIKeys(c *gin.Context, userID uint) {
+	keys, err := service.ListAPIKeys(userID)
+	if err != nil {
+		middleware.Logger.Error("查询API Key失败", zap.Error(err))
+		utils.Error(c, 500, "查询API Key失败")
+		return
+	}
+
+	utils.Success(c, keys)
+}
+
+func revokeAPIKey(c *gin.Context, userID, keyID uint) {
+	err := service.RevokeAPIKey(userID, keyID)
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		utils.Error(c, 404, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("吊销API Key失败", zap.Error(err))
+		utils.Error(c, 500, "吊销API Key失败")
+		return
+	}
+
+	middleware.Logger.Info("吊销API Key",
+		zap.Uint("userID", userID),
+		zap.Uint("keyID", keyID),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "吊销成功")
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// clientInfo 读取客户端 IP 和 User-Agent，记录在登录会话中
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// RefreshToken 刷新令牌
+// @Summary 刷新令牌
+// @Description 使用刷新令牌换取新的访问令牌和刷新令牌，旧的刷新令牌随即失效；重复使用已失效的刷新令牌会撤销该登录会话的所有令牌
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body service.RefreshTokenRequests true "刷新令牌请求参数"
+// @Success 200 {object} utils.Response{data=service.LoginResponses} "刷新成功返回新的token信息"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 401 {object} utils.Response{data=string} "刷新令牌无效"
+// @Router /token/refresh [post]
+func RefreshToken(c *gin.Context) {
+	var req service.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger.Warn("刷新令牌：无效的请求参数", zap.Error(err))
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	resp, err := service.RefreshToken(&req, clientInfo(c))
+	if err != nil {
+		middleware.Logger.Warn("刷新令牌失败", zap.Error(err))
+		utils.Error(c, 401, err.Error())
+		return
+	}
+
+	utils.Success(c, resp)
+}
+
+// Logout 退出登录
+// @Summary 退出登录
+// @Description 吊销当前访问令牌；若提供刷新令牌，同时撤销该登录会话的所有刷新令牌
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.LogoutRequests false "退出登录请求参数"
+// @Success 200 {object} utils.Response{data=string} "退出登录成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 500 {object} utils.Response{data=string} "退出登录失败"
+// @Router /logout [post]
+func Logout(c *gin.Context) {
+	var req service.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			middleware.Logger.Warn("退出登录：无效的请求参数", zap.Error(err))
+			utils.Error(c, 400, "无效的请求参数")
+			return
+		}
+	}
+
+	userID := c.GetUint("userID")
+	err := service.Logout(userID, c.GetString("sessionID"), c.GetString("jti"), c.GetTime("tokenExpiresAt"), &req)
+	if err != nil {
+		middleware.Logger.Error("退出登录失败", zap.Uint("userID", userID), zap.Error(err))
+		utils.Error(c, 500, "退出登录失败")
+		return
+	}
+
+	utils.Success(c, "退出登录成功")
+}
+
+// LogoutAll 退出所有设备
+// @Summary 退出所有设备
+// @Description 使当前用户已签发的所有访问令牌和刷新令牌失效
+// @Tags 认证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=string} "退出所有设备成功"
+// @Failure 500 {object} utils.Response{data=string} "退出所有设备失败"
+// @Router /logout-all [post]
+func LogoutAll(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if err := service.LogoutAll(userID); err != nil {
+		middleware.Logger.Error("退出所有设备失败", zap.Uint("userID", userID), zap.Error(err))
+		utils.Error(c, 500, "退出所有设备失败")
+		return
+	}
+
+	utils.Success(c, "退出所有设备成功")
+}
+
+// JWKS 发布 JWT 校验公钥
+// 路径为 /.well-known/jwks.json，不在 /api 下，返回标准 JWKS 文档而非统一响应结构
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, middleware.JWKS())
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// GetCaptcha 获取登录验证码
+// @Summary 获取登录验证码
+// @Description 生成图片验证码，登录时提交 captcha_id 和图片中的答案；每个验证码只能校验一次
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} utils.Response{data=service.CaptchaResponses} "验证码ID和base64图片"
+// @Failure 500 {object} utils.Response{data=string} "生成验证码失败"
+// @Router /captcha [get]
+func GetCaptcha(c *gin.Context) {
+	resp, err := service.GenerateCaptcha()
+	if err != nil {
+		middleware.Logger.Error("生成验证码失败", zap.Error(err))
+		utils.Error(c, 500, "生成验证码失败")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	utils.Success(c, resp)
+}
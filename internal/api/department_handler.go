@@ -0,0 +1,227 @@
+package api
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// departmentFailed 部门不存在时返回 404，上级部门无效时返回 400，部门仍在使用时返回 409
+func departmentFailed(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrDepartmentNotFound):
+		utils.Error(c, 404, err.Error())
+	case errors.Is(err, service.ErrInvalidParentDepartment):
+		utils.Error(c, 400, err.Error())
+	case errors.Is(err, service.ErrDepartmentInUse):
+		utils.Error(c, 409, err.Error())
+	default:
+		middleware.Logger.Error(msg, zap.Error(err))
+		utils.Error(c, 500, msg)
+	}
+}
+
+// ListDepartments 查询部门
+// @Summary 查询部门
+// @Description 以树的形式返回当前租户的全部部门
+// @Tags 数据权限
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=[]service.DepartmentNodes} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /departments [get]
+func ListDepartments(c *gin.Context) {
+	tree, err := service.ListDepartments(c.GetUint("tenantID"))
+	if err != nil {
+		middleware.Logger.Error("查询部门失败", zap.Error(err))
+		utils.Error(c, 500, "查询部门失败")
+		return
+	}
+
+	utils.Success(c, tree)
+}
+
+// CreateDepartment 创建部门
+// @Summary 创建部门
+// @Description 在当前租户内创建部门，parent_id 为 0 时创建顶级部门
+// @Tags 数据权限
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.DepartmentRequests true "部门"
+// @Success 200 {object} utils.Response{data=service.DepartmentNodes} "创建成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数或上级部门"
+// @Failure 500 {object} utils.Response{data=string} "创建失败"
+// @Router /departments [post]
+func CreateDepartment(c *gin.Context) {
+	var req service.DepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	dept, err := service.CreateDepartment(c.GetUint("tenantID"), &req)
+	if err != nil {
+		departmentFailed(c, err, "创建部门失败")
+		return
+	}
+
+	middleware.Logger.Info("创建部门",
+		zap.Uint("id", dept.ID),
+		zap.String("name", dept.Name),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, dept)
+}
+
+// UpdateDepartment 修改部门
+// @Summary 修改部门
+// @Description 修改部门名称、排序或上级部门，上级部门不能是部门自己或其下级部门
+// @Tags 数据权限
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "部门ID"
+// @Param request body service.DepartmentRequests true "部门"
+// @Success 200 {object} utils.Response{data=string} "修改成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数或上级部门"
+// @Failure 404 {object} utils.Response{data=string} "部门不存在"
+// @Failure 500 {object} utils.Response{data=string} "修改失败"
+// @Router /departments/{id} [put]
+func UpdateDepartment(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	var req service.DepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	if err := service.UpdateDepartment(c.GetUint("tenantID"), uint(id), &req); err != nil {
+		departmentFailed(c, err, "修改部门失败")
+		return
+	}
+
+	middleware.Logger.Info("修改部门",
+		zap.Uint64("id", id),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "修改成功")
+}
+
+// DeleteDepartment 删除部门
+// @Summary 删除部门
+// @Description 删除没有子部门和用户的部门，并从角色的自定义数据权限中移除
+// @Tags 数据权限
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "部门ID"
+// @Success 200 {object} utils.Response{data=string} "删除成功"
+// @Failure 404 {object} utils.Response{data=string} "部门不存在"
+// @Failure 409 {object} utils.Response{data=string} "部门下还有子部门或用户"
+// @Failure 500 {object} utils.Response{data=string} "删除失败"
+// @Router /departments/{id} [delete]
+func DeleteDepartment(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := service.DeleteDepartment(c.GetUint("tenantID"), uint(id)); err != nil {
+		departmentFailed(c, err, "删除部门失败")
+		return
+	}
+
+	middleware.Logger.Info("删除部门",
+		zap.Uint64("id", id),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "删除成功")
+}
+
+// ListDataScopes 查询角色数据权限
+// @Summary 查询角色数据权限
+// @Description 查询当前租户内所有设置过数据权限的角色，未设置的角色不限制数据范围
+// @Tags 数据权限
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=[]service.DataScopeResponses} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /data-scopes [get]
+func ListDataScopes(c *gin.Context) {
+	list, err := service.ListDataScopes(c.GetUint("tenantID"))
+	if err != nil {
+		middleware.Logger.Error("查询角色数据权限失败", zap.Error(err))
+		utils.Error(c, 500, "查询角色数据权限失败")
+		return
+	}
+
+	utils.Success(c, list)
+}
+
+// SetDataScope 设置角色数据权限
+// @Summary 设置角色数据权限
+// @Description 设置角色在当前租户内可以访问的数据：all 全部，dept 本部门及下级部门，custom 指定部门，self 仅本人
+// @Tags 数据权限
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param role path string true "角色"
+// @Param request body service.DataScopeRequests true "数据权限"
+// @Success 200 {object} utils.Response{data=string} "设置成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的数据权限，或部门、角色不存在"
+// @Failure 500 {object} utils.Response{data=string} "设置失败"
+// @Router /data-scopes/{role} [put]
+func SetDataScope(c *gin.Context) {
+	var req service.DataScopeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	role := c.Param("role")
+	err := service.SetDataScope(c.GetUint("tenantID"), role, &req)
+	if errors.Is(err, service.ErrInvalidDataScope) || errors.Is(err, service.ErrDepartmentNotFound) || errors.Is(err, service.ErrRoleNotFound) {
+		utils.Error(c, 400, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("设置角色数据权限失败", zap.String("role", role), zap.Error(err))
+		utils.Error(c, 500, "设置角色数据权限失败")
+		return
+	}
+
+	middleware.Logger.Info("设置角色数据权限",
+		zap.String("role", role),
+		zap.String("scope", req.Scope),
+		zap.Uints("departmentIDs", req.DepartmentIDs),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "设置成功")
+}
+
+// DeleteDataScope 删除角色数据权限
+// @Summary 删除角色数据权限
+// @Description 删除角色在当前租户内的数据权限，之后计算数据范围时不再考虑该角色
+// @Tags 数据权限
+// @Produce json
+// @Security BearerAuth
+// @Param role path string true "角色"
+// @Success 200 {object} utils.Response{data=string} "删除成功"
+// @Failure 404 {object} utils.Response{data=string} "角色未设置数据权限"
+// @Failure 500 {object} utils.Response{data=string} "删除失败"
+// @Router /data-scopes/{role} [delete]
+func DeleteDataScope(c *gin.Context) {
+	role := c.Param("role")
+	err := service.DeleteDataScope(c.GetUint("tenantID"), role)
+	if errors.Is(err, service.ErrDataScopeNotFound) {
+		utils.Error(c, 404, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("删除角色数据权限失败", zap.String("role", role), zap.Error(err))
+		utils.Error(c, 500, "删除角色数据权限失败")
+		return
+	}
+
+	middleware.Logger.Info("删除角色数据权限",
+		zap.String("role", role),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "删除成功")
+}
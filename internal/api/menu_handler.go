@@ -0,0 +1,209 @@
+package api
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// menuFailed 菜单不存在时返回 404，参数无效时返回 400，没有权限时返回 403，菜单仍有下级或修改后操作者将失去权限时返回 409
+func menuFailed(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrMenuNotFound):
+		utils.Error(c, 404, err.Error())
+	case errors.Is(err, service.ErrInvalidMenu), errors.Is(err, service.ErrInvalidPolicy), errors.Is(err, service.ErrRoleNotFound):
+		utils.Error(c, 400, err.Error())
+	case errors.Is(err, service.ErrRBACDomainForbidden):
+		utils.Error(c, 403, err.Error())
+	case errors.Is(err, service.ErrMenuInUse), errors.Is(err, service.ErrRBACLockout):
+		utils.Error(c, 409, err.Error())
+	default:
+		middleware.Logger.Error(msg, zap.Error(err))
+		utils.Error(c, 500, msg)
+	}
+}
+
+// ListMenus 查询菜单
+// @Summary 查询菜单
+// @Description 以树的形式返回全部菜单和按钮，包括禁用的菜单和绑定的接口
+// @Tags 菜单管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=[]service.MenuNodes} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /menus [get]
+func ListMenus(c *gin.Context) {
+	tree, err := service.ListMenus()
+	if err != nil {
+		middleware.Logger.Error("查询菜单失败", zap.Error(err))
+		utils.Error(c, 500, "查询菜单失败")
+		return
+	}
+
+	utils.Success(c, tree)
+}
+
+// CreateMenu 创建菜单
+// @Summary 创建菜单
+// @Description 创建目录、菜单或按钮，只有平台管理员可以操作；apis 为菜单需要访问的接口，必须匹配已注册的接口
+// @Tags 菜单管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.MenuRequests true "菜单"
+// @Success 200 {object} utils.Response{data=service.MenuNodes} "创建成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的菜单"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "创建失败"
+// @Router /menus [post]
+func CreateMenu(c *gin.Context) {
+	var req service.MenuRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	menu, err := service.CreateMenu(rbacOperator(c), &req)
+	if err != nil {
+		menuFailed(c, err, "创建菜单失败")
+		return
+	}
+
+	utils.Success(c, menu)
+}
+
+// UpdateMenu 修改菜单
+// @Summary 修改菜单
+// @Description 修改菜单，只有平台管理员可以操作；绑定的接口变化时同步修改已分配该菜单的角色的策略
+// @Tags 菜单管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "菜单ID"
+// @Param request body service.MenuRequests true "菜单"
+// @Success 200 {object} utils.Response{data=string} "修改成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的菜单"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 404 {object} utils.Response{data=string} "菜单不存在"
+// @Failure 409 {object} utils.Response{data=string} "修改后将失去管理权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "修改失败"
+// @Router /menus/{id} [put]
+func UpdateMenu(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	var req service.MenuRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	if err := service.UpdateMenu(rbacOperator(c), uint(id), &req); err != nil {
+		menuFailed(c, err, "修改菜单失败")
+		return
+	}
+
+	utils.Success(c, "修改成功")
+}
+
+// DeleteMenu 删除菜单
+// @Summary 删除菜单
+// @Description 删除没有下级的菜单或按钮，只有平台管理员可以操作；同时移除角色的菜单分配和对应的策略
+// @Tags 菜单管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "菜单ID"
+// @Success 200 {object} utils.Response{data=string} "删除成功"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 404 {object} utils.Response{data=string} "菜单不存在"
+// @Failure 409 {object} utils.Response{data=string} "菜单下还有子菜单或按钮"
+// @Failure 500 {object} utils.Response{data=string} "删除失败"
+// @Router /menus/{id} [delete]
+func DeleteMenu(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := service.DeleteMenu(rbacOperator(c), uint(id)); err != nil {
+		menuFailed(c, err, "删除菜单失败")
+		return
+	}
+
+	utils.Success(c, "删除成功")
+}
+
+// GetRoleMenus 查询角色的菜单
+// @Summary 查询角色的菜单
+// @Description 查询角色在域内分配的菜单和按钮ID
+// @Tags 菜单管理
+// @Produce json
+// @Security BearerAuth
+// @Param role path string true "角色"
+// @Param dom query string false "域，默认为当前租户"
+// @Success 200 {object} utils.Response{data=[]uint} "查询成功"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /rbac/roles/{role}/menus [get]
+func GetRoleMenus(c *gin.Context) {
+	dom := c.DefaultQuery("dom", middleware.TenantDomain(c.GetUint("tenantID")))
+	ids, err := service.GetRoleMenus(rbacOperator(c), c.Param("role"), dom)
+	if err != nil {
+		menuFailed(c, err, "查询角色菜单失败")
+		return
+	}
+
+	utils.Success(c, ids)
+}
+
+// SetRoleMenus 设置角色的菜单
+// @Summary 设置角色的菜单
+// @Description 设置角色在域内的菜单和按钮，并按菜单绑定的接口增删角色的 p 策略
+// @Tags 菜单管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param role path string true "角色"
+// @Param request body service.RoleMenuRequests true "菜单"
+// @Success 200 {object} utils.Response{data=string} "设置成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的角色、域或菜单"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 409 {object} utils.Response{data=string} "修改后将失去管理权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "设置失败"
+// @Router /rbac/roles/{role}/menus [put]
+func SetRoleMenus(c *gin.Context) {
+	var req service.RoleMenuRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+	if req.Dom == "" {
+		req.Dom = middleware.TenantDomain(c.GetUint("tenantID"))
+	}
+
+	if err := service.SetRoleMenus(rbacOperator(c), c.Param("role"), &req); err != nil {
+		menuFailed(c, err, "设置角色菜单失败")
+		return
+	}
+
+	utils.Success(c, "设置成功")
+}
+
+// GetMyMenus 查询我的菜单
+// @Summary 查询我的菜单
+// @Description 返回当前用户的角色可以使用的菜单树（前端路由格式）和按钮权限标识
+// @Tags 菜单管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=service.UserMenusResponses} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /me/menus [get]
+func GetMyMenus(c *gin.Context) {
+	menus, err := service.GetUserMenus(c.GetUint("userID"), c.GetUint("tenantID"))
+	if err != nil {
+		middleware.Logger.Error("查询用户菜单失败", zap.Error(err))
+		utils.Error(c, 500, "查询用户菜单失败")
+		return
+	}
+
+	utils.Success(c, menus)
+}
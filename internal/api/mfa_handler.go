@@ -0,0 +1,298 @@
+package api
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// mfaErrorStatus 两步验证业务错误返回 400，其余返回 500
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrMFANotEnrolled),
+		errors.Is(err, service.ErrMFAAlreadyEnabled),
+		errors.Is(err, service.ErrMFASetupNotStarted),
+		errors.Is(err, service.ErrMFAInvalidCode),
+		errors.Is(err, service.ErrMFARequiredByRole):
+		return 400
+	default:
+		return 500
+	}
+}
+
+// LoginMFA 两步验证登录
+// @Summary 两步验证登录
+// @Description 使用密码登录返回的 mfa_token 和身份验证器验证码（或恢复码）完成登录；首次设置时校验通过即启用两步验证并返回恢复码
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body service.MFALoginRequests true "两步验证登录请求参数"
+// @Success 200 {object} utils.Response{data=service.LoginResponses} "登录成功返回token信息"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 401 {object} utils.Response{data=string} "两步验证失败"
+// @Failure 429 {object} utils.Response{data=string} "失败次数过多，已临时锁定"
+// @Router /login/mfa [post]
+func LoginMFA(c *gin.Context) {
+	var req service.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger.Warn("两步验证登录：无效的请求参数", zap.Error(err))
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	resp, err := service.VerifyLoginMFA(&req, clientInfo(c))
+	if err != nil {
+		middleware.Logger.Warn("两步验证登录失败", zap.Error(err))
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+			utils.Error(c, 429, err.Error())
+			return
+		}
+		utils.Error(c, 401, err.Error())
+		return
+	}
+
+	utils.Success(c, resp)
+}
+
+// LoginMFASetup 登录时设置两步验证
+// @Summary 登录时设置两步验证
+// @Description 角色要求两步验证而用户尚未启用时，使用 mfa_token 获取密钥，再调用 /login/mfa 提交验证码完成启用和登录
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body service.MFASetupRequests true "设置两步验证请求参数"
+// @Success 200 {object} utils.Response{data=service.MFAEnrollResponses} "返回密钥和扫码地址"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 401 {object} utils.Response{data=string} "两步验证令牌无效"
+// @Router /login/mfa/setup [post]
+func LoginMFASetup(c *gin.Context) {
+	var req service.MFASetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger.Warn("设置两步验证：无效的请求参数", zap.Error(err))
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	resp, err := service.SetupLoginMFA(&req)
+	if err != nil {
+		middleware.Logger.Warn("设置两步验证失败", zap.Error(err))
+		utils.Error(c, 401, err.Error())
+		return
+	}
+
+	utils.Success(c, resp)
+}
+
+// GetMFAStatus 查询两步验证状态
+// @Summary 查询两步验证状态
+// @Description 查询当前用户是否启用两步验证、角色是否要求两步验证以及剩余恢复码数量
+// @Tags 两步验证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=service.MFAStatusResponses} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /mfa [get]
+func GetMFAStatus(c *gin.Context) {
+	status, err := service.GetMFAStatus(c.GetUint("userID"))
+	if err != nil {
+		middleware.Logger.Error("查询两步验证状态失败", zap.Error(err))
+		utils.Error(c, 500, "查询两步验证状态失败")
+		return
+	}
+
+	utils.Success(c, status)
+}
+
+// EnrollMFA 获取两步验证密钥
+// @Summary 获取两步验证密钥
+// @Description 生成新的 TOTP 密钥和 otpauth:// 扫码地址，提交验证码确认后才会启用
+// @Tags 两步验证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=service.MFAEnrollResponses} "返回密钥和扫码地址"
+// @Failure 400 {object} utils.Response{data=string} "已启用两步验证"
+// @Failure 500 {object} utils.Response{data=string} "生成密钥失败"
+// @Router /mfa/enroll [post]
+func EnrollMFA(c *gin.Context) {
+	resp, err := service.EnrollMFA(c.GetUint("userID"), c.GetString("username"))
+	if err != nil {
+		middleware.Logger.Warn("生成两步验证密钥失败", zap.Error(err))
+		utils.Error(c, mfaErrorStatus(err), err.Error())
+		return
+	}
+
+	utils.Success(c, resp)
+}
+
+// ConfirmMFA 启用两步验证
+// @Summary 启用两步验证
+// @Description 提交身份验证器中的验证码确认密钥并启用两步验证，返回一次性恢复码（只显示一次）
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.MFACodeRequests true "验证码"
+// @Success 200 {object} utils.Response{data=[]string} "返回恢复码"
+// @Failure 400 {object} utils.Response{data=string} "验证码错误"
+// @Router /mfa/enroll/verify [post]
+func ConfirmMFA(c *gin.Context) {
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	codes, err := service.ConfirmMFA(c.GetUint("userID"), req.Code)
+	if err != nil {
+		middleware.Logger.Warn("启用两步验证失败", zap.Error(err))
+		utils.Error(c, mfaErrorStatus(err), err.Error())
+		return
+	}
+
+	utils.Success(c, codes)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+// @Summary 重新生成恢复码
+// @Description 校验验证码后重新生成恢复码，旧的恢复码全部失效
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.MFACodeRequests true "验证码"
+// @Success 200 {object} utils.Response{data=[]string} "返回恢复码"
+// @Failure 400 {object} utils.Response{data=string} "验证码错误"
+// @Router /mfa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	codes, err := service.RegenerateRecoveryCodes(c.GetUint("userID"), req.Code)
+	if err != nil {
+		middleware.Logger.Warn("重新生成恢复码失败", zap.Error(err))
+		utils.Error(c, mfaErrorStatus(err), err.Error())
+		return
+	}
+
+	utils.Success(c, codes)
+}
+
+// DisableMFA 关闭两步验证
+// @Summary 关闭两步验证
+// @Description 校验验证码后关闭两步验证；用户的任一角色（包括继承的角色和其他租户内的角色）要求两步验证时不允许关闭
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.MFACodeRequests true "验证码"
+// @Success 200 {object} utils.Response{data=string} "关闭成功"
+// @Failure 400 {object} utils.Response{data=string} "验证码错误"
+// @Router /mfa [delete]
+func DisableMFA(c *gin.Context) {
+	var req service.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	err := service.DisableMFA(c.GetUint("userID"), req.Code)
+	if err != nil {
+		middleware.Logger.Warn("关闭两步验证失败", zap.Error(err))
+		utils.Error(c, mfaErrorStatus(err), err.Error())
+		return
+	}
+
+	utils.Success(c, "关闭两步验证成功")
+}
+
+// ListMFARolePolicies 查询角色两步验证要求
+// @Summary 查询角色两步验证要求
+// @Description 查询所有设置过两步验证要求的角色
+// @Tags 两步验证
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=[]model.MFARolePolicy} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /mfa/roles [get]
+func ListMFARolePolicies(c *gin.Context) {
+	policies, err := service.ListMFARolePolicies()
+	if err != nil {
+		middleware.Logger.Error("查询角色两步验证要求失败", zap.Error(err))
+		utils.Error(c, 500, "查询角色两步验证要求失败")
+		return
+	}
+
+	utils.Success(c, policies)
+}
+
+// SetMFARolePolicy 设置角色两步验证要求
+// @Summary 设置角色两步验证要求
+// @Description 要求指定角色的用户必须启用两步验证，未启用的用户下次登录时需要先完成设置
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param role path string true "角色"
+// @Param request body service.MFARolePolicyRequests true "是否要求两步验证"
+// @Success 200 {object} utils.Response{data=string} "设置成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数或角色不存在"
+// @Failure 500 {object} utils.Response{data=string} "设置失败"
+// @Router /mfa/roles/{role} [put]
+func SetMFARolePolicy(c *gin.Context) {
+	var req service.MFARolePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	role := c.Param("role")
+	if err := service.SetMFARolePolicy(role, &req); err != nil {
+		if errors.Is(err, service.ErrRoleNotFound) {
+			utils.Error(c, 400, err.Error())
+			return
+		}
+		middleware.Logger.Error("设置角色两步验证要求失败", zap.String("role", role), zap.Error(err))
+		utils.Error(c, 500, "设置角色两步验证要求失败")
+		return
+	}
+
+	middleware.Logger.Info("设置角色两步验证要求",
+		zap.String("role", role),
+		zap.Bool("required", req.Required),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "设置成功")
+}
+
+// ResetUserMFA 重置用户两步验证
+// @Summary 重置用户两步验证
+// @Description 管理员删除指定用户的两步验证设置和恢复码，用于用户丢失身份验证器的情况
+// @Tags 两步验证
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "用户ID"
+// @Success 200 {object} utils.Response{data=string} "重置成功"
+// @Failure 500 {object} utils.Response{data=string} "重置失败"
+// @Router /users/{id}/mfa [delete]
+func ResetUserMFA(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := service.ResetUserMFA(uint(userID)); err != nil {
+		middleware.Logger.Error("重置用户两步验证失败", zap.Error(err))
+		utils.Error(c, 500, "重置用户两步验证失败")
+		return
+	}
+
+	middleware.Logger.Info("重置用户两步验证",
+		zap.Uint64("userID", userID),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "重置成功")
+}
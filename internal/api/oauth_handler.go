@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"fastgin/internal/idp"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// OAuthLogin 跳转到外部身份提供方登录
+// @Summary SSO登录
+// @Description 生成 state、nonce 和 PKCE 参数后跳转到外部身份提供方（OIDC）的登录页
+// @Tags 认证
+// @Produce json
+// @Param provider path string true "身份提供方名称"
+// @Success 302 {string} string "跳转到身份提供方"
+// @Failure 404 {object} utils.Response{data=string} "身份提供方不存在"
+// @Failure 502 {object} utils.Response{data=string} "身份提供方不可用"
+// @Router /oauth/{provider}/login [get]
+func OAuthLogin(c *gin.Context) {
+	provider := c.Param("provider")
+	authURL, err := service.OAuthLoginURL(c.Request.Context(), provider)
+	if err != nil {
+		if errors.Is(err, idp.ErrProviderNotFound) {
+			utils.Error(c, 404, err.Error())
+			return
+		}
+		middleware.Logger.Error("生成SSO登录地址失败",
+			zap.String("provider", provider),
+			zap.Error(err))
+		utils.Error(c, 502, "身份提供方不可用")
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// oauthCallbackFailed 按错误类型返回固定的提示，身份提供方返回的具体原因只记录在日志中
+func oauthCallbackFailed(c *gin.Context, provider string, err error) {
+	switch {
+	case errors.Is(err, idp.ErrProviderNotFound):
+		utils.Error(c, 404, idp.ErrProviderNotFound.Error())
+	case errors.Is(err, service.ErrInvalidOAuthState):
+		utils.Error(c, 400, service.ErrInvalidOAuthState.Error())
+	case errors.Is(err, service.ErrAccountNotActivated):
+		utils.Error(c, 403, service.ErrAccountNotActivated.Error())
+	case errors.Is(err, service.ErrOAuthExchange), errors.Is(err, service.ErrOAuthUserDeleted):
+		middleware.Logger.Warn("SSO登录失败",
+			zap.String("provider", provider),
+			zap.Error(err))
+		utils.Error(c, 401, "SSO登录失败")
+	default:
+		middleware.Logger.Error("SSO登录失败",
+			zap.String("provider", provider),
+			zap.Error(err))
+		utils.Error(c, 500, "SSO登录失败")
+	}
+}
+
+// OAuthCallback 外部身份提供方登录回调
+// @Summary SSO登录回调
+// @Description 校验 state，用授权码换取并校验 ID Token，关联或创建本地用户后返回 FastGin 令牌
+// @Tags 认证
+// @Produce json
+// @Param provider path string true "身份提供方名称"
+// @Param code query string true "授权码"
+// @Param state query string true "登录请求标识"
+// @Success 200 {object} utils.Response{data=service.LoginResponses} "登录成功返回token信息；已启用或角色要求两步验证时返回 mfa_token，需要继续调用 /login/mfa"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数，或登录请求无效、已过期"
+// @Failure 401 {object} utils.Response{data=string} "SSO登录失败"
+// @Failure 403 {object} utils.Response{data=string} "账号未激活"
+// @Failure 404 {object} utils.Response{data=string} "身份提供方不存在"
+// @Failure 500 {object} utils.Response{data=string} "SSO登录失败"
+// @Router /oauth/{provider}/callback [get]
+func OAuthCallback(c *gin.Context) {
+	provider := c.Param("provider")
+
+	if errCode := c.Query("error"); errCode != "" {
+		middleware.Logger.Warn("身份提供方返回错误",
+			zap.String("provider", provider),
+			zap.String("error", errCode),
+			zap.String("description", c.Query("error_description")))
+		utils.Error(c, 401, "SSO登录失败")
+		return
+	}
+
+	var req service.OAuthCallbackRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		middleware.Logger.Warn("SSO回调：无效的请求参数", zap.Error(err))
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	resp, err := service.OAuthCallback(c.Request.Context(), provider, &req, clientInfo(c))
+	if err != nil {
+		oauthCallbackFailed(c, provider, err)
+		return
+	}
+
+	utils.Success(c, resp)
+}
@@ -0,0 +1,427 @@
+package api
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// rbacOperator 当前请求的操作者
+func rbacOperator(c *gin.Context) service.RBACOperator {
+	return service.RBACOperator{
+		UserID:   c.GetUint("userID"),
+		Username: c.GetString("username"),
+		Subject:  middleware.UserSubject(c.GetUint("userID")),
+		Domain:   middleware.TenantDomain(c.GetUint("tenantID")),
+	}
+}
+
+// policyWriteFailed 将策略写入错误转换为响应
+func policyWriteFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidPolicy), errors.Is(err, service.ErrRoleNotFound), errors.Is(err, service.ErrRoleDisabled):
+		utils.Error(c, 400, err.Error())
+	case errors.Is(err, service.ErrPolicyNotFound):
+		utils.Error(c, 404, err.Error())
+	case errors.Is(err, service.ErrRBACDomainForbidden):
+		utils.Error(c, 403, err.Error())
+	case errors.Is(err, service.ErrPolicyExists), errors.Is(err, service.ErrRBACLockout):
+		utils.Error(c, 409, err.Error())
+	default:
+		middleware.Logger.Error("修改权限策略失败", zap.Error(err))
+		utils.Error(c, 500, "修改权限策略失败")
+	}
+}
+
+// ListPolicies 查询权限策略
+// @Summary 查询权限策略
+// @Description 查询 Casbin p 策略，参数为空时不过滤；非平台管理员只能看到在当前租户内生效的策略
+// @Tags 权限管理
+// @Produce json
+// @Security BearerAuth
+// @Param sub query string false "主体（角色）"
+// @Param dom query string false "域（tenant:<租户ID> 或 *）"
+// @Param obj query string false "资源路径"
+// @Param act query string false "请求方法"
+// @Success 200 {object} utils.Response{data=[]service.PolicyRules} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /rbac/policies [get]
+func ListPolicies(c *gin.Context) {
+	list, err := service.ListPolicies(rbacOperator(c), service.PolicyRule{
+		Sub: c.Query("sub"),
+		Dom: c.Query("dom"),
+		Obj: c.Query("obj"),
+		Act: c.Query("act"),
+	})
+	if err != nil {
+		middleware.Logger.Error("查询权限策略失败", zap.Error(err))
+		utils.Error(c, 500, "查询权限策略失败")
+		return
+	}
+
+	utils.Success(c, list)
+}
+
+// AddPolicy 添加权限策略
+// @Summary 添加权限策略
+// @Description 添加 Casbin p 策略，立即生效；dom 为 tenant:<租户ID> 或 *（所有租户），obj 支持 :param 和 *，act 为 HTTP 方法或 *
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.PolicyRules true "策略"
+// @Success 200 {object} utils.Response{data=string} "添加成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的策略"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 409 {object} utils.Response{data=string} "策略已存在"
+// @Failure 500 {object} utils.Response{data=string} "添加失败"
+// @Router /rbac/policies [post]
+func AddPolicy(c *gin.Context) {
+	var req service.PolicyRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	if err := service.AddPolicy(rbacOperator(c), req); err != nil {
+		policyWriteFailed(c, err)
+		return
+	}
+
+	utils.Success(c, "添加成功")
+}
+
+// RemovePolicy 删除权限策略
+// @Summary 删除权限策略
+// @Description 删除 Casbin p 策略，立即生效；删除后操作者将无法再管理权限策略时拒绝删除
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.PolicyRules true "策略"
+// @Success 200 {object} utils.Response{data=string} "删除成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的策略"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 404 {object} utils.Response{data=string} "策略不存在"
+// @Failure 409 {object} utils.Response{data=string} "不能移除自己管理权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "删除失败"
+// @Router /rbac/policies [delete]
+func RemovePolicy(c *gin.Context) {
+	var req service.PolicyRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	if err := service.RemovePolicy(rbacOperator(c), req); err != nil {
+		policyWriteFailed(c, err)
+		return
+	}
+
+	utils.Success(c, "删除成功")
+}
+
+// ListGroupings 查询角色分配
+// @Summary 查询角色分配
+// @Description 查询 Casbin g 策略，参数为空时不过滤；非平台管理员只能看到在当前租户内生效的角色分配
+// @Tags 权限管理
+// @Produce json
+// @Security BearerAuth
+// @Param user query string false "用户或子角色"
+// @Param role query string false "角色"
+// @Param dom query string false "域"
+// @Success 200 {object} utils.Response{data=[]service.GroupingRules} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /rbac/groupings [get]
+func ListGroupings(c *gin.Context) {
+	list, err := service.ListGroupings(rbacOperator(c), service.GroupingRule{
+		User: c.Query("user"),
+		Role: c.Query("role"),
+		Dom:  c.Query("dom"),
+	})
+	if err != nil {
+		middleware.Logger.Error("查询角色分配失败", zap.Error(err))
+		utils.Error(c, 500, "查询角色分配失败")
+		return
+	}
+
+	utils.Success(c, list)
+}
+
+// AddGrouping 分配角色
+// @Summary 分配角色
+// @Description 添加 Casbin g 策略，user 为角色时表示角色继承；dom 为 * 时在所有租户内生效；不允许形成继承环
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.GroupingRules true "角色分配"
+// @Success 200 {object} utils.Response{data=string} "分配成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的角色分配或角色不存在"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 409 {object} utils.Response{data=string} "角色分配已存在"
+// @Failure 500 {object} utils.Response{data=string} "分配失败"
+// @Router /rbac/groupings [post]
+func AddGrouping(c *gin.Context) {
+	var req service.GroupingRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	if err := service.AddGrouping(rbacOperator(c), req); err != nil {
+		policyWriteFailed(c, err)
+		return
+	}
+
+	utils.Success(c, "分配成功")
+}
+
+// RemoveGrouping 移除角色分配
+// @Summary 移除角色分配
+// @Description 删除 Casbin g 策略，立即生效
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.GroupingRules true "角色分配"
+// @Success 200 {object} utils.Response{data=string} "移除成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的角色分配"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 404 {object} utils.Response{data=string} "角色分配不存在"
+// @Failure 409 {object} utils.Response{data=string} "不能移除自己管理权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "移除失败"
+// @Router /rbac/groupings [delete]
+func RemoveGrouping(c *gin.Context) {
+	var req service.GroupingRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	if err := service.RemoveGrouping(rbacOperator(c), req); err != nil {
+		policyWriteFailed(c, err)
+		return
+	}
+
+	utils.Success(c, "移除成功")
+}
+
+// ListRoles 查询角色列表
+// @Summary 查询角色列表
+// @Description 列出所有角色及其直接权限、继承的角色和成员；非平台管理员只能看到在当前租户内生效的部分
+// @Tags 权限管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=[]service.RoleInfos} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /rbac/roles [get]
+func ListRoles(c *gin.Context) {
+	list, err := service.ListRoles(rbacOperator(c))
+	if err != nil {
+		middleware.Logger.Error("查询角色列表失败", zap.Error(err))
+		utils.Error(c, 500, "查询角色列表失败")
+		return
+	}
+
+	utils.Success(c, list)
+}
+
+// GetRole 查询角色权限
+// @Summary 查询角色权限
+// @Description 查询角色在指定域内的全部权限，包含从其他角色继承的权限
+// @Tags 权限管理
+// @Produce json
+// @Security BearerAuth
+// @Param role path string true "角色"
+// @Param dom query string false "域，默认为当前租户"
+// @Success 200 {object} utils.Response{data=service.RoleInfos} "查询成功"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /rbac/roles/{role} [get]
+func GetRole(c *gin.Context) {
+	dom := c.DefaultQuery("dom", middleware.TenantDomain(c.GetUint("tenantID")))
+	info, err := service.GetRole(rbacOperator(c), c.Param("role"), dom)
+	if errors.Is(err, service.ErrRBACDomainForbidden) {
+		utils.Error(c, 403, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("查询角色权限失败", zap.Error(err))
+		utils.Error(c, 500, "查询角色权限失败")
+		return
+	}
+
+	utils.Success(c, info)
+}
+
+// CheckPolicy 权限检查
+// @Summary 权限检查
+// @Description 使用当前生效的策略判断主体能否访问指定接口，返回命中的策略，不修改任何数据
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.PolicyRules true "待检查的请求"
+// @Success 200 {object} utils.Response{data=service.PolicyCheckResults} "检查结果"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "检查失败"
+// @Router /rbac/check [post]
+func CheckPolicy(c *gin.Context) {
+	var req service.PolicyRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	result, err := service.CheckPolicy(rbacOperator(c), req)
+	if errors.Is(err, service.ErrRBACDomainForbidden) {
+		utils.Error(c, 403, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("权限检查失败", zap.Error(err))
+		utils.Error(c, 500, "权限检查失败")
+		return
+	}
+
+	utils.Success(c, result)
+}
+
+// decisionQuery 解析鉴权审计记录的查询条件
+func decisionQuery(c *gin.Context) (service.DecisionQuery, error) {
+	q := service.DecisionQuery{Path: c.Query("path")}
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return q, err
+		}
+		q.UserID = uint(id)
+	}
+	if v := c.Query("allowed"); v != "" {
+		allowed, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, err
+		}
+		q.Allowed = &allowed
+	}
+	var err error
+	if v := c.Query("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, err
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// ListDecisions 查询鉴权审计记录
+// @Summary 查询鉴权审计记录
+// @Description 分页查询抽样记录的鉴权决策，需要在配置中启用 casbin.audit；非平台管理员只能看到当前租户的记录
+// @Tags 权限管理
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query uint false "用户ID"
+// @Param allowed query bool false "是否允许"
+// @Param path query string false "请求路径前缀"
+// @Param since query string false "开始时间（RFC3339）"
+// @Param until query string false "结束时间（RFC3339）"
+// @Param page query int false "页码，默认为1"
+// @Param page_size query int false "每页数量，默认为10"
+// @Success 200 {object} utils.Response{data=[]service.AuthzDecisions,total=int64} "查询成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的查询条件"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /rbac/decisions [get]
+func ListDecisions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	q, err := decisionQuery(c)
+	if err != nil {
+		utils.Error(c, 400, "无效的查询条件")
+		return
+	}
+
+	list, total, err := service.ListDecisions(rbacOperator(c), q, page, pageSize)
+	if err != nil {
+		middleware.Logger.Error("查询鉴权审计记录失败", zap.Error(err))
+		utils.Error(c, 500, "查询鉴权审计记录失败")
+		return
+	}
+
+	utils.SuccessWithPage(c, list, total, page, pageSize)
+}
+
+// ExplainDecision 解释鉴权结果
+// @Summary 解释鉴权结果
+// @Description 使用当前生效的策略判断用户能否访问指定接口，返回命中的策略、用户的角色、路径匹配的策略和说明，用于排查“没有权限”的问题；不检查 API Key 的权限范围
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.ExplainRequests true "用户和请求"
+// @Success 200 {object} utils.Response{data=service.ExplainResults} "检查结果"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 404 {object} utils.Response{data=string} "用户不存在，或不是平台管理员时用户属于其他租户"
+// @Failure 500 {object} utils.Response{data=string} "检查失败"
+// @Router /rbac/explain [post]
+func ExplainDecision(c *gin.Context) {
+	var req service.ExplainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	result, err := service.ExplainDecision(rbacOperator(c), &req)
+	switch {
+	case errors.Is(err, service.ErrRBACDomainForbidden):
+		utils.Error(c, 403, err.Error())
+		return
+	case errors.Is(err, service.ErrUserNotFound):
+		utils.Error(c, 404, err.Error())
+		return
+	case err != nil:
+		middleware.Logger.Error("解释鉴权结果失败", zap.Error(err))
+		utils.Error(c, 500, "解释鉴权结果失败")
+		return
+	}
+
+	utils.Success(c, result)
+}
+
+// ListRoutes 查询权限目录
+// @Summary 查询权限目录
+// @Description 返回所有已注册的接口及其说明，path 和 method 可以直接作为策略的 obj 和 act；protected 为 false 的接口不经过权限策略检查
+// @Tags 权限管理
+// @Produce json
+// @Security BearerAuth
+// @Param tag query string false "接口分组"
+// @Param protected query bool false "是否需要权限策略"
+// @Success 200 {object} utils.Response{data=[]service.RouteEntries} "查询成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的查询条件"
+// @Router /rbac/routes [get]
+func ListRoutes(c *gin.Context) {
+	q := service.RouteCatalogueQuery{Tag: c.Query("tag")}
+	if v := c.Query("protected"); v != "" {
+		protected, err := strconv.ParseBool(v)
+		if err != nil {
+			utils.Error(c, 400, "无效的查询条件")
+			return
+		}
+		q.Protected = &protected
+	}
+
+	utils.Success(c, service.ListRouteCatalogue(q))
+}
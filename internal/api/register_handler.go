@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Register 自助注册
+// @Summary 自助注册
+// @Description 创建待激活的用户并发送邮箱验证邮件，验证邮箱后才能登录；需要在配置中开启 register.enabled
+// @Tags 注册与找回密码
+// @Accept json
+// @Produce json
+// @Param request body service.RegisterRequests true "注册请求参数"
+// @Success 200 {object} utils.Response{data=string} "注册成功，请查收验证邮件"
+// @Failure 400 {object} utils.Response{data=[]service.PasswordViolation} "无效的请求参数、验证码错误或密码不符合策略"
+// @Failure 403 {object} utils.Response{data=string} "未开放注册"
+// @Failure 409 {object} utils.Response{data=string} "用户名或邮箱已被使用"
+// @Failure 500 {object} utils.Response{data=string} "注册失败"
+// @Router /register [post]
+func Register(c *gin.Context) {
+	var req service.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger.Warn("注册：无效的请求参数", zap.Error(err))
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	err := service.Register(&req, clientInfo(c))
+	if passwordPolicyFailed(c, err) {
+		return
+	}
+	switch {
+	case err == nil:
+		utils.Success(c, "注册成功，请查收验证邮件")
+	case errors.Is(err, service.ErrRegistrationDisabled):
+		utils.Error(c, 403, err.Error())
+	case errors.Is(err, service.ErrUsernameTaken), errors.Is(err, service.ErrEmailTaken):
+		utils.Error(c, 409, err.Error())
+	case errors.Is(err, service.ErrCaptchaRequired), errors.Is(err, service.ErrCaptchaInvalid):
+		utils.ErrorWithData(c, 400, err.Error(), gin.H{"captcha_required": true})
+	default:
+		middleware.Logger.Error("注册失败", zap.String("username", req.Username), zap.Error(err))
+		utils.Error(c, 500, "注册失败")
+	}
+}
+
+// VerifyEmail 验证邮箱
+// @Summary 验证邮箱
+// @Description 打开验证邮件中的链接激活账号
+// @Tags 注册与找回密码
+// @Produce json
+// @Param token query string true "验证令牌"
+// @Success 200 {object} utils.Response{data=string} "邮箱验证成功"
+// @Failure 400 {object} utils.Response{data=string} "验证链接无效或已过期"
+// @Failure 500 {object} utils.Response{data=string} "邮箱验证失败"
+// @Router /register/verify [get]
+func VerifyEmail(c *gin.Context) {
+	err := service.VerifyEmail(c.Query("token"))
+	if errors.Is(err, service.ErrInvalidVerifyToken) {
+		utils.Error(c, 400, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("邮箱验证失败", zap.Error(err))
+		utils.Error(c, 500, "邮箱验证失败")
+		return
+	}
+
+	utils.Success(c, "邮箱验证成功")
+}
+
+// ResendVerification 重新发送验证邮件
+// @Summary 重新发送验证邮件
+// @Description 邮箱不存在或已激活时同样返回成功；同一邮箱每分钟最多发送一封
+// @Tags 注册与找回密码
+// @Accept json
+// @Produce json
+// @Param request body service.EmailRequests true "邮箱"
+// @Success 200 {object} utils.Response{data=string} "如果邮箱已注册且未激活，验证邮件已发送"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 403 {object} utils.Response{data=string} "未开放注册"
+// @Failure 500 {object} utils.Response{data=string} "发送失败"
+// @Router /register/resend [post]
+func ResendVerification(c *gin.Context) {
+	var req service.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	err := service.ResendVerification(req.Email)
+	if errors.Is(err, service.ErrRegistrationDisabled) {
+		utils.Error(c, 403, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("重新发送验证邮件失败", zap.Error(err))
+		utils.Error(c, 500, "发送失败")
+		return
+	}
+
+	utils.Success(c, "如果邮箱已注册且未激活，验证邮件已发送")
+}
+
+// ForgotPassword 找回密码
+// @Summary 找回密码
+// @Description 向邮箱发送一次性的重置密码链接；邮箱不存在时同样返回成功，同一邮箱每分钟最多发送一封
+// @Tags 注册与找回密码
+// @Accept json
+// @Produce json
+// @Param request body service.EmailRequests true "邮箱"
+// @Success 200 {object} utils.Response{data=string} "如果邮箱已注册，重置密码邮件已发送"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 500 {object} utils.Response{data=string} "发送失败"
+// @Router /password/forgot [post]
+func ForgotPassword(c *gin.Context) {
+	var req service.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	if err := service.ForgotPassword(req.Email); err != nil {
+		middleware.Logger.Error("发送重置密码邮件失败", zap.Error(err))
+		utils.Error(c, 500, "发送失败")
+		return
+	}
+
+	utils.Success(c, "如果邮箱已注册，重置密码邮件已发送")
+}
+
+// ResetPassword 重置密码
+// @Summary 重置密码
+// @Description 使用重置密码邮件中的令牌设置新密码，令牌只能使用一次；成功后所有设备需要重新登录
+// @Tags 注册与找回密码
+// @Accept json
+// @Produce json
+// @Param request body service.ResetPasswordRequests true "重置密码请求参数"
+// @Success 200 {object} utils.Response{data=string} "密码已重置"
+// @Failure 400 {object} utils.Response{data=[]service.PasswordViolation} "链接无效或已过期，或新密码不符合策略"
+// @Failure 500 {object} utils.Response{data=string} "重置密码失败"
+// @Router /password/reset [post]
+func ResetPassword(c *gin.Context) {
+	var req service.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	err := service.ResetPassword(&req)
+	if passwordPolicyFailed(c, err) {
+		return
+	}
+	if errors.Is(err, service.ErrInvalidResetToken) {
+		utils.Error(c, 400, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("重置密码失败", zap.Error(err))
+		utils.Error(c, 500, "重置密码失败")
+		return
+	}
+
+	utils.Success(c, "密码已重置")
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// roleFailed 角色不存在时返回 404，参数无效时返回 400，没有权限时返回 403，角色已存在、仍在使用或修改后操作者将失去权限时返回 409
+func roleFailed(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound):
+		utils.Error(c, 404, err.Error())
+	case errors.Is(err, service.ErrInvalidRole):
+		utils.Error(c, 400, err.Error())
+	case errors.Is(err, service.ErrRBACDomainForbidden):
+		utils.Error(c, 403, err.Error())
+	case errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrRoleInUse), errors.Is(err, service.ErrRBACLockout):
+		utils.Error(c, 409, err.Error())
+	default:
+		middleware.Logger.Error(msg, zap.Error(err))
+		utils.Error(c, 500, msg)
+	}
+}
+
+// ListRoleDefinitions 查询角色
+// @Summary 查询角色
+// @Description 查询全部角色，按排序返回；分配给用户、设置菜单和数据权限时只能使用这里的角色
+// @Tags 角色管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=[]service.RoleResponses} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /roles [get]
+func ListRoleDefinitions(c *gin.Context) {
+	roles, err := service.ListRoleDefinitions()
+	if err != nil {
+		middleware.Logger.Error("查询角色失败", zap.Error(err))
+		utils.Error(c, 500, "查询角色失败")
+		return
+	}
+
+	utils.Success(c, roles)
+}
+
+// CreateRole 创建角色
+// @Summary 创建角色
+// @Description 创建角色，只有平台管理员可以操作；code 为 Casbin 策略中的角色名，创建后不能修改
+// @Tags 角色管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.CreateRoleRequests true "角色"
+// @Success 200 {object} utils.Response{data=service.RoleResponses} "创建成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的角色"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 409 {object} utils.Response{data=string} "角色已存在"
+// @Failure 500 {object} utils.Response{data=string} "创建失败"
+// @Router /roles [post]
+func CreateRole(c *gin.Context) {
+	var req service.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	role, err := service.CreateRole(rbacOperator(c), &req)
+	if err != nil {
+		roleFailed(c, err, "创建角色失败")
+		return
+	}
+
+	utils.Success(c, role)
+}
+
+// UpdateRole 修改角色
+// @Summary 修改角色
+// @Description 修改角色的名称、说明、状态和排序，只有平台管理员可以操作；禁用后移除引用该角色的全部 g 策略（包括其他租户的授权和角色继承），该角色不再授予任何权限，启用后恢复
+// @Tags 角色管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code path string true "角色"
+// @Param request body service.UpdateRoleRequests true "角色"
+// @Success 200 {object} utils.Response{data=string} "修改成功"
+// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 404 {object} utils.Response{data=string} "角色不存在"
+// @Failure 409 {object} utils.Response{data=string} "修改后将失去管理权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "修改失败"
+// @Router /roles/{code} [put]
+func UpdateRole(c *gin.Context) {
+	var req service.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	if err := service.UpdateRole(rbacOperator(c), c.Param("code"), &req); err != nil {
+		roleFailed(c, err, "修改角色失败")
+		return
+	}
+
+	utils.Success(c, "修改成功")
+}
+
+// DeleteRole 删除角色
+// @Summary 删除角色
+// @Description 删除没有分配给用户的角色，只有平台管理员可以操作；同时删除该角色在所有租户内的 p 策略、g 策略、菜单、数据权限和两步验证策略
+// @Tags 角色管理
+// @Produce json
+// @Security BearerAuth
+// @Param code path string true "角色"
+// @Success 200 {object} utils.Response{data=string} "删除成功"
+// @Failure 403 {object} utils.Response{data=string} "没有管理该租户权限策略的权限"
+// @Failure 404 {object} utils.Response{data=string} "角色不存在"
+// @Failure 409 {object} utils.Response{data=string} "角色已分配给用户，或删除后将失去管理权限策略的权限"
+// @Failure 500 {object} utils.Response{data=string} "删除失败"
+// @Router /roles/{code} [delete]
+func DeleteRole(c *gin.Context) {
+	if err := service.DeleteRole(rbacOperator(c), c.Param("code")); err != nil {
+		roleFailed(c, err, "删除角色失败")
+		return
+	}
+
+	utils.Success(c, "删除成功")
+}
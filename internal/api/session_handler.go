@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"fastgin/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ListMySessions 查询我的登录会话
+// @Summary 查询我的登录会话
+// @Description 查询当前用户所有有效的登录会话，current 标记发起本次请求的会话
+// @Tags 会话管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=[]service.SessionResponses} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /me/sessions [get]
+func ListMySessions(c *gin.Context) {
+	listSessions(c, c.GetUint("userID"), c.GetString("sessionID"))
+}
+
+// RevokeMySession 终止我的登录会话
+// @Summary 终止我的登录会话
+// @Description 终止当前用户的指定会话，该会话的访问令牌和刷新令牌立即失效
+// @Tags 会话管理
+// @Produce json
+// @Security BearerAuth
+// @Param sessionId path string true "会话ID"
+// @Success 200 {object} utils.Response{data=string} "终止成功"
+// @Failure 404 {object} utils.Response{data=string} "会话不存在或已终止"
+// @Failure 500 {object} utils.Response{data=string} "终止失败"
+// @Router /me/sessions/{sessionId} [delete]
+func RevokeMySession(c *gin.Context) {
+	revokeSession(c, c.GetUint("userID"), c.Param("sessionId"))
+}
+
+// RevokeOtherSessions 终止其他会话
+// @Summary 终止其他会话
+// @Description 终止当前用户除本次请求所用会话以外的所有会话
+// @Tags 会话管理
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.Response{data=string} "终止成功"
+// @Failure 500 {object} utils.Response{data=string} "终止失败"
+// @Router /me/sessions/others [delete]
+func RevokeOtherSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if err := service.RevokeOtherSessions(userID, c.GetString("sessionID")); err != nil {
+		middleware.Logger.Error("终止其他会话失败", zap.Uint("userID", userID), zap.Error(err))
+		utils.Error(c, 500, "终止其他会话失败")
+		return
+	}
+
+	utils.Success(c, "终止成功")
+}
+
+// ListOnlineSessions 在线用户
+// @Summary 在线用户
+// @Description 分页查询当前用户数据权限范围内所有用户当前有效的登录会话
+// @Tags 会话管理
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "页码，默认为1"
+// @Param page_size query int false "每页数量，默认为10"
+// @Success 200 {object} utils.Response{data=[]service.SessionResponses,total=int64} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /sessions [get]
+func ListOnlineSessions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	scope, ok := requestDataScope(c)
+	if !ok {
+		return
+	}
+	sessions, total, err := service.ListOnlineSessions(scope, page, pageSize)
+	if err != nil {
+		middleware.Logger.Error("查询在线用户失败", zap.Error(err))
+		utils.Error(c, 500, "查询在线用户失败")
+		return
+	}
+
+	utils.SuccessWithPage(c, sessions, total, page, pageSize)
+}
+
+// ListUserSessions 查询用户的登录会话
+// @Summary 查询用户的登录会话
+// @Description 管理员查询指定用户所有有效的登录会话
+// @Tags 会话管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "用户ID"
+// @Success 200 {object} utils.Response{data=[]service.SessionResponses} "查询成功"
+// @Failure 500 {object} utils.Response{data=string} "查询失败"
+// @Router /users/{id}/sessions [get]
+func ListUserSessions(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	listSessions(c, uint(userID), c.GetString("sessionID"))
+}
+
+// RevokeUserSession 终止用户的登录会话
+// @Summary 终止用户的登录会话
+// @Description 管理员强制下线指定用户的某个会话
+// @Tags 会话管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "用户ID"
+// @Param sessionId path string true "会话ID"
+// @Success 200 {object} utils.Response{data=string} "终止成功"
+// @Failure 404 {object} utils.Response{data=string} "会话不存在或已终止"
+// @Failure 500 {object} utils.Response{data=string} "终止失败"
+// @Router /users/{id}/sessions/{sessionId} [delete]
+func RevokeUserSession(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	revokeSession(c, uint(userID), c.Param("sessionId"))
+}
+
+// RevokeUserSessions 终止用户的所有会话
+// @Summary 终止用户的所有会话
+// @Description 管理员强制下线指定用户的所有会话，已签发的令牌全部失效
+// @Tags 会话管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "用户ID"
+// @Success 200 {object} utils.Response{data=string} "终止成功"
+// @Failure 500 {object} utils.Response{data=string} "终止失败"
+// @Router /users/{id}/sessions [delete]
+func RevokeUserSessions(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := service.RevokeUserTokens(uint(userID)); err != nil {
+		middleware.Logger.Error("终止用户所有会话失败", zap.Uint64("userID", userID), zap.Error(err))
+		utils.Error(c, 500, "终止用户所有会话失败")
+		return
+	}
+
+	middleware.Logger.Info("终止用户所有会话",
+		zap.Uint64("userID", userID),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "终止成功")
+}
+
+func listSessions(c *gin.Context, userID uint, currentSessionID string) {
+	sessions, err := service.ListSessions(userID, currentSessionID)
+	if err != nil {
+		middleware.Logger.Error("查询登录会话失败", zap.Error(err))
+		utils.Error(c, 500, "查询登录会话失败")
+		return
+	}
+
+	utils.Success(c, sessions)
+}
+
+func revokeSession(c *gin.Context, userID uint, sessionID string) {
+	err := service.RevokeSession(userID, sessionID)
+	if errors.Is(err, service.ErrSessionNotFound) {
+		utils.Error(c, 404, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("终止会话失败", zap.Error(err))
+		utils.Error(c, 500, "终止会话失败")
+		return
+	}
+
+	middleware.Logger.Info("终止会话",
+		zap.Uint("userID", userID),
+		zap.String("sessionID", sessionID),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "终止成功")
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fastgin/internal/middleware"
 	"fastgin/internal/service"
 	"fastgin/internal/utils"
@@ -18,8 +19,10 @@ import (
 // @Produce json
 // @Param request body service.LoginRequests true "登录请求参数"
 // @Success 200 {object} utils.Response{data=service.LoginResponses} "登录成功返回token信息"
-// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
-// @Failure 401 {object} utils.Response{data=string} "登录失败"
+// @Failure 400 {object} utils.Response{data=object} "无效的请求参数；需要验证码或验证码错误时 data.captcha_required 为 true"
+// @Failure 401 {object} utils.Response{data=string} "用户名或密码错误，之后需要验证码时 data.captcha_required 为 true"
+// @Failure 403 {object} utils.Response{data=string} "账号未激活，请先验证邮箱"
+// @Failure 429 {object} utils.Response{data=string} "登录失败次数过多，已临时锁定"
 // @Router /login [post]
 func Login(c *gin.Context) {
 	var req service.LoginRequest
@@ -30,11 +33,30 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	resp, err := service.Login(&req)
+	resp, err := service.Login(&req, clientInfo(c))
 	if err != nil {
 		middleware.Logger.Error("登录失败",
 			zap.String("username", req.Username),
 			zap.Error(err))
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+			utils.Error(c, 429, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrAccountNotActivated) {
+			utils.Error(c, 403, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrCaptchaRequired) || errors.Is(err, service.ErrCaptchaInvalid) {
+			utils.ErrorWithData(c, 400, err.Error(), gin.H{"captcha_required": true})
+			return
+		}
+		// 失败次数达到阈值后提示客户端下次登录需要验证码
+		if service.CaptchaRequired(req.Username, c.ClientIP()) {
+			utils.ErrorWithData(c, 401, err.Error(), gin.H{"captcha_required": true})
+			return
+		}
 		utils.Error(c, 401, err.Error())
 		return
 	}
@@ -44,6 +66,40 @@ func Login(c *gin.Context) {
 	utils.Success(c, resp)
 }
 
+// userDepartmentFailed 用户的部门不存在时返回 400，不在数据范围内时返回 403
+func userDepartmentFailed(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrDepartmentNotFound):
+		utils.Error(c, 400, err.Error())
+	case errors.Is(err, service.ErrDepartmentOutOfScope):
+		middleware.Logger.Warn("分配数据范围之外的部门",
+			zap.String("operator", c.GetString("username")))
+		utils.Error(c, 403, err.Error())
+	default:
+		return false
+	}
+	return true
+}
+
+// userRoleFailed 分配的角色不存在或已禁用时返回 400
+func userRoleFailed(c *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrRoleNotFound) && !errors.Is(err, service.ErrRoleDisabled) {
+		return false
+	}
+	utils.Error(c, 400, err.Error())
+	return true
+}
+
+// passwordPolicyFailed 密码不符合策略时返回 400 和未通过的规则列表
+func passwordPolicyFailed(c *gin.Context, err error) bool {
+	var policyErr *service.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	utils.ErrorWithData(c, 400, err.Error(), policyErr.Violations)
+	return true
+}
+
 // CreateUser 创建用户
 // @Summary 创建新用户
 // @Description 创建一个新的用户账号
@@ -52,7 +108,9 @@ func Login(c *gin.Context) {
 // @Produce json
 // @Param request body service.CreateUserRequests true "创建用户请求参数"
 // @Success 200 {object} utils.Response{data=string} "创建用户成功"
-// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 400 {object} utils.Response{data=[]service.PasswordViolation} "无效的请求参数、密码不符合策略，或角色不存在、已禁用"
+// @Failure 403 {object} utils.Response{data=string} "不能将用户分配到数据权限范围之外的部门"
+// @Failure 409 {object} utils.Response{data=string} "邮箱已被使用"
 // @Failure 500 {object} utils.Response{data=string} "创建用户失败"
 // @Router /users [post]
 func CreateUser(c *gin.Context) {
@@ -63,7 +121,25 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
-	err := service.CreateUser(&req)
+	scope, ok := requestDataScope(c)
+	if !ok {
+		return
+	}
+	err := service.CreateUser(scope, &req)
+	if passwordPolicyFailed(c, err) {
+		middleware.Logger.Warn("创建用户：密码不符合策略", zap.Error(err))
+		return
+	}
+	if userDepartmentFailed(c, err) {
+		return
+	}
+	if userRoleFailed(c, err) {
+		return
+	}
+	if errors.Is(err, service.ErrEmailTaken) {
+		utils.Error(c, 409, err.Error())
+		return
+	}
 	if err != nil {
 		middleware.Logger.Error("创建用户失败", zap.Error(err))
 		utils.Error(c, 500, err.Error())
@@ -73,6 +149,61 @@ func CreateUser(c *gin.Context) {
 	utils.Success(c, "创建用户成功")
 }
 
+// dataScopeKey 当前请求的数据范围在 gin.Context 中的键
+const dataScopeKey = "dataScope"
+
+// requestDataScope 返回当前用户在当前租户内的数据范围，同一请求只计算一次；计算失败时返回 500 并中止请求
+func requestDataScope(c *gin.Context) (*service.DataScope, bool) {
+	if scope, ok := c.Get(dataScopeKey); ok {
+		return scope.(*service.DataScope), true
+	}
+	scope, err := service.ResolveDataScope(c.GetUint("tenantID"), c.GetUint("userID"))
+	if err != nil {
+		middleware.Logger.Error("查询数据权限失败", zap.Error(err))
+		utils.Error(c, 500, "查询数据权限失败")
+		c.Abort()
+		return nil, false
+	}
+	c.Set(dataScopeKey, scope)
+	return scope, true
+}
+
+// UserScopeGuard 路径中的用户必须属于当前租户并且在数据范围内，否则按用户不存在处理，避免越权管理用户
+func UserScopeGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope, ok := requestDataScope(c)
+		if !ok {
+			return
+		}
+		param := c.Param("id")
+		if param == "" {
+			c.Next()
+			return
+		}
+		userID, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			utils.Error(c, 400, "无效的用户ID")
+			c.Abort()
+			return
+		}
+		if _, err := service.GetUser(scope, uint(userID)); err != nil {
+			if errors.Is(err, service.ErrUserNotFound) {
+				middleware.Logger.Warn("访问数据范围之外的用户",
+					zap.Uint("tenantID", c.GetUint("tenantID")),
+					zap.Uint64("targetID", userID),
+					zap.String("username", c.GetString("username")))
+				utils.Error(c, 404, err.Error())
+			} else {
+				middleware.Logger.Error("查询用户失败", zap.Error(err))
+				utils.Error(c, 500, "查询用户失败")
+			}
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // UpdateUser 更新用户信息
 // @Summary 更新用户信息
 // @Description 更新指定用户的信息
@@ -82,7 +213,10 @@ func CreateUser(c *gin.Context) {
 // @Param id path uint true "用户ID"
 // @Param request body service.UpdateUserRequests true "更新用户请求参数"
 // @Success 200 {object} utils.Response{data=string} "更新用户成功"
-// @Failure 400 {object} utils.Response{data=string} "无效的请求参数"
+// @Failure 400 {object} utils.Response{data=[]service.PasswordViolation} "无效的请求参数、密码不符合策略，或角色不存在、已禁用"
+// @Failure 403 {object} utils.Response{data=string} "不能将用户分配到数据权限范围之外的部门，或修改自己的角色、部门和密码"
+// @Failure 404 {object} utils.Response{data=string} "用户不存在"
+// @Failure 409 {object} utils.Response{data=string} "邮箱已被使用"
 // @Failure 500 {object} utils.Response{data=string} "更新用户失败"
 // @Router /users/{id} [put]
 func UpdateUser(c *gin.Context) {
@@ -94,7 +228,33 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
-	err := service.UpdateUser(uint(userID), &req)
+	scope, ok := requestDataScope(c)
+	if !ok {
+		return
+	}
+	err := service.UpdateUser(scope, uint(userID), &req)
+	if passwordPolicyFailed(c, err) {
+		middleware.Logger.Warn("更新用户：密码不符合策略", zap.Error(err))
+		return
+	}
+	if errors.Is(err, service.ErrUpdateSelfRestricted) {
+		utils.Error(c, 403, err.Error())
+		return
+	}
+	if userDepartmentFailed(c, err) {
+		return
+	}
+	if userRoleFailed(c, err) {
+		return
+	}
+	if errors.Is(err, service.ErrUserNotFound) {
+		utils.Error(c, 404, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrEmailTaken) {
+		utils.Error(c, 409, err.Error())
+		return
+	}
 	if err != nil {
 		middleware.Logger.Error("更新用户失败", zap.Error(err))
 		utils.Error(c, 500, err.Error())
@@ -104,6 +264,46 @@ func UpdateUser(c *gin.Context) {
 	utils.Success(c, "更新用户成功")
 }
 
+// ChangePassword 修改密码
+// @Summary 修改密码
+// @Description 校验原密码后修改当前用户的密码，新密码需符合密码策略；成功后其他会话全部失效，返回新的令牌
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.ChangePasswordRequests true "修改密码请求参数"
+// @Success 200 {object} utils.Response{data=service.LoginResponses} "修改成功返回新的token信息"
+// @Failure 400 {object} utils.Response{data=[]service.PasswordViolation} "原密码错误或新密码不符合策略"
+// @Failure 500 {object} utils.Response{data=string} "修改密码失败"
+// @Router /me/password [put]
+func ChangePassword(c *gin.Context) {
+	var req service.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger.Warn("修改密码：无效的请求参数", zap.Error(err))
+		utils.Error(c, 400, "无效的请求参数")
+		return
+	}
+
+	resp, err := service.ChangePassword(c.GetUint("userID"), &req, clientInfo(c))
+	if passwordPolicyFailed(c, err) {
+		middleware.Logger.Warn("修改密码：密码不符合策略", zap.Error(err))
+		return
+	}
+	if errors.Is(err, service.ErrOldPasswordIncorrect) {
+		middleware.Logger.Warn("修改密码：原密码错误",
+			zap.String("username", c.GetString("username")))
+		utils.Error(c, 400, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger.Error("修改密码失败", zap.Error(err))
+		utils.Error(c, 500, "修改密码失败")
+		return
+	}
+
+	utils.Success(c, resp)
+}
+
 // DeleteUser 删除用户
 // @Summary 删除用户
 // @Description 删除指定的用户
@@ -112,11 +312,20 @@ func UpdateUser(c *gin.Context) {
 // @Produce json
 // @Param id path uint true "用户ID"
 // @Success 200 {object} utils.Response{data=string} "删除用户成功"
+// @Failure 404 {object} utils.Response{data=string} "用户不存在"
 // @Failure 500 {object} utils.Response{data=string} "删除用户失败"
 // @Router /users/{id} [delete]
 func DeleteUser(c *gin.Context) {
 	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
-	err := service.DeleteUser(uint(userID))
+	scope, ok := requestDataScope(c)
+	if !ok {
+		return
+	}
+	err := service.DeleteUser(scope, uint(userID))
+	if errors.Is(err, service.ErrUserNotFound) {
+		utils.Error(c, 404, err.Error())
+		return
+	}
 	if err != nil {
 		middleware.Logger.Error("删除用户失败", zap.Error(err))
 		utils.Error(c, 500, err.Error())
@@ -134,11 +343,20 @@ func DeleteUser(c *gin.Context) {
 // @Produce json
 // @Param id path uint true "用户ID"
 // @Success 200 {object} utils.Response{data=service.UserInfo} "获取用户信息成功"
+// @Failure 404 {object} utils.Response{data=string} "用户不存在"
 // @Failure 500 {object} utils.Response{data=string} "获取用户信息失败"
 // @Router /users/{id} [get]
 func GetUser(c *gin.Context) {
 	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
-	user, err := service.GetUser(uint(userID))
+	scope, ok := requestDataScope(c)
+	if !ok {
+		return
+	}
+	user, err := service.GetUser(scope, uint(userID))
+	if errors.Is(err, service.ErrUserNotFound) {
+		utils.Error(c, 404, err.Error())
+		return
+	}
 	if err != nil {
 		middleware.Logger.Error("获取用户信息失败", zap.Error(err))
 		utils.Error(c, 500, err.Error())
@@ -150,7 +368,7 @@ func GetUser(c *gin.Context) {
 
 // ListUsers 获取用户列表
 // @Summary 获取用户列表
-// @Description 分页获取用户列表
+// @Description 分页获取当前用户数据权限范围内的用户
 // @Tags 用户管理
 // @Accept json
 // @Produce json
@@ -163,7 +381,11 @@ func ListUsers(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
 
-	users, total, err := service.ListUsers(page, pageSize)
+	scope, ok := requestDataScope(c)
+	if !ok {
+		return
+	}
+	users, total, err := service.ListUsers(scope, page, pageSize)
 	if err != nil {
 		middleware.Logger.Error("获取用户列表失败", zap.Error(err))
 		utils.Error(c, 500, err.Error())
@@ -172,3 +394,82 @@ func ListUsers(c *gin.Context) {
 
 	utils.SuccessWithPage(c, users, total, page, pageSize)
 }
+
+// ImpersonateUser 模拟登录
+// @Summary 模拟登录
+// @Description 以指定用户的身份签发15分钟有效的访问令牌（不含刷新令牌），用于复现用户看到的内容。令牌的 act 声明记录实际操作的管理员，期间的所有操作都会记录双方身份；不能模拟登录在任一租户内拥有管理员角色（包括继承的角色）或权限超过自己的用户，模拟登录期间不能修改密码、两步验证、API Key 和会话
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "用户ID"
+// @Param request body service.ImpersonateRequests false "模拟登录原因"
+// @Success 200 {object} utils.Response{data=service.LoginResponses} "返回目标用户的访问令牌"
+// @Failure 400 {object} utils.Response{data=string} "不能模拟登录该用户"
+// @Failure 404 {object} utils.Response{data=string} "用户不存在"
+// @Failure 500 {object} utils.Response{data=string} "模拟登录失败"
+// @Router /users/{id}/impersonate [post]
+func ImpersonateUser(c *gin.Context) {
+	var req service.ImpersonateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.Error(c, 400, "无效的请求参数")
+			return
+		}
+	}
+
+	if _, ok := c.Get("actorID"); ok {
+		utils.Error(c, 400, service.ErrNestedImpersonate.Error())
+		return
+	}
+	if _, ok := c.Get("apiKeyID"); ok {
+		utils.Error(c, 403, "不能使用API Key模拟登录")
+		return
+	}
+
+	targetID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	actor := middleware.ActorClaims{
+		UserID:   c.GetUint("userID"),
+		Username: c.GetString("username"),
+	}
+	resp, err := service.Impersonate(actor, uint(targetID), &req, clientInfo(c))
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		utils.Error(c, 404, err.Error())
+	case errors.Is(err, service.ErrImpersonateSelf), errors.Is(err, service.ErrImpersonateAdmin), errors.Is(err, service.ErrImpersonatePrivileged):
+		utils.Error(c, 400, err.Error())
+	case err != nil:
+		middleware.Logger.Error("模拟登录失败", zap.Error(err))
+		utils.Error(c, 500, "模拟登录失败")
+	default:
+		utils.Success(c, resp)
+	}
+}
+
+// UnlockUser 解除登录锁定
+// @Summary 解除登录锁定
+// @Description 清除指定用户的登录失败计数，解除临时锁定
+// @Tags 用户管理
+// @Produce json
+// @Security BearerAuth
+// @Param id path uint true "用户ID"
+// @Success 200 {object} utils.Response{data=string} "解除锁定成功"
+// @Failure 500 {object} utils.Response{data=string} "解除锁定失败"
+// @Router /users/{id}/unlock [post]
+func UnlockUser(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	scope, ok := requestDataScope(c)
+	if !ok {
+		return
+	}
+	if err := service.UnlockUser(scope, uint(userID)); err != nil {
+		middleware.Logger.Error("解除登录锁定失败", zap.Error(err))
+		utils.Error(c, 500, err.Error())
+		return
+	}
+
+	middleware.Logger.Info("解除登录锁定",
+		zap.Uint64("userID", userID),
+		zap.String("operator", c.GetString("username")))
+	utils.Success(c, "解除锁定成功")
+}
@@ -0,0 +1,367 @@
+package idp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// oidcDiscovery OpenID Connect 发现文档中用到的字段
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider 基于 OpenID Connect 授权码流程（PKCE）的身份提供方
+type OIDCProvider struct {
+	conf   config.OIDCProviderConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{}
+	keysAt    time.Time
+}
+
+func NewOIDCProvider(conf config.OIDCProviderConfig) *OIDCProvider {
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = []string{"openid", "profile", "email"}
+	}
+	if conf.UsernameClaim == "" {
+		conf.UsernameClaim = "preferred_username"
+	}
+	if conf.GroupsClaim == "" {
+		conf.GroupsClaim = "groups"
+	}
+	if conf.DefaultRole == "" {
+		conf.DefaultRole = "user"
+	}
+	return &OIDCProvider{
+		conf:   conf,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.conf.Name
+}
+
+func (p *OIDCProvider) LinkByUsername() bool {
+	return p.conf.LinkByUsername
+}
+
+func (p *OIDCProvider) SyncRoles() bool {
+	return p.conf.SyncRoles
+}
+
+func (p *OIDCProvider) MapRole(groups []string) string {
+	for _, m := range p.conf.RoleMappings {
+		for _, g := range groups {
+			if g == m.Group {
+				return m.Role
+			}
+		}
+	}
+	return p.conf.DefaultRole
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.conf.ClientID)
+	q.Set("redirect_uri", p.conf.RedirectURL)
+	q.Set("scope", strings.Join(p.conf.Scopes, " "))
+	q.Set("state", req.State)
+	q.Set("nonce", req.Nonce)
+	q.Set("code_challenge", req.CodeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.conf.RedirectURL)
+	form.Set("client_id", p.conf.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.conf.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.conf.ClientID), url.QueryEscape(p.conf.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("解析令牌响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResp.Error != "" {
+		return nil, fmt.Errorf("授权码换取令牌失败: %s %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, errors.New("令牌响应缺少id_token")
+	}
+
+	claims, err := p.verifyIDToken(ctx, d, tokenResp.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider: p.conf.Name,
+		Subject:  claimString(claims, "sub"),
+		Username: claimString(claims, p.conf.UsernameClaim),
+		Email:    claimString(claims, "email"),
+		// 部分提供方将 email_verified 写成字符串
+		EmailVerified: claims["email_verified"] == true || claims["email_verified"] == "true",
+		Groups:        claimStrings(claims, p.conf.GroupsClaim),
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("id_token缺少sub声明")
+	}
+	return identity, nil
+}
+
+// verifyIDToken 校验 ID Token 的签名、issuer、audience、过期时间和 nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, d *oidcDiscovery, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, d, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.conf.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("id_token校验失败: %w", err)
+	}
+
+	if claimString(claims, "nonce") != nonce {
+		return nil, errors.New("id_token的nonce不匹配")
+	}
+	if azp := claimString(claims, "azp"); azp != "" && azp != p.conf.ClientID {
+		return nil, errors.New("id_token的azp不匹配")
+	}
+	return claims, nil
+}
+
+// getDiscovery 获取并缓存发现文档
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d oidcDiscovery
+	wellKnown := strings.TrimSuffix(p.conf.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &d); err != nil {
+		return nil, fmt.Errorf("获取OIDC发现文档失败: %w", err)
+	}
+	if d.Issuer != p.conf.Issuer {
+		return nil, fmt.Errorf("OIDC发现文档的issuer不匹配: %s", d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("OIDC发现文档不完整")
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// getKey 按 kid 查找提供方公钥，未找到时重新拉取 JWKS（最多每分钟一次）
+func (p *OIDCProvider) getKey(ctx context.Context, d *oidcDiscovery, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysAt) < time.Minute {
+		return nil, fmt.Errorf("未知的密钥: %s", kid)
+	}
+
+	var set middleware.JSONWebKeySet
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("获取JWKS失败: %w", err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err != nil {
+			middleware.Logger.Warn("忽略无法解析的JWK",
+				zap.String("provider", p.conf.Name),
+				zap.String("kid", jwk.Kid),
+				zap.Error(err))
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未知的密钥: %s", kid)
+}
+
+// lookupKey 查找公钥，令牌未携带 kid 且提供方只有一个密钥时直接使用该密钥
+func (p *OIDCProvider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求 %s 返回状态码 %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// parseJWK 将 JWK 转换为公钥
+func parseJWK(jwk middleware.JSONWebKey) (interface{}, error) {
+	dec := base64.RawURLEncoding
+	switch jwk.Kty {
+	case "RSA":
+		n, err := dec.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := dec.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线: %s", jwk.Crv)
+		}
+		x, err := dec.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := dec.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("不支持的曲线: %s", jwk.Crv)
+		}
+		x, err := dec.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("无效的Ed25519公钥")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型: %s", jwk.Kty)
+	}
+}
+
+func claimString(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// claimStrings 读取字符串数组声明，兼容单个字符串的写法
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
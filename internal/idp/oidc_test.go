@@ -0,0 +1,240 @@
+package idp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fastgin/config"
+	"fastgin/internal/idp/idptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func newTestProvider(t *testing.T) (*idptest.Server, *OIDCProvider) {
+	t.Helper()
+	s := idptest.NewServer("app", "secret")
+	t.Cleanup(s.Close)
+	p := NewOIDCProvider(config.OIDCProviderConfig{
+		Name:         "stub",
+		Issuer:       s.URL,
+		ClientID:     "app",
+		ClientSecret: "secret",
+		RedirectURL:  "http://app.test/api/oauth/stub/callback",
+	})
+	return s, p
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorize 发起授权并返回授权码
+func authorize(t *testing.T, s *idptest.Server, p *OIDCProvider, nonce string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), AuthRequest{
+		State:         "state-1",
+		Nonce:         nonce,
+		CodeChallenge: challenge(testVerifier),
+	})
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, state, err := s.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+	return code
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	s, p := newTestProvider(t)
+	authURL, err := p.AuthCodeURL(context.Background(), AuthRequest{State: "s", Nonce: "n", CodeChallenge: challenge(testVerifier)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, s.URL+"/authorize?") {
+		t.Errorf("authorization endpoint = %s", authURL)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "app",
+		"redirect_uri":          "http://app.test/api/oauth/stub/callback",
+		"scope":                 "openid profile email",
+		"state":                 "s",
+		"nonce":                 "n",
+		"code_challenge":        challenge(testVerifier),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	s, p := newTestProvider(t)
+	s.Claims = jwt.MapClaims{
+		"sub":                "u-1",
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"groups":             []string{"staff", "ops"},
+	}
+	code := authorize(t, s, p, "nonce-1")
+
+	identity, err := p.Exchange(context.Background(), code, testVerifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Provider != "stub" || identity.Subject != "u-1" || identity.Username != "alice" ||
+		identity.Email != "alice@example.com" || !identity.EmailVerified ||
+		!slices.Equal(identity.Groups, []string{"staff", "ops"}) {
+		t.Errorf("identity = %+v", identity)
+	}
+
+	// 授权码只能使用一次
+	if _, err := p.Exchange(context.Background(), code, testVerifier, "nonce-1"); err == nil {
+		t.Error("reused authorization code was accepted")
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	s, p := newTestProvider(t)
+	s.Claims = jwt.MapClaims{"sub": "u-1"}
+	code := authorize(t, s, p, "nonce-1")
+
+	if _, err := p.Exchange(context.Background(), code, testVerifier+"x", "nonce-1"); err == nil {
+		t.Fatal("exchange with a wrong PKCE verifier succeeded")
+	}
+}
+
+func TestOIDCEmailVerifiedString(t *testing.T) {
+	for _, tc := range []struct {
+		value interface{}
+		want  bool
+	}{
+		{true, true},
+		{"true", true},
+		{false, false},
+		{"false", false},
+		{nil, false},
+	} {
+		s, p := newTestProvider(t)
+		s.Claims = jwt.MapClaims{"sub": "u-1", "email": "a@example.com", "email_verified": tc.value}
+		code := authorize(t, s, p, "n")
+		identity, err := p.Exchange(context.Background(), code, testVerifier, "n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.EmailVerified != tc.want {
+			t.Errorf("email_verified=%v: EmailVerified = %v, want %v", tc.value, identity.EmailVerified, tc.want)
+		}
+	}
+}
+
+func TestOIDCIDTokenValidation(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		key    *rsa.PrivateKey
+		nonce  string
+	}{
+		{name: "nonce mismatch", claims: jwt.MapClaims{"sub": "u-1"}, nonce: "other"},
+		{name: "missing nonce", claims: jwt.MapClaims{"sub": "u-1", "nonce": nil}},
+		{name: "wrong audience", claims: jwt.MapClaims{"sub": "u-1", "aud": "someone-else"}},
+		{name: "wrong issuer", claims: jwt.MapClaims{"sub": "u-1", "iss": "https://evil.example.com"}},
+		{name: "expired", claims: jwt.MapClaims{"sub": "u-1", "exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "missing exp", claims: jwt.MapClaims{"sub": "u-1", "exp": nil}},
+		{name: "azp mismatch", claims: jwt.MapClaims{"sub": "u-1", "azp": "someone-else"}},
+		{name: "missing sub", claims: jwt.MapClaims{}},
+		{name: "bad signature", claims: jwt.MapClaims{"sub": "u-1"}, key: otherKey},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, p := newTestProvider(t)
+			s.Claims = tc.claims
+			if tc.key != nil {
+				s.SigningKey = tc.key
+			}
+			code := authorize(t, s, p, "nonce-1")
+			nonce := tc.nonce
+			if nonce == "" {
+				nonce = "nonce-1"
+			}
+			if identity, err := p.Exchange(context.Background(), code, testVerifier, nonce); err == nil {
+				t.Fatalf("invalid id_token accepted: %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	t.Run("issuer mismatch", func(t *testing.T) {
+		s, p := newTestProvider(t)
+		s.Document["issuer"] = "https://evil.example.com"
+		if _, err := p.AuthCodeURL(context.Background(), AuthRequest{}); err == nil {
+			t.Fatal("discovery document with a different issuer accepted")
+		}
+	})
+	for _, field := range []string{"authorization_endpoint", "token_endpoint", "jwks_uri"} {
+		t.Run("missing "+field, func(t *testing.T) {
+			s, p := newTestProvider(t)
+			delete(s.Document, field)
+			if _, err := p.AuthCodeURL(context.Background(), AuthRequest{}); err == nil {
+				t.Fatal("incomplete discovery document accepted")
+			}
+		})
+	}
+	t.Run("not found", func(t *testing.T) {
+		s, _ := newTestProvider(t)
+		p := NewOIDCProvider(config.OIDCProviderConfig{Name: "stub", Issuer: s.URL + "/missing", ClientID: "app"})
+		if _, err := p.AuthCodeURL(context.Background(), AuthRequest{}); err == nil {
+			t.Fatal("missing discovery document accepted")
+		}
+	})
+}
+
+func TestOIDCMapRole(t *testing.T) {
+	p := NewOIDCProvider(config.OIDCProviderConfig{
+		Name: "stub",
+		RoleMappings: []config.OIDCRoleMapping{
+			{Group: "admins", Role: "admin"},
+			{Group: "ops", Role: "operator"},
+		},
+	})
+	for _, tc := range []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"ops", "admins"}, "admin"},
+		{[]string{"ops"}, "operator"},
+		{nil, "user"},
+	} {
+		if got := p.MapRole(tc.groups); got != tc.want {
+			t.Errorf("MapRole(%v) = %q, want %q", tc.groups, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fastgin/config"
+	"sync"
+)
+
+var ErrProviderNotFound = errors.New("身份提供方不存在")
+
+// Identity 外部身份提供方返回的用户身份
+type Identity struct {
+	Provider string
+	Subject  string
+	Username string
+	Email    string
+	// EmailVerified 提供方确认邮箱属于该用户（email_verified 声明）
+	EmailVerified bool
+	Groups        []string
+}
+
+// AuthRequest 发起授权时需要携带的一次性参数
+type AuthRequest struct {
+	State         string
+	Nonce         string
+	CodeChallenge string // PKCE S256 挑战码
+}
+
+// Provider 外部身份提供方
+type Provider interface {
+	// Name 提供方名称
+	Name() string
+	// AuthCodeURL 返回跳转到提供方登录页的地址
+	AuthCodeURL(ctx context.Context, req AuthRequest) (string, error)
+	// Exchange 使用授权码换取并校验用户身份
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+	// MapRole 根据用户组计算本地角色
+	MapRole(groups []string) string
+	// LinkByUsername 首次登录时是否关联同名本地用户
+	LinkByUsername() bool
+	// SyncRoles 每次登录是否按 MapRole 同步已有用户的角色
+	SyncRoles() bool
+}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Provider)
+)
+
+// Register 注册身份提供方，同名提供方会被替换
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[p.Name()] = p
+}
+
+// Get 按名称获取身份提供方
+func Get(name string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[name]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	return p, nil
+}
+
+// InitProviders 根据配置注册所有 OIDC 身份提供方
+func InitProviders(conf config.OAuthConfig) {
+	for _, pc := range conf.Providers {
+		Register(NewOIDCProvider(pc))
+	}
+}
@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"context"
+	"fastgin/internal/middleware"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LogMailer 只把邮件内容写入日志，用于开发环境
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	middleware.Logger.Info("发送邮件",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body))
+	return nil
+}
+
+// FileMailer 把邮件写入目录下的 .eml 文件，用于开发和测试环境
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{dir: dir}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), sanitizeFilename(msg.To))
+	return os.WriteFile(filepath.Join(m.dir, name), msg.Bytes(), 0o600)
+}
+
+// sanitizeFilename 只保留文件名中的安全字符
+func sanitizeFilename(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_' || c == '@') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fastgin/config"
+	"fmt"
+	"mime"
+	"time"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送器
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New 根据配置创建邮件发送器
+func New(conf config.MailConfig) Mailer {
+	switch conf.Driver {
+	case "smtp":
+		return NewSMTPMailer(conf)
+	case "file":
+		dir := conf.Dir
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFileMailer(dir)
+	default:
+		return NewLogMailer()
+	}
+}
+
+// Bytes 将邮件编码为 RFC 5322 格式，正文使用 UTF-8 和 base64 编码
+func (m *Message) Bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(m.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
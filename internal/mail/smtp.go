@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fastgin/config"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// smtpTimeout 连接和发送 SMTP 邮件的超时时间
+const smtpTimeout = 30 * time.Second
+
+// SMTPMailer 通过 SMTP 服务器发送邮件
+type SMTPMailer struct {
+	conf config.MailConfig
+}
+
+func NewSMTPMailer(conf config.MailConfig) *SMTPMailer {
+	return &SMTPMailer{conf: conf}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	addr := net.JoinHostPort(m.conf.Host, strconv.Itoa(m.conf.Port))
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	var err error
+	if m.conf.Port == 465 {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.conf.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(smtpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.conf.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.conf.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: m.conf.Host}); err != nil {
+				return err
+			}
+		}
+	}
+	if m.conf.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.conf.Username, m.conf.Password, m.conf.Host)); err != nil {
+			return err
+		}
+	}
+
+	// 发件人可以带显示名称，如 "FastGin <noreply@example.com>"，信封中只使用地址
+	from := msg.From
+	if addr, err := netmail.ParseAddress(msg.From); err == nil {
+		from = addr.Address
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"errors"
+	"fastgin/internal/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// captchaSweepInterval 清理过期验证码的最小间隔
+const captchaSweepInterval = time.Minute
+
+// CaptchaStore 验证码存储
+type CaptchaStore interface {
+	// Set 保存验证码答案
+	Set(id, answer string, expiresAt time.Time) error
+	// Take 取出并删除验证码答案，不存在或已过期时返回空字符串，保证每个验证码只能校验一次
+	Take(id string) (string, error)
+}
+
+// Captchas 全局验证码存储，默认使用内存实现
+var Captchas CaptchaStore = NewMemoryCaptchaStore()
+
+// InitCaptchaStore 根据配置初始化验证码存储
+func InitCaptchaStore(db *gorm.DB, driver string) {
+	switch driver {
+	case "db":
+		Captchas = NewDBCaptchaStore(db)
+	default:
+		Captchas = NewMemoryCaptchaStore()
+	}
+}
+
+type captchaEntry struct {
+	answer    string
+	expiresAt time.Time
+}
+
+// MemoryCaptchaStore 基于内存的验证码存储，仅适用于单实例部署
+type MemoryCaptchaStore struct {
+	mu        sync.Mutex
+	captchas  map[string]captchaEntry
+	lastSweep time.Time
+}
+
+func NewMemoryCaptchaStore() *MemoryCaptchaStore {
+	return &MemoryCaptchaStore{captchas: make(map[string]captchaEntry)}
+}
+
+func (s *MemoryCaptchaStore) Set(id, answer string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > captchaSweepInterval {
+		for key, entry := range s.captchas {
+			if now.After(entry.expiresAt) {
+				delete(s.captchas, key)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.captchas[id] = captchaEntry{answer: answer, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryCaptchaStore) Take(id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.captchas[id]
+	if !ok {
+		return "", nil
+	}
+	delete(s.captchas, id)
+	if time.Now().After(entry.expiresAt) {
+		return "", nil
+	}
+	return entry.answer, nil
+}
+
+// DBCaptchaStore 基于数据库的验证码存储，多实例部署时共享
+type DBCaptchaStore struct {
+	mu        sync.Mutex
+	db        *gorm.DB
+	lastSweep time.Time
+}
+
+func NewDBCaptchaStore(db *gorm.DB) *DBCaptchaStore {
+	return &DBCaptchaStore{db: db}
+}
+
+func (s *DBCaptchaStore) Set(id, answer string, expiresAt time.Time) error {
+	now := time.Now()
+	s.mu.Lock()
+	sweep := now.Sub(s.lastSweep) > captchaSweepInterval
+	if sweep {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+	if sweep {
+		if err := s.db.Where("expires_at < ?", now).Delete(&model.Captcha{}).Error; err != nil {
+			return err
+		}
+	}
+
+	return s.db.Create(&model.Captcha{
+		CaptchaID: id,
+		Answer:    answer,
+		ExpiresAt: expiresAt,
+	}).Error
+}
+
+func (s *DBCaptchaStore) Take(id string) (string, error) {
+	var captcha model.Captcha
+	err := s.db.Where("captcha_id = ?", id).First(&captcha).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	// 并发校验同一个验证码时只有删除成功的请求有效
+	result := s.db.Delete(&captcha)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(captcha.ExpiresAt) {
+		return "", nil
+	}
+	return captcha.Answer, nil
+}
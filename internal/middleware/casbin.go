@@ -1,73 +1,265 @@
 package middleware
 
 import (
+	"bufio"
+	"fastgin/config"
+	"fastgin/internal/model"
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/util"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
-func NewCasbinMiddleware(db *gorm.DB) (*casbin.Enforcer, error) {
+// TenantHeader 指定本次请求操作的租户，未指定时使用令牌中的租户
+// 用户需要在该租户内被分配了角色才能通过鉴权
+const TenantHeader = "X-Tenant-ID"
+
+// userSubjectPrefix 用户主体的前缀，角色名不能使用该前缀
+const userSubjectPrefix = "user:"
+
+// UserSubject 用户在 Casbin 中的主体，角色通过 g 策略分配给该主体
+func UserSubject(userID uint) string {
+	return userSubjectPrefix + strconv.FormatUint(uint64(userID), 10)
+}
+
+// IsUserSubject 判断主体是用户而不是角色
+func IsUserSubject(sub string) bool {
+	return strings.HasPrefix(sub, userSubjectPrefix)
+}
+
+// TenantDomain 租户在 Casbin 中的域
+func TenantDomain(tenantID uint) string {
+	return "tenant:" + strconv.FormatUint(uint64(tenantID), 10)
+}
+
+// NewCasbinMiddleware 创建 Casbin 执行器，策略可以在运行时通过管理接口修改，因此使用并发安全的 SyncedEnforcer
+func NewCasbinMiddleware(db *gorm.DB, conf config.CasbinConfig) (*casbin.SyncedEnforcer, error) {
 	adapter, err := gormadapter.NewAdapterByDB(db)
 	if err != nil {
 		return nil, err
 	}
 
-	enforcer, err := casbin.NewEnforcer("config/rbac_model.conf", adapter)
+	if err := migrateLegacyPolicies(db); err != nil {
+		return nil, err
+	}
+
+	modelFile := conf.Model
+	if modelFile == "" {
+		modelFile = "config/rbac_model.conf"
+	}
+	enforcer, err := casbin.NewSyncedEnforcer(modelFile, adapter)
 	if err != nil {
 		return nil, err
 	}
+	// 域为 * 的 g 策略在所有租户内生效，用于角色继承和跨租户的平台管理员
+	enforcer.AddNamedDomainMatchingFunc("g", "keyMatch", util.KeyMatch)
+	registerABACFunctions(enforcer)
 
 	err = enforcer.LoadPolicy()
 	if err != nil {
 		return nil, err
 	}
 
+	policyFile := conf.DefaultPolicy
+	if policyFile == "" {
+		policyFile = "config/rbac_policy.csv"
+	}
+	if err := seedDefaultPolicy(enforcer, policyFile); err != nil {
+		return nil, err
+	}
+
 	return enforcer, nil
 }
 
-func Authorize(e *casbin.Enforcer) gin.HandlerFunc {
+// migrateLegacyPolicies 将启用多租户前的策略转换为带域的格式：
+// p 策略对所有租户生效，用户的角色分配属于默认租户，角色继承在所有租户内生效
+func migrateLegacyPolicies(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 旧格式的 p 策略第二列是以 / 开头的路径，而域不会以 / 开头
+		err := tx.Exec("UPDATE casbin_rule SET v3 = v2, v2 = v1, v1 = ? WHERE ptype = ? AND v1 LIKE ? AND (v3 = '' OR v3 IS NULL)",
+			"*", "p", "/%").Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec("UPDATE casbin_rule SET v2 = ? WHERE ptype = ? AND v0 LIKE ? AND (v2 = '' OR v2 IS NULL)",
+			TenantDomain(model.DefaultTenantID), "g", "user:%").Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE casbin_rule SET v2 = ? WHERE ptype = ? AND (v2 = '' OR v2 IS NULL)",
+			"*", "g").Error
+	})
+}
+
+// seedDefaultPolicy 没有任何 p 策略时（首次启动）导入默认策略文件
+// 文件格式与 Casbin 的 CSV 策略文件相同，# 开头的行为注释
+func seedDefaultPolicy(e *casbin.SyncedEnforcer, file string) error {
+	policies, err := e.GetPolicy()
+	if err != nil {
+		return err
+	}
+	if len(policies) > 0 {
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			Logger.Warn("默认权限策略文件不存在，跳过导入", zap.String("file", file))
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	rules := make(map[string][][]string)
+	var order []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		ptype := fields[0]
+		if _, ok := rules[ptype]; !ok {
+			order = append(order, ptype)
+		}
+		rules[ptype] = append(rules[ptype], fields[1:])
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	count := 0
+	for _, ptype := range order {
+		var err error
+		if strings.HasPrefix(ptype, "g") {
+			_, err = e.AddNamedGroupingPolicies(ptype, rules[ptype])
+		} else {
+			_, err = e.AddNamedPolicies(ptype, rules[ptype])
+		}
+		if err != nil {
+			return err
+		}
+		count += len(rules[ptype])
+	}
+
+	Logger.Info("已导入默认权限策略",
+		zap.String("file", file),
+		zap.Int("count", count))
+	return nil
+}
+
+// Authorize 使用用户主体在租户域内执行 Casbin 鉴权，用户的角色和角色继承由 g 策略决定
+// 请求头 X-Tenant-ID 可以指定其他租户，通过鉴权后作为本次请求的租户
+// 模型的请求定义包含 ctx 时，同时传入调用者、路由参数、客户端 IP 和请求时间用于 ABAC 鉴权
+func Authorize(e *casbin.SyncedEnforcer) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role := c.GetString("role")
-		if role == "" {
-			Logger.Warn("未找到用户角色")
+		userID := c.GetUint("userID")
+		if userID == 0 {
+			Logger.Warn("未找到用户身份")
 			c.AbortWithStatusJSON(401, gin.H{"code": 401, "message": "未授权"})
 			return
 		}
 
+		tenantID := c.GetUint("tenantID")
+		if header := c.GetHeader(TenantHeader); header != "" {
+			id, err := strconv.ParseUint(header, 10, 32)
+			if err != nil || id == 0 {
+				c.AbortWithStatusJSON(400, gin.H{"code": 400, "message": "无效的租户"})
+				return
+			}
+			tenantID = uint(id)
+		}
+
+		sub := UserSubject(userID)
+		dom := TenantDomain(tenantID)
 		obj := c.Request.URL.Path
 		act := c.Request.Method
 
 		Logger.Debug("权限检查",
-			zap.String("role", role),
+			zap.String("sub", sub),
+			zap.String("dom", dom),
 			zap.String("path", obj),
 			zap.String("method", act))
 
-		ok, err := e.Enforce(role, obj, act)
+		// 启用审计时使用 EnforceEx 同时得到命中的策略
+		rctx := NewRequestContext(c, tenantID)
+		var ok bool
+		var matched []string
+		var err error
+		if auditEnabled() {
+			ok, matched, err = EnforceRequestEx(e, rctx, sub, dom, obj, act)
+		} else {
+			ok, err = EnforceRequest(e, rctx, sub, dom, obj, act)
+		}
 		if err != nil {
 			Logger.Error("权限检查错误",
 				zap.Error(err),
-				zap.String("role", role),
+				zap.String("sub", sub),
+				zap.String("dom", dom),
 				zap.String("path", obj),
 				zap.String("method", act))
 			c.AbortWithStatusJSON(500, gin.H{"code": 500, "message": "权限检查错误"})
 			return
 		}
 
+		reason := ""
 		if !ok {
-			Logger.Warn("权限不足",
-				zap.String("role", role),
+			reason = DenyReasonNoPolicy
+		}
+		// API Key 同时受所属用户角色和自身权限范围约束
+		if ok && !apiKeyScopesAllow(c, obj, act) {
+			Logger.Warn("超出API Key权限范围",
+				zap.Uint("apiKeyID", c.GetUint("apiKeyID")),
 				zap.String("path", obj),
 				zap.String("method", act))
+			ok = false
+			reason = DenyReasonAPIKeyScope
+		}
+
+		auditDecision(&model.AuthzDecision{
+			TenantID: tenantID,
+			UserID:   userID,
+			APIKeyID: c.GetUint("apiKeyID"),
+			Subject:  sub,
+			Domain:   dom,
+			Object:   obj,
+			Action:   act,
+			Allowed:  ok,
+			Reason:   reason,
+			IP:       rctx.IP,
+		}, matched)
+
+		if !ok {
+			Logger.Warn("权限不足",
+				zap.String("sub", sub),
+				zap.String("dom", dom),
+				zap.String("role", c.GetString("role")),
+				zap.String("path", obj),
+				zap.String("method", act),
+				zap.String("reason", reason))
 			c.AbortWithStatusJSON(403, gin.H{"code": 403, "message": "没有权限"})
 			return
 		}
 
 		Logger.Debug("权限检查通过",
-			zap.String("role", role),
+			zap.String("sub", sub),
+			zap.String("dom", dom),
 			zap.String("path", obj),
-			zap.String("method", act))
+			zap.String("method", act),
+			zap.Strings("policy", matched))
+		c.Set("tenantID", tenantID)
 		c.Next()
 	}
 }
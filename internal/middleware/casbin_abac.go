@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// requestContextToken 模型请求定义中请求上下文的参数名（r = sub, dom, obj, act, ctx）
+const requestContextToken = "r_ctx"
+
+var errInvalidABACArgs = errors.New("ABAC 函数参数错误")
+
+// RequestContext ABAC 鉴权的请求上下文。模型的请求定义包含 ctx 时作为 r.ctx 传给匹配器，
+// 匹配器可以直接访问字段（如 r.ctx.UserID、ipMatch(r.ctx.IP, "10.0.0.0/8")），或调用 registerABACFunctions 注册的函数
+type RequestContext struct {
+	// UserID 调用者，模拟登录时为被模拟的用户
+	UserID   uint
+	TenantID uint
+	// Params 路由参数，例如 /api/users/:id 中的 id
+	Params map[string]string
+	// IP 客户端 IP，只有请求来自 server.trustedProxies 中的代理时才读取 X-Forwarded-For，否则为连接的对端地址
+	IP   string
+	Time time.Time
+}
+
+// NewRequestContext 根据请求创建鉴权上下文
+func NewRequestContext(c *gin.Context, tenantID uint) *RequestContext {
+	params := make(map[string]string, len(c.Params))
+	for _, p := range c.Params {
+		params[p.Key] = p.Value
+	}
+	return &RequestContext{
+		UserID:   c.GetUint("userID"),
+		TenantID: tenantID,
+		Params:   params,
+		IP:       c.ClientIP(),
+		Time:     time.Now(),
+	}
+}
+
+// hasRequestContext 判断模型的请求定义是否包含请求上下文
+func hasRequestContext(e *casbin.SyncedEnforcer) bool {
+	ast, ok := e.GetModel()["r"]["r"]
+	if !ok {
+		return false
+	}
+	for _, token := range ast.Tokens {
+		if token == requestContextToken {
+			return true
+		}
+	}
+	return false
+}
+
+// requestValues 组装鉴权参数，模型需要请求上下文时追加 rctx，rctx 为 nil 时使用只包含当前时间的上下文
+func requestValues(e *casbin.SyncedEnforcer, rctx *RequestContext, sub, dom, obj, act string) []interface{} {
+	rvals := []interface{}{sub, dom, obj, act}
+	if hasRequestContext(e) {
+		if rctx == nil {
+			rctx = &RequestContext{Params: map[string]string{}, Time: time.Now()}
+		}
+		rvals = append(rvals, rctx)
+	}
+	return rvals
+}
+
+// EnforceRequest 执行鉴权，兼容请求定义包含和不包含 ctx 的模型，所有鉴权都应通过该函数
+func EnforceRequest(e *casbin.SyncedEnforcer, rctx *RequestContext, sub, dom, obj, act string) (bool, error) {
+	return e.Enforce(requestValues(e, rctx, sub, dom, obj, act)...)
+}
+
+// EnforceRequestEx 与 EnforceRequest 相同，同时返回命中的策略
+func EnforceRequestEx(e *casbin.SyncedEnforcer, rctx *RequestContext, sub, dom, obj, act string) (bool, []string, error) {
+	return e.EnforceEx(requestValues(e, rctx, sub, dom, obj, act)...)
+}
+
+// registerABACFunctions 注册匹配器中可以使用的 ABAC 函数：
+//   - isSelf(r.ctx, "id")：路由参数 id 是调用者自己的用户ID
+//   - param(r.ctx, "id")：路由参数的值
+//   - timeBetween(r.ctx, "09:00", "18:00")：请求时间（服务器时区）在时间段内，开始晚于结束时表示跨天
+//   - isWeekday(r.ctx)：请求时间是周一到周五
+func registerABACFunctions(e *casbin.SyncedEnforcer) {
+	e.AddFunction("isSelf", func(args ...interface{}) (interface{}, error) {
+		rctx, names, err := abacArgs(args, 1)
+		if err != nil {
+			return false, err
+		}
+		value, ok := rctx.Params[names[0]]
+		return ok && rctx.UserID != 0 && value == strconv.FormatUint(uint64(rctx.UserID), 10), nil
+	})
+	e.AddFunction("param", func(args ...interface{}) (interface{}, error) {
+		rctx, names, err := abacArgs(args, 1)
+		if err != nil {
+			return "", err
+		}
+		return rctx.Params[names[0]], nil
+	})
+	e.AddFunction("timeBetween", func(args ...interface{}) (interface{}, error) {
+		rctx, bounds, err := abacArgs(args, 2)
+		if err != nil {
+			return false, err
+		}
+		start, err := time.Parse("15:04", bounds[0])
+		if err != nil {
+			return false, err
+		}
+		end, err := time.Parse("15:04", bounds[1])
+		if err != nil {
+			return false, err
+		}
+		now := rctx.Time.Hour()*60 + rctx.Time.Minute()
+		from := start.Hour()*60 + start.Minute()
+		to := end.Hour()*60 + end.Minute()
+		if from <= to {
+			return now >= from && now < to, nil
+		}
+		return now >= from || now < to, nil
+	})
+	e.AddFunction("isWeekday", func(args ...interface{}) (interface{}, error) {
+		rctx, _, err := abacArgs(args, 0)
+		if err != nil {
+			return false, err
+		}
+		day := rctx.Time.Weekday()
+		return day != time.Saturday && day != time.Sunday, nil
+	})
+}
+
+// abacArgs 解析 ABAC 函数的参数：第一个参数为 r.ctx，之后为 n 个字符串
+func abacArgs(args []interface{}, n int) (*RequestContext, []string, error) {
+	if len(args) != n+1 {
+		return nil, nil, errInvalidABACArgs
+	}
+	rctx, ok := args[0].(*RequestContext)
+	if !ok {
+		return nil, nil, errInvalidABACArgs
+	}
+	values := make([]string, n)
+	for i := range values {
+		if values[i], ok = args[i+1].(string); !ok {
+			return nil, nil, errInvalidABACArgs
+		}
+	}
+	return rctx, values, nil
+}
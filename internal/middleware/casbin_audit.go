@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"fastgin/config"
+	"fastgin/internal/model"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 鉴权被拒绝的原因
+const (
+	DenyReasonNoPolicy    = "no_policy"
+	DenyReasonAPIKeyScope = "api_key_scope"
+)
+
+const (
+	// decisionQueueSize 等待写入的审计记录数量上限，写入跟不上时丢弃新的记录，不影响请求
+	decisionQueueSize = 1024
+	// decisionFlushInterval 批量写入审计记录的间隔
+	decisionFlushInterval = time.Second
+	// decisionPruneInterval 清理过期审计记录的间隔
+	decisionPruneInterval = 10 * time.Minute
+)
+
+// decisionAudit 当前使用的鉴权审计，未启用时为 nil
+var decisionAudit *decisionRecorder
+
+// decisionRecorder 抽样鉴权决策，在后台批量写入数据库
+type decisionRecorder struct {
+	db        *gorm.DB
+	allowRate float64
+	denyRate  float64
+	retention time.Duration
+	queue     chan *model.AuthzDecision
+	done      chan struct{}
+
+	// mu 保护 closed，关闭队列之后不再写入，避免向已关闭的通道发送
+	mu     sync.RWMutex
+	closed bool
+}
+
+// InitDecisionAudit 根据配置启用鉴权决策审计
+func InitDecisionAudit(db *gorm.DB, conf config.CasbinAuditConfig) {
+	if !conf.Enabled {
+		return
+	}
+	// 未配置时记录全部被拒绝的请求，配置为 0 时不记录
+	denyRate := 1.0
+	if conf.DenyRate != nil {
+		denyRate = *conf.DenyRate
+	}
+	retention := time.Duration(conf.Retention) * time.Second
+	if retention <= 0 {
+		retention = 7 * 24 * time.Hour
+	}
+
+	decisionAudit = &decisionRecorder{
+		db:        db,
+		allowRate: conf.AllowRate,
+		denyRate:  denyRate,
+		retention: retention,
+		queue:     make(chan *model.AuthzDecision, decisionQueueSize),
+		done:      make(chan struct{}),
+	}
+	go decisionAudit.run()
+
+	Logger.Info("已启用鉴权决策审计",
+		zap.Float64("allowRate", conf.AllowRate),
+		zap.Float64("denyRate", denyRate))
+}
+
+// CloseDecisionAudit 停止鉴权决策审计，写入尚未保存的记录；仍在处理的请求不再记录
+func CloseDecisionAudit() {
+	r := decisionAudit
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+	<-r.done
+}
+
+// record 按抽样比例记录鉴权决策，队列已满时丢弃
+func (r *decisionRecorder) record(decision *model.AuthzDecision) {
+	rate := r.denyRate
+	if decision.Allowed {
+		rate = r.allowRate
+	}
+	if rate <= 0 || rand.Float64() >= rate {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- decision:
+	default:
+		Logger.Warn("鉴权审计队列已满，丢弃记录",
+			zap.String("sub", decision.Subject),
+			zap.String("path", decision.Object))
+	}
+}
+
+func (r *decisionRecorder) run() {
+	defer close(r.done)
+	flush := time.NewTicker(decisionFlushInterval)
+	defer flush.Stop()
+	prune := time.NewTicker(decisionPruneInterval)
+	defer prune.Stop()
+
+	var batch []*model.AuthzDecision
+	save := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.db.CreateInBatches(batch, 100).Error; err != nil {
+			Logger.Error("写入鉴权审计记录失败", zap.Int("count", len(batch)), zap.Error(err))
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case decision, ok := <-r.queue:
+			if !ok {
+				save()
+				return
+			}
+			batch = append(batch, decision)
+			if len(batch) >= decisionQueueSize {
+				save()
+			}
+		case <-flush.C:
+			save()
+		case <-prune.C:
+			err := r.db.Where("created_at < ?", time.Now().Add(-r.retention)).Delete(&model.AuthzDecision{}).Error
+			if err != nil {
+				Logger.Error("清理鉴权审计记录失败", zap.Error(err))
+			}
+		}
+	}
+}
+
+// auditEnabled 判断是否需要记录命中的策略
+func auditEnabled() bool {
+	return decisionAudit != nil
+}
+
+// auditDecision 记录一次鉴权决策，未启用审计时不做任何事
+func auditDecision(decision *model.AuthzDecision, matched []string) {
+	if decisionAudit == nil {
+		return
+	}
+	decision.Matched = strings.Join(matched, ", ")
+	decision.CreatedAt = time.Now()
+	decisionAudit.record(decision)
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"fastgin/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"gorm.io/gorm"
+)
+
+// writePolicyFile 把默认策略写入临时文件
+func writePolicyFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "rbac_policy.csv")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func openEnforcer(t *testing.T, db *gorm.DB, policyFile string) *casbin.SyncedEnforcer {
+	t.Helper()
+	e, err := NewCasbinMiddleware(db, config.CasbinConfig{Model: "../../config/rbac_model.conf", DefaultPolicy: policyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestSeedDefaultPolicy(t *testing.T) {
+	db := newTestDB(t)
+	file := writePolicyFile(t, `# 注释
+p, admin, *, /api/*, *
+p,editor , tenant:1, /api/reports ,GET
+
+g, editor, user, *
+`)
+	e := openEnforcer(t, db, file)
+	for _, rule := range [][]string{{"admin", "*", "/api/*", "*"}, {"editor", "tenant:1", "/api/reports", "GET"}} {
+		if ok, _ := e.HasPolicy(rule); !ok {
+			t.Errorf("policy %v not seeded", rule)
+		}
+	}
+	if ok, _ := e.HasGroupingPolicy("editor", "user", "*"); !ok {
+		t.Error("grouping not seeded")
+	}
+	if n := storedRules(t, db, "editor"); n != 2 {
+		t.Errorf("stored editor rules = %d, want 2", n)
+	}
+
+	// 已有策略时不再导入，即使默认策略文件已修改
+	if _, err := e.RemovePolicy("editor", "tenant:1", "/api/reports", "GET"); err != nil {
+		t.Fatal(err)
+	}
+	file = writePolicyFile(t, "p, auditor, *, /api/logs, GET\n")
+	e = openEnforcer(t, db, file)
+	if ok, _ := e.HasPolicy("editor", "tenant:1", "/api/reports", "GET"); ok {
+		t.Error("removed policy seeded again")
+	}
+	if ok, _ := e.HasPolicy("auditor", "*", "/api/logs", "GET"); ok {
+		t.Error("default policy seeded into a database with policies")
+	}
+}
+
+func TestSeedDefaultPolicyMissingFile(t *testing.T) {
+	e := openEnforcer(t, newTestDB(t), filepath.Join(t.TempDir(), "missing.csv"))
+	if policies, _ := e.GetPolicy(); len(policies) != 0 {
+		t.Errorf("policies = %v, want none", policies)
+	}
+}
+
+func TestMigrateLegacyPolicies(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := gormadapter.NewAdapterByDB(db); err != nil {
+		t.Fatal(err)
+	}
+	// 启用多租户前的策略：p 没有域，g 没有域
+	legacy := []gormadapter.CasbinRule{
+		{Ptype: "p", V0: "admin", V1: "/api/*", V2: "*"},
+		{Ptype: "p", V0: "editor", V1: "/api/reports", V2: "GET"},
+		{Ptype: "g", V0: "user:1", V1: "admin"},
+		{Ptype: "g", V0: "lead", V1: "editor"},
+		// 已经是新格式的策略保持不变
+		{Ptype: "p", V0: "viewer", V1: "tenant:2", V2: "/api/users", V3: "GET"},
+		{Ptype: "g", V0: "user:2", V1: "viewer", V2: "tenant:2"},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	e := openEnforcer(t, db, "")
+	policies, _ := e.GetPolicy()
+	for _, rule := range [][]string{
+		{"admin", "*", "/api/*", "*"},
+		{"editor", "*", "/api/reports", "GET"},
+		{"viewer", "tenant:2", "/api/users", "GET"},
+	} {
+		if !slices.ContainsFunc(policies, func(p []string) bool { return slices.Equal(p, rule) }) {
+			t.Errorf("policy %v missing after migration: %v", rule, policies)
+		}
+	}
+	for _, rule := range [][]string{{"user:1", "admin", "tenant:1"}, {"lead", "editor", "*"}, {"user:2", "viewer", "tenant:2"}} {
+		if ok, _ := e.HasGroupingPolicy(rule); !ok {
+			t.Errorf("grouping %v missing after migration", rule)
+		}
+	}
+	if len(policies) != 3 {
+		t.Errorf("default policy seeded into a migrated database: %v", policies)
+	}
+	if ok, _ := e.Enforce("user:1", "tenant:1", "/api/users", "DELETE"); !ok {
+		t.Error("migrated admin denied")
+	}
+}
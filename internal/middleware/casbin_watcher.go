@@ -0,0 +1,506 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fastgin/config"
+	"fastgin/internal/model"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	casbinmodel "github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 策略变更操作
+const (
+	policyOpAdd            = "add"
+	policyOpRemove         = "remove"
+	policyOpRemoveFiltered = "remove_filtered"
+	policyOpUpdate         = "update"
+	policyOpReload         = "reload"
+)
+
+const (
+	// policyGapTimeout 变更记录 ID 出现空缺时等待的时长，超时后视为回滚或未使用的 ID
+	policyGapTimeout = 10 * time.Second
+	// policyPollBatch 每次轮询最多读取的变更记录数量
+	policyPollBatch = 500
+	// policyPruneInterval 清理过期变更记录的最小间隔
+	policyPruneInterval = time.Minute
+	// policyPublishTimeout 发布变更的超时时间，发布在持有执行器写锁时进行
+	policyPublishTimeout = 5 * time.Second
+)
+
+// PolicyChange 一个节点上的策略变更，其他节点收到后增量更新内存中的策略
+type PolicyChange struct {
+	Node       string     `json:"node"`
+	Op         string     `json:"op"`
+	Sec        string     `json:"sec,omitempty"`
+	Ptype      string     `json:"ptype,omitempty"`
+	FieldIndex int        `json:"field_index,omitempty"`
+	Rules      [][]string `json:"rules,omitempty"`
+	// NewRules update 操作修改后的策略，与 Rules 一一对应
+	NewRules [][]string `json:"new_rules,omitempty"`
+}
+
+// PubSub 发布订阅，用于接入 Redis、NATS 等消息组件同步策略变更
+type PubSub interface {
+	Publish(ctx context.Context, channel string, payload []byte) error
+	// Subscribe 订阅频道，阻塞直到 ctx 被取消或连接中断，中断时返回错误，调用方会重新订阅
+	Subscribe(ctx context.Context, channel string, handler func(payload []byte)) error
+}
+
+var (
+	pubSubsMu sync.RWMutex
+	pubSubs   = make(map[string]PubSub)
+
+	// policyWatcher 当前使用的策略同步，服务关闭时停止
+	policyWatcher persist.Watcher
+)
+
+// RegisterPubSub 注册发布订阅实现，需要在初始化路由之前调用
+func RegisterPubSub(name string, ps PubSub) {
+	pubSubsMu.Lock()
+	defer pubSubsMu.Unlock()
+	pubSubs[name] = ps
+}
+
+func lookupPubSub(name string) PubSub {
+	pubSubsMu.RLock()
+	defer pubSubsMu.RUnlock()
+	return pubSubs[name]
+}
+
+func newNodeID() string {
+	host, _ := os.Hostname()
+	if len(host) > 48 {
+		host = host[:48]
+	}
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// InitPolicyWatcher 根据配置为执行器设置策略同步，使其他节点上的策略变更在本节点生效
+func InitPolicyWatcher(db *gorm.DB, e *casbin.SyncedEnforcer, conf config.CasbinWatcherConfig) error {
+	var w persist.Watcher
+	switch conf.Driver {
+	case "none":
+		return nil
+	case "pubsub":
+		ps := lookupPubSub(conf.PubSub)
+		if ps == nil {
+			return fmt.Errorf("未注册的发布订阅实现: %s", conf.PubSub)
+		}
+		channel := conf.Channel
+		if channel == "" {
+			channel = "fastgin:casbin"
+		}
+		w = newPubSubWatcher(e, ps, channel)
+	default:
+		dw, err := newDBWatcher(db, e, conf)
+		if err != nil {
+			return err
+		}
+		w = dw
+	}
+
+	if err := e.SetWatcher(w); err != nil {
+		w.Close()
+		return err
+	}
+	policyWatcher = w
+	Logger.Info("已启用权限策略同步",
+		zap.String("driver", conf.Driver))
+	return nil
+}
+
+// ClosePolicyWatcher 停止策略同步
+func ClosePolicyWatcher() {
+	if policyWatcher != nil {
+		policyWatcher.Close()
+	}
+}
+
+// policyPublisher 将本节点的策略变更转换为 PolicyChange 发布，实现 persist.WatcherEx 和 persist.UpdatableWatcher
+type policyPublisher struct {
+	// node 当前节点标识，用于忽略自己发布的变更
+	node    string
+	publish func(change *PolicyChange) error
+}
+
+func newPolicyPublisher() policyPublisher {
+	return policyPublisher{node: newNodeID()}
+}
+
+func (p *policyPublisher) emit(change *PolicyChange) error {
+	change.Node = p.node
+	return p.publish(change)
+}
+
+func (p *policyPublisher) SetUpdateCallback(func(string)) error {
+	return nil
+}
+
+func (p *policyPublisher) Update() error {
+	return p.emit(&PolicyChange{Op: policyOpReload})
+}
+
+func (p *policyPublisher) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return p.emit(&PolicyChange{Op: policyOpAdd, Sec: sec, Ptype: ptype, Rules: [][]string{params}})
+}
+
+func (p *policyPublisher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return p.emit(&PolicyChange{Op: policyOpRemove, Sec: sec, Ptype: ptype, Rules: [][]string{params}})
+}
+
+func (p *policyPublisher) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return p.emit(&PolicyChange{Op: policyOpRemoveFiltered, Sec: sec, Ptype: ptype, FieldIndex: fieldIndex, Rules: [][]string{fieldValues}})
+}
+
+func (p *policyPublisher) UpdateForSavePolicy(casbinmodel.Model) error {
+	return p.emit(&PolicyChange{Op: policyOpReload})
+}
+
+func (p *policyPublisher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return p.emit(&PolicyChange{Op: policyOpAdd, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+func (p *policyPublisher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return p.emit(&PolicyChange{Op: policyOpRemove, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+func (p *policyPublisher) UpdateForUpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return p.emit(&PolicyChange{Op: policyOpUpdate, Sec: sec, Ptype: ptype, Rules: [][]string{oldRule}, NewRules: [][]string{newRule}})
+}
+
+func (p *policyPublisher) UpdateForUpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	return p.emit(&PolicyChange{Op: policyOpUpdate, Sec: sec, Ptype: ptype, Rules: oldRules, NewRules: newRules})
+}
+
+// applyPolicyChange 将其他节点的策略变更应用到内存
+// 变更已由发布节点写入数据库，Self* 方法在开启自动保存时同样会写入适配器，
+// 重放较早的变更可能覆盖其他节点之后的修改，因此应用期间持有执行器写锁并暂时移除适配器，
+// 不改变执行器的自动保存设置
+func applyPolicyChange(e *casbin.SyncedEnforcer, change *PolicyChange) error {
+	switch change.Op {
+	case policyOpAdd, policyOpRemove, policyOpRemoveFiltered, policyOpUpdate:
+	default:
+		return e.LoadPolicy()
+	}
+
+	lock := e.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+	adapter := e.Enforcer.GetAdapter()
+	e.Enforcer.SetAdapter(nil)
+	defer e.Enforcer.SetAdapter(adapter)
+
+	var err error
+	switch change.Op {
+	case policyOpAdd:
+		// 已存在的策略自动跳过
+		_, err = e.Enforcer.SelfAddPoliciesEx(change.Sec, change.Ptype, change.Rules)
+	case policyOpRemove:
+		for _, rule := range change.Rules {
+			if _, err = e.Enforcer.SelfRemovePolicy(change.Sec, change.Ptype, rule); err != nil {
+				break
+			}
+		}
+	case policyOpRemoveFiltered:
+		if len(change.Rules) == 1 {
+			_, err = e.Enforcer.SelfRemoveFilteredPolicy(change.Sec, change.Ptype, change.FieldIndex, change.Rules[0]...)
+		}
+	case policyOpUpdate:
+		_, err = e.Enforcer.SelfUpdatePolicies(change.Sec, change.Ptype, change.Rules, change.NewRules)
+	}
+	return err
+}
+
+// applyOrReload 增量应用失败时全量重新加载，保证与数据库一致
+func applyOrReload(e *casbin.SyncedEnforcer, change *PolicyChange) {
+	err := applyPolicyChange(e, change)
+	if err == nil {
+		Logger.Debug("已同步权限策略变更",
+			zap.String("node", change.Node),
+			zap.String("op", change.Op),
+			zap.String("ptype", change.Ptype))
+		return
+	}
+	Logger.Warn("增量同步权限策略失败，重新加载全部策略",
+		zap.Error(err),
+		zap.String("node", change.Node),
+		zap.String("op", change.Op))
+	if err := e.LoadPolicy(); err != nil {
+		Logger.Error("重新加载权限策略失败", zap.Error(err))
+	}
+}
+
+// DBWatcher 通过 casbin_change 表同步策略变更，不依赖数据库之外的组件
+// 修改策略的节点写入变更记录，其他节点轮询读取新记录并增量更新
+type DBWatcher struct {
+	policyPublisher
+	db        *gorm.DB
+	e         *casbin.SyncedEnforcer
+	interval  time.Duration
+	retention time.Duration
+
+	lastID uint
+	// gaps 尚未读取到的 ID，可能属于还未提交的写入
+	gaps      map[uint]time.Time
+	lastPoll  time.Time
+	lastPrune time.Time
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newDBWatcher(db *gorm.DB, e *casbin.SyncedEnforcer, conf config.CasbinWatcherConfig) (*DBWatcher, error) {
+	w := &DBWatcher{
+		policyPublisher: newPolicyPublisher(),
+		db:              db,
+		e:               e,
+		interval:        2 * time.Second,
+		retention:       10 * time.Minute,
+		gaps:            make(map[uint]time.Time),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	if conf.PollInterval > 0 {
+		w.interval = time.Duration(conf.PollInterval) * time.Second
+	}
+	if conf.Retention > 0 {
+		w.retention = time.Duration(conf.Retention) * time.Second
+	}
+	w.publish = w.insert
+
+	// 启动时已经全量加载过策略，从当前最新的记录开始同步
+	lastID, err := w.maxID()
+	if err != nil {
+		return nil, err
+	}
+	w.lastID = lastID
+	w.lastPoll = time.Now()
+
+	go w.run()
+	return w, nil
+}
+
+func (w *DBWatcher) insert(change *PolicyChange) error {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return w.db.Create(&model.CasbinChange{Node: w.node, Payload: string(payload)}).Error
+}
+
+func (w *DBWatcher) maxID() (uint, error) {
+	var id uint
+	err := w.db.Model(&model.CasbinChange{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
+}
+
+func (w *DBWatcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := w.poll(); err != nil {
+			Logger.Error("同步权限策略失败", zap.Error(err))
+		}
+	}
+}
+
+// poll 读取并应用新的变更记录
+func (w *DBWatcher) poll() error {
+	now := time.Now()
+	// 停止轮询的时间超过保留时长，期间的变更记录可能已被清理，改为全量加载
+	if now.Sub(w.lastPoll) > w.retention {
+		if err := w.reload(); err != nil {
+			return err
+		}
+		w.lastPoll = now
+		return nil
+	}
+
+	query := w.db.Where("id > ?", w.lastID)
+	if len(w.gaps) > 0 {
+		ids := make([]uint, 0, len(w.gaps))
+		for id := range w.gaps {
+			ids = append(ids, id)
+		}
+		query = w.db.Where("id > ? OR id IN ?", w.lastID, ids)
+	}
+	var changes []model.CasbinChange
+	if err := query.Order("id").Limit(policyPollBatch).Find(&changes).Error; err != nil {
+		return err
+	}
+	w.lastPoll = now
+
+	needReload := false
+	for _, c := range changes {
+		late := false
+		if _, ok := w.gaps[c.ID]; ok {
+			delete(w.gaps, c.ID)
+			late = true
+		} else if c.ID > w.lastID {
+			if c.ID-w.lastID-1 > policyPollBatch {
+				needReload = true
+			} else {
+				for id := w.lastID + 1; id < c.ID; id++ {
+					w.gaps[id] = now
+				}
+			}
+			w.lastID = c.ID
+		}
+
+		if c.Node == w.node || needReload {
+			continue
+		}
+		// 晚于后续记录提交的变更，增量应用可能打乱顺序，改为全量加载
+		if late {
+			needReload = true
+			continue
+		}
+		var change PolicyChange
+		if err := json.Unmarshal([]byte(c.Payload), &change); err != nil {
+			Logger.Warn("无法解析权限策略变更", zap.Uint("id", c.ID), zap.Error(err))
+			needReload = true
+			continue
+		}
+		applyOrReload(w.e, &change)
+	}
+
+	for id, seen := range w.gaps {
+		if now.Sub(seen) > policyGapTimeout {
+			delete(w.gaps, id)
+		}
+	}
+
+	if needReload {
+		if err := w.reload(); err != nil {
+			return err
+		}
+	}
+
+	if now.Sub(w.lastPrune) > policyPruneInterval {
+		w.lastPrune = now
+		if err := w.db.Where("created_at < ?", now.Add(-w.retention)).Delete(&model.CasbinChange{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reload 全量重新加载策略，并从当前最新的变更记录继续同步
+func (w *DBWatcher) reload() error {
+	// 先读取最新 ID 再加载策略，加载期间写入的变更会在下次轮询时再次应用，增量操作是幂等的
+	lastID, err := w.maxID()
+	if err != nil {
+		return err
+	}
+	if err := w.e.LoadPolicy(); err != nil {
+		return err
+	}
+	w.lastID = lastID
+	w.gaps = make(map[uint]time.Time)
+	Logger.Info("已重新加载全部权限策略", zap.Uint("lastChangeID", lastID))
+	return nil
+}
+
+// Close 停止轮询
+func (w *DBWatcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+		<-w.done
+	})
+}
+
+// PubSubWatcher 通过发布订阅同步策略变更，消息丢失时（如订阅中断期间）只能在重新订阅后全量加载
+type PubSubWatcher struct {
+	policyPublisher
+	e       *casbin.SyncedEnforcer
+	ps      PubSub
+	channel string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newPubSubWatcher(e *casbin.SyncedEnforcer, ps PubSub, channel string) *PubSubWatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &PubSubWatcher{
+		policyPublisher: newPolicyPublisher(),
+		e:               e,
+		ps:              ps,
+		channel:         channel,
+		cancel:          cancel,
+		done:            make(chan struct{}),
+	}
+	w.publish = w.send
+	go w.run(ctx)
+	return w
+}
+
+func (w *PubSubWatcher) send(change *PolicyChange) error {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), policyPublishTimeout)
+	defer cancel()
+	return w.ps.Publish(ctx, w.channel, payload)
+}
+
+func (w *PubSubWatcher) run(ctx context.Context) {
+	defer close(w.done)
+	for {
+		err := w.ps.Subscribe(ctx, w.channel, w.handle)
+		if ctx.Err() != nil {
+			return
+		}
+		Logger.Warn("权限策略订阅中断，稍后重新订阅", zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(3 * time.Second):
+		}
+		// 订阅中断期间的变更已经丢失，重新订阅前全量加载
+		if err := w.e.LoadPolicy(); err != nil {
+			Logger.Error("重新加载权限策略失败", zap.Error(err))
+		}
+	}
+}
+
+func (w *PubSubWatcher) handle(payload []byte) {
+	var change PolicyChange
+	if err := json.Unmarshal(payload, &change); err != nil {
+		Logger.Warn("无法解析权限策略变更", zap.Error(err))
+		return
+	}
+	if change.Node == w.node {
+		return
+	}
+	applyOrReload(w.e, &change)
+}
+
+// Close 取消订阅
+func (w *PubSubWatcher) Close() {
+	w.cancel()
+	<-w.done
+}
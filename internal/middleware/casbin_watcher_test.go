@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fastgin/config"
+	"fastgin/internal/model"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB 创建独立的 SQLite 数据库
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	Logger = zap.NewNop()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := db.AutoMigrate(&model.CasbinChange{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestEnforcer 使用独立的 SQLite 数据库创建执行器，策略与默认配置一致
+func newTestEnforcer(t *testing.T) (*gorm.DB, *casbin.SyncedEnforcer) {
+	t.Helper()
+	db := newTestDB(t)
+	e, err := NewCasbinMiddleware(db, config.CasbinConfig{
+		Model:         "../../config/rbac_model.conf",
+		DefaultPolicy: "../../config/rbac_policy.csv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, e
+}
+
+// storedRules 数据库中 v0 为 sub 的策略数量
+func storedRules(t *testing.T, db *gorm.DB, sub string) int64 {
+	t.Helper()
+	var count int64
+	if err := db.Table("casbin_rule").Where("v0 = ?", sub).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestApplyPolicyChange(t *testing.T) {
+	for _, autoSave := range []bool{false, true} {
+		db, e := newTestEnforcer(t)
+		e.EnableAutoSave(autoSave)
+		rule := []string{"editor", "*", "/api/reports", "GET"}
+		updated := []string{"editor", "*", "/api/reports", "POST"}
+
+		changes := []PolicyChange{
+			{Op: policyOpAdd, Sec: "p", Ptype: "p", Rules: [][]string{rule}},
+			// 重复的变更自动跳过
+			{Op: policyOpAdd, Sec: "p", Ptype: "p", Rules: [][]string{rule}},
+			{Op: policyOpUpdate, Sec: "p", Ptype: "p", Rules: [][]string{rule}, NewRules: [][]string{updated}},
+		}
+		for _, change := range changes {
+			if err := applyPolicyChange(e, &change); err != nil {
+				t.Fatalf("autoSave=%v: %s: %v", autoSave, change.Op, err)
+			}
+		}
+		if ok, _ := e.HasPolicy(rule); ok {
+			t.Errorf("autoSave=%v: rule not updated", autoSave)
+		}
+		if ok, _ := e.HasPolicy(updated); !ok {
+			t.Errorf("autoSave=%v: updated rule missing", autoSave)
+		}
+		// 其他节点的变更已经写入数据库，应用时不再写入
+		if n := storedRules(t, db, "editor"); n != 0 {
+			t.Errorf("autoSave=%v: applied change saved to the adapter: %d rules", autoSave, n)
+		}
+
+		change := PolicyChange{Op: policyOpRemoveFiltered, Sec: "p", Ptype: "p", Rules: [][]string{{"editor"}}}
+		if err := applyPolicyChange(e, &change); err != nil {
+			t.Fatal(err)
+		}
+		if rules, _ := e.GetFilteredPolicy(0, "editor"); len(rules) != 0 {
+			t.Errorf("autoSave=%v: remove_filtered left %v", autoSave, rules)
+		}
+
+		// 应用变更后保持原来的自动保存设置
+		if _, err := e.AddPolicy("auditor", "*", "/api/logs", "GET"); err != nil {
+			t.Fatal(err)
+		}
+		want := int64(0)
+		if autoSave {
+			want = 1
+		}
+		if n := storedRules(t, db, "auditor"); n != want {
+			t.Errorf("autoSave=%v: %d rules saved after applying changes, want %d", autoSave, n, want)
+		}
+	}
+}
+
+// insertChange 以指定 ID 写入一条变更记录
+func insertChange(t *testing.T, db *gorm.DB, id uint, node string, rule ...string) {
+	t.Helper()
+	payload, err := json.Marshal(PolicyChange{Node: node, Op: policyOpAdd, Sec: "p", Ptype: "p", Rules: [][]string{rule}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.CasbinChange{ID: id, Node: node, Payload: string(payload)}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storeRule 直接写入数据库中的策略，只有全量加载时才会出现在内存中
+func storeRule(t *testing.T, db *gorm.DB, rule ...string) {
+	t.Helper()
+	err := db.Exec("INSERT INTO casbin_rule (ptype, v0, v1, v2, v3) VALUES ('p', ?, ?, ?, ?)",
+		rule[0], rule[1], rule[2], rule[3]).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBWatcherGaps(t *testing.T) {
+	db, e := newTestEnforcer(t)
+	e.EnableAutoSave(false)
+	// 只在测试中手动轮询
+	w, err := newDBWatcher(db, e, config.CasbinWatcherConfig{PollInterval: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	poll := func() {
+		t.Helper()
+		if err := w.poll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	has := func(rule ...string) bool {
+		ok, _ := e.HasPolicy(rule)
+		return ok
+	}
+	base := w.lastID
+
+	// 先读取到较大的 ID，中间的 ID 记为空缺
+	insertChange(t, db, base+2, "other", "a", "*", "/api/a", "GET")
+	poll()
+	if !has("a", "*", "/api/a", "GET") {
+		t.Fatal("change not applied")
+	}
+	if _, ok := w.gaps[base+1]; !ok || w.lastID != base+2 {
+		t.Fatalf("gaps = %v, lastID = %d", w.gaps, w.lastID)
+	}
+
+	// 空缺的记录晚于后续记录提交，改为全量加载
+	storeRule(t, db, "z", "*", "/api/z", "GET")
+	insertChange(t, db, base+1, "other", "b", "*", "/api/b", "GET")
+	poll()
+	if !has("z", "*", "/api/z", "GET") {
+		t.Error("late change did not trigger a full reload")
+	}
+	if len(w.gaps) != 0 {
+		t.Errorf("gaps after reload = %v", w.gaps)
+	}
+
+	// 忽略本节点发布的变更
+	insertChange(t, db, w.lastID+1, w.node, "c", "*", "/api/c", "GET")
+	poll()
+	if has("c", "*", "/api/c", "GET") {
+		t.Error("own change applied")
+	}
+
+	// 空缺超时后视为回滚，之后提交的记录不再读取
+	gap := w.lastID + 1
+	insertChange(t, db, gap+1, "other", "d", "*", "/api/d", "GET")
+	poll()
+	w.gaps[gap] = time.Now().Add(-policyGapTimeout - time.Second)
+	poll()
+	if _, ok := w.gaps[gap]; ok {
+		t.Fatal("expired gap kept")
+	}
+	insertChange(t, db, gap, "other", "e", "*", "/api/e", "GET")
+	poll()
+	if has("e", "*", "/api/e", "GET") || !has("d", "*", "/api/d", "GET") {
+		t.Error("change inside an expired gap applied")
+	}
+
+	// 空缺超过一次轮询的数量时直接全量加载
+	storeRule(t, db, "y", "*", "/api/y", "GET")
+	insertChange(t, db, w.lastID+policyPollBatch+2, "other", "f", "*", "/api/f", "GET")
+	poll()
+	if !has("y", "*", "/api/y", "GET") || len(w.gaps) != 0 {
+		t.Errorf("large gap did not trigger a full reload: gaps = %d", len(w.gaps))
+	}
+}
@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fastgin/internal/model"
 	"strings"
 	"time"
 
@@ -11,47 +14,180 @@ import (
 )
 
 type JWTClaims struct {
-	UserID   uint   `json:"user_id"`
+	UserID uint `json:"user_id"`
+	// TenantID 用户所属租户，启用多租户前签发的令牌没有该声明，视为默认租户
+	TenantID uint   `json:"tid,omitempty"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// Purpose 非空表示受限用途的令牌（如等待两步验证），不能用于访问业务接口
+	Purpose string `json:"pur,omitempty"`
+	// SessionID 登录会话标识，会话被终止后令牌随之失效
+	SessionID string `json:"sid,omitempty"`
+	// Actor 模拟登录时实际操作的管理员（RFC 8693 act 声明）
+	Actor *ActorClaims `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// ActorClaims 模拟登录的操作者
+type ActorClaims struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+}
+
 const (
-	JWTSecret = "your-secret-key" // 实际应用中应该从配置文件读取
-	Bearer    = "Bearer "
+	Bearer = "Bearer "
+
+	// PurposeMFAPending 密码验证通过、等待两步验证的令牌
+	PurposeMFAPending = "mfa_pending"
+	// MFATokenTTL 两步验证令牌有效期
+	MFATokenTTL = 5 * time.Minute
+	// PurposePasswordChange 必须先修改密码的用户持有的令牌，只能访问修改密码接口
+	PurposePasswordChange = "password_change"
+	// ImpersonationTokenTTL 模拟登录令牌有效期，不签发刷新令牌
+	ImpersonationTokenTTL = 15 * time.Minute
+	// PurposeVerifyEmail 邮箱验证链接中的令牌
+	PurposeVerifyEmail = "verify_email"
 )
 
-func GenerateToken(userID uint, username, role string) (string, error) {
-	claims := JWTClaims{
+func init() {
+	// 时间声明精确到毫秒，使令牌水位线能够区分同一秒内先后签发的令牌
+	jwt.TimePrecision = time.Millisecond
+}
+
+// newJTI 生成令牌唯一标识
+func newJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newClaims(userID uint, username, role, purpose string, ttl time.Duration) (*JWTClaims, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &JWTClaims{
 		UserID:   userID,
 		Username: username,
 		Role:     role,
+		Purpose:  purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
+	}, nil
+}
+
+// GenerateMFAToken 生成等待两步验证的短期令牌，只能用于完成两步验证
+func GenerateMFAToken(userID uint, username, role string) (string, error) {
+	claims, err := newClaims(userID, username, role, PurposeMFAPending, MFATokenTTL)
+	if err != nil {
+		return "", err
+	}
+	return signToken(claims)
+}
+
+// ParseMFAToken 校验两步验证令牌
+func ParseMFAToken(tokenString string) (*JWTClaims, error) {
+	claims, err := parsePurposeToken(tokenString, PurposeMFAPending)
+	if err != nil {
+		return nil, errors.New("无效的两步验证令牌")
+	}
+	return claims, nil
+}
+
+// GenerateEmailVerificationToken 生成邮箱验证链接中的签名令牌
+func GenerateEmailVerificationToken(userID uint, username string, ttl time.Duration) (string, error) {
+	claims, err := newClaims(userID, username, "", PurposeVerifyEmail, ttl)
+	if err != nil {
+		return "", err
+	}
+	return signToken(claims)
+}
+
+// ParseEmailVerificationToken 校验邮箱验证令牌
+func ParseEmailVerificationToken(tokenString string) (*JWTClaims, error) {
+	return parsePurposeToken(tokenString, PurposeVerifyEmail)
+}
+
+// parsePurposeToken 校验指定用途的受限令牌
+func parsePurposeToken(tokenString, purpose string) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, verificationKey)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid || claims.Purpose != purpose {
+		return nil, errors.New("无效的token")
+	}
+	if err := checkRevocation(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// GenerateToken 生成访问令牌，返回令牌和其 jti
+func GenerateToken(userID, tenantID uint, username, role, sessionID string) (string, string, error) {
+	return generateAccessToken(userID, tenantID, username, role, sessionID, "")
+}
+
+// GeneratePasswordChangeToken 为必须修改密码的用户生成令牌，只能用于修改密码
+func GeneratePasswordChangeToken(userID, tenantID uint, username, role, sessionID string) (string, string, error) {
+	return generateAccessToken(userID, tenantID, username, role, sessionID, PurposePasswordChange)
+}
+
+func generateAccessToken(userID, tenantID uint, username, role, sessionID, purpose string) (string, string, error) {
+	claims, err := newClaims(userID, username, role, purpose, AccessTokenTTL())
+	if err != nil {
+		return "", "", err
 	}
+	claims.TenantID = tenantID
+	claims.SessionID = sessionID
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(JWTSecret))
+	tokenString, err := signToken(claims)
 
 	if err != nil {
 		Logger.Error("生成token失败",
 			zap.Error(err),
 			zap.Uint("userID", userID),
 			zap.String("username", username))
-		return "", err
+		return "", "", err
 	}
 
 	Logger.Info("生成token成功",
 		zap.Uint("userID", userID),
 		zap.String("username", username))
-	return tokenString, nil
+	return tokenString, claims.ID, nil
+}
+
+// GenerateImpersonationToken 生成以目标用户身份访问的短期令牌，act 声明记录实际操作的管理员
+func GenerateImpersonationToken(userID, tenantID uint, username, role string, actor ActorClaims) (string, error) {
+	claims, err := newClaims(userID, username, role, "", ImpersonationTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	claims.TenantID = tenantID
+	claims.Actor = &actor
+	return signToken(claims)
 }
 
+// JWTAuth 校验访问令牌，拒绝所有受限用途的令牌
 func JWTAuth() gin.HandlerFunc {
+	return jwtAuth(false)
+}
+
+// PasswordChangeAuth 修改密码接口使用，额外接受必须修改密码的用户持有的令牌
+func PasswordChangeAuth() gin.HandlerFunc {
+	return jwtAuth(true)
+}
+
+func jwtAuth(allowPasswordChange bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
 		if auth == "" {
@@ -67,14 +203,7 @@ func JWTAuth() gin.HandlerFunc {
 		}
 
 		tokenString := auth[len(Bearer):]
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				Logger.Warn("无效的签名方法",
-					zap.String("method", token.Method.Alg()))
-				return nil, errors.New("无效的签名方法")
-			}
-			return []byte(JWTSecret), nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, verificationKey)
 
 		if err != nil {
 			Logger.Error("token解析失败",
@@ -85,15 +214,76 @@ func JWTAuth() gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+			if claims.Purpose != "" && claims.Purpose != PurposePasswordChange {
+				Logger.Warn("受限用途的token不能访问接口",
+					zap.Uint("userID", claims.UserID),
+					zap.String("purpose", claims.Purpose))
+				c.AbortWithStatusJSON(401, gin.H{"code": 401, "message": "无效的token"})
+				return
+			}
+
+			if err := checkRevocation(claims); err != nil {
+				Logger.Warn("token已失效",
+					zap.Error(err),
+					zap.Uint("userID", claims.UserID),
+					zap.String("jti", claims.ID))
+				c.AbortWithStatusJSON(401, gin.H{"code": 401, "message": "token已失效"})
+				return
+			}
+
+			if err := checkSession(claims); err != nil {
+				Logger.Warn("会话已失效",
+					zap.Error(err),
+					zap.Uint("userID", claims.UserID),
+					zap.String("sessionID", claims.SessionID))
+				c.AbortWithStatusJSON(401, gin.H{"code": 401, "message": "会话已失效"})
+				return
+			}
+
+			if claims.Purpose == PurposePasswordChange && !allowPasswordChange {
+				Logger.Warn("用户必须先修改密码",
+					zap.Uint("userID", claims.UserID),
+					zap.String("path", c.FullPath()))
+				c.AbortWithStatusJSON(403, gin.H{"code": 403, "message": "请先修改密码"})
+				return
+			}
+
 			Logger.Debug("token验证成功",
 				zap.Uint("userID", claims.UserID),
 				zap.String("username", claims.Username),
 				zap.String("role", claims.Role))
 
+			tenantID := claims.TenantID
+			if tenantID == 0 {
+				tenantID = model.DefaultTenantID
+			}
+
 			c.Set("userID", claims.UserID)
+			c.Set("tenantID", tenantID)
 			c.Set("username", claims.Username)
 			c.Set("role", claims.Role)
+			c.Set("jti", claims.ID)
+			c.Set("sessionID", claims.SessionID)
+			c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+
+			if claims.Actor == nil {
+				c.Next()
+				return
+			}
+
+			// 模拟登录：记录实际操作的管理员，并对每个请求写审计日志
+			c.Set("actorID", claims.Actor.UserID)
+			c.Set("actorUsername", claims.Actor.Username)
 			c.Next()
+			Logger.Info("模拟登录操作",
+				zap.Uint("actorID", claims.Actor.UserID),
+				zap.String("actorUsername", claims.Actor.Username),
+				zap.Uint("userID", claims.UserID),
+				zap.String("username", claims.Username),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.Int("status", c.Writer.Status()),
+				zap.String("ip", c.ClientIP()))
 		} else {
 			Logger.Warn("无效的token声明")
 			c.AbortWithStatusJSON(401, gin.H{"code": 401, "message": "无效的token声明"})
@@ -101,3 +291,43 @@ func JWTAuth() gin.HandlerFunc {
 		}
 	}
 }
+
+// DenyImpersonation 拒绝模拟登录令牌访问，用于修改密码、两步验证、API Key 等凭证管理接口
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("actorID"); ok {
+			Logger.Warn("模拟登录不能访问凭证管理接口",
+				zap.Uint("actorID", c.GetUint("actorID")),
+				zap.Uint("userID", c.GetUint("userID")),
+				zap.String("path", c.Request.URL.Path))
+			c.AbortWithStatusJSON(403, gin.H{"code": 403, "message": "模拟登录时不能执行此操作"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkRevocation 检查令牌是否已被单独吊销，或签发时间早于用户的令牌水位线
+func checkRevocation(claims *JWTClaims) error {
+	if claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return errors.New("token缺少必要声明")
+	}
+
+	revoked, err := TokenStore.IsRevoked(claims.ID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return errors.New("token已被吊销")
+	}
+
+	watermark, err := TokenStore.UserWatermark(claims.UserID)
+	if err != nil {
+		return err
+	}
+	// iat 精确到毫秒，水位线同样截断到毫秒后比较
+	if claims.IssuedAt.Time.Before(watermark.Truncate(time.Millisecond)) {
+		return errors.New("token签发时间早于用户令牌水位线")
+	}
+	return nil
+}
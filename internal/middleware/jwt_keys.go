@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fastgin/config"
+	"fmt"
+	"math/big"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// jwtKey 单个签名密钥
+type jwtKey struct {
+	method    jwt.SigningMethod
+	signKey   interface{} // 为空表示仅用于校验
+	verifyKey interface{}
+}
+
+// jwtKeySet 当前生效的 JWT 密钥集合
+type jwtKeySet struct {
+	signingKid string
+	keys       map[string]*jwtKey // kid 为空表示不带 kid 头的旧令牌使用的密钥
+	jwks       JSONWebKeySet
+	expire     time.Duration
+}
+
+// JSONWebKey 公钥的 JWK 表示（RFC 7517）
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet JWKS 文档
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var jwtKeys atomic.Pointer[jwtKeySet]
+
+// InitJWTKeys 根据配置加载 JWT 密钥，配置热重载时再次调用即可生效
+func InitJWTKeys(conf config.JWTConfig) error {
+	set := &jwtKeySet{
+		keys:   make(map[string]*jwtKey),
+		jwks:   JSONWebKeySet{Keys: []JSONWebKey{}},
+		expire: 2 * time.Hour,
+	}
+	if conf.Expire > 0 {
+		set.expire = time.Duration(conf.Expire) * time.Second
+	}
+
+	if conf.Secret != "" {
+		set.keys[""] = &jwtKey{
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(conf.Secret),
+			verifyKey: []byte(conf.Secret),
+		}
+	}
+	for _, keyConf := range conf.Keys {
+		key, err := loadJWTKey(keyConf)
+		if err != nil {
+			return fmt.Errorf("加载JWT密钥 %s 失败: %w", keyConf.Kid, err)
+		}
+		set.keys[keyConf.Kid] = key
+
+		if jwk, ok := toJWK(keyConf.Kid, key); ok {
+			set.jwks.Keys = append(set.jwks.Keys, jwk)
+		}
+	}
+
+	switch {
+	case conf.ActiveKid != "":
+		set.signingKid = conf.ActiveKid
+	case len(conf.Keys) > 0:
+		set.signingKid = conf.Keys[0].Kid
+	}
+	key, ok := set.keys[set.signingKid]
+	if !ok {
+		return errors.New("JWT签名密钥不存在")
+	}
+	if key.signKey == nil {
+		return errors.New("JWT签名密钥未配置私钥")
+	}
+
+	jwtKeys.Store(set)
+	if Logger != nil {
+		Logger.Info("JWT密钥已加载",
+			zap.String("signingKid", set.signingKid),
+			zap.String("algorithm", key.method.Alg()),
+			zap.Int("keys", len(set.keys)))
+	}
+	return nil
+}
+
+// loadJWTKey 根据算法加载 HMAC 密钥或 PEM 格式的非对称密钥
+func loadJWTKey(conf config.JWTKey) (*jwtKey, error) {
+	alg := conf.Algorithm
+	if alg == "" {
+		alg = jwt.SigningMethodHS256.Alg()
+	}
+	method := jwt.GetSigningMethod(alg)
+	if method == nil || method == jwt.SigningMethodNone {
+		return nil, fmt.Errorf("不支持的签名算法: %s", alg)
+	}
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		return &jwtKey{method: method, signKey: []byte(conf.Secret), verifyKey: []byte(conf.Secret)}, nil
+	}
+
+	key := &jwtKey{method: method}
+	if conf.PrivateKeyFile != "" {
+		data, err := os.ReadFile(conf.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var signer crypto.Signer
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			signer, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+		case *jwt.SigningMethodECDSA:
+			signer, err = jwt.ParseECPrivateKeyFromPEM(data)
+		case *jwt.SigningMethodEd25519:
+			var priv crypto.PrivateKey
+			priv, err = jwt.ParseEdPrivateKeyFromPEM(data)
+			if err == nil {
+				signer = priv.(ed25519.PrivateKey)
+			}
+		default:
+			err = fmt.Errorf("不支持的签名算法: %s", alg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		key.signKey = signer
+		key.verifyKey = signer.Public()
+	}
+
+	if conf.PublicKeyFile != "" {
+		data, err := os.ReadFile(conf.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+		case *jwt.SigningMethodECDSA:
+			key.verifyKey, err = jwt.ParseECPublicKeyFromPEM(data)
+		case *jwt.SigningMethodEd25519:
+			key.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(data)
+		default:
+			err = fmt.Errorf("不支持的签名算法: %s", alg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if key.verifyKey == nil {
+		return nil, errors.New("未配置PEM密钥文件")
+	}
+	return key, nil
+}
+
+// toJWK 将非对称公钥转换为 JWK，HMAC 密钥不公开
+func toJWK(kid string, key *jwtKey) (JSONWebKey, bool) {
+	jwk := JSONWebKey{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+	enc := base64.RawURLEncoding
+
+	switch pub := key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = enc.EncodeToString(pub.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = enc.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = enc.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = enc.EncodeToString(pub)
+	default:
+		return JSONWebKey{}, false
+	}
+	return jwk, true
+}
+
+// AccessTokenTTL 返回访问令牌有效期
+func AccessTokenTTL() time.Duration {
+	return currentJWTKeys().expire
+}
+
+// JWKS 返回当前所有非对称公钥，供其他服务校验令牌
+func JWKS() JSONWebKeySet {
+	return currentJWTKeys().jwks
+}
+
+func currentJWTKeys() *jwtKeySet {
+	set := jwtKeys.Load()
+	if set == nil {
+		panic("JWT密钥未初始化")
+	}
+	return set
+}
+
+// signToken 使用当前签名密钥签名，并在头部写入 kid
+func signToken(claims jwt.Claims) (string, error) {
+	set := currentJWTKeys()
+	key := set.keys[set.signingKid]
+	token := jwt.NewWithClaims(key.method, claims)
+	if set.signingKid != "" {
+		token.Header["kid"] = set.signingKid
+	}
+	return token.SignedString(key.signKey)
+}
+
+// verificationKey 根据令牌头部的 kid 选择校验密钥，并要求签名算法与密钥配置一致
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := currentJWTKeys().keys[kid]
+	if !ok {
+		Logger.Warn("未知的密钥", zap.String("kid", kid))
+		return nil, errors.New("未知的密钥")
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		Logger.Warn("无效的签名方法",
+			zap.String("kid", kid),
+			zap.String("method", token.Method.Alg()))
+		return nil, errors.New("无效的签名方法")
+	}
+	return key.verifyKey, nil
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"errors"
+	"fastgin/internal/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptStore 登录失败计数存储
+type LoginAttemptStore interface {
+	// Get 返回指定 key 的失败记录，不存在时返回 nil
+	Get(key string) (*model.LoginAttempt, error)
+	// Update 原子地读取失败记录（不存在时从空记录开始），由 fn 修改后保存并返回修改后的记录，
+	// 并发的失败请求依次执行，不会丢失计数
+	Update(key string, fn func(attempt *model.LoginAttempt)) (*model.LoginAttempt, error)
+	// Delete 清除失败记录
+	Delete(key string) error
+}
+
+// AttemptStore 全局登录失败计数存储，默认使用内存实现
+var AttemptStore LoginAttemptStore = NewMemoryLoginAttemptStore()
+
+// InitLoginAttemptStore 根据配置初始化登录失败计数存储
+func InitLoginAttemptStore(db *gorm.DB, driver string) {
+	switch driver {
+	case "memory":
+		AttemptStore = NewMemoryLoginAttemptStore()
+	default:
+		AttemptStore = NewDBLoginAttemptStore(db)
+	}
+}
+
+// MemoryLoginAttemptStore 基于内存的失败计数存储，仅适用于单实例部署
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]model.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]model.LoginAttempt)}
+}
+
+func (s *MemoryLoginAttemptStore) Get(key string) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) Update(key string, fn func(attempt *model.LoginAttempt)) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = model.LoginAttempt{Key: key, FirstFailedAt: time.Now()}
+	}
+	fn(&attempt)
+	s.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// DBLoginAttemptStore 基于数据库的失败计数存储，多实例部署时共享计数
+type DBLoginAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewDBLoginAttemptStore(db *gorm.DB) *DBLoginAttemptStore {
+	return &DBLoginAttemptStore{db: db}
+}
+
+func (s *DBLoginAttemptStore) Get(key string) (*model.LoginAttempt, error) {
+	var attempt model.LoginAttempt
+	err := s.db.Where("attempt_key = ?", key).First(&attempt).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// Update 先确保记录存在，再在事务中加行锁（SELECT ... FOR UPDATE）读取，其他实例的并发请求会等待当前事务提交
+func (s *DBLoginAttemptStore) Update(key string, fn func(attempt *model.LoginAttempt)) (*model.LoginAttempt, error) {
+	var attempt model.LoginAttempt
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "attempt_key"}},
+			DoNothing: true,
+		}).Create(&model.LoginAttempt{Key: key, FirstFailedAt: time.Now()}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("attempt_key = ?", key).First(&attempt).Error
+		if err != nil {
+			return err
+		}
+		fn(&attempt)
+		return tx.Save(&attempt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (s *DBLoginAttemptStore) Delete(key string) error {
+	return s.db.Where("attempt_key = ?", key).Delete(&model.LoginAttempt{}).Error
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"errors"
+	"fastgin/internal/model"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTokenUserNotFound 令牌所属用户不存在（已被删除）
+var ErrTokenUserNotFound = errors.New("令牌所属用户不存在")
+
+// RevocationStore 令牌吊销存储
+// 既支持按 jti 吊销单个令牌，也支持为用户设置水位线，使其之前签发的所有令牌失效
+type RevocationStore interface {
+	// Revoke 吊销指定 jti 的令牌，expiresAt 之后记录可被清理
+	Revoke(jti string, expiresAt time.Time) error
+	// IsRevoked 判断指定 jti 的令牌是否已被吊销
+	IsRevoked(jti string) (bool, error)
+	// SetUserWatermark 使用户在 t 之前签发的令牌全部失效
+	SetUserWatermark(userID uint, t time.Time) error
+	// UserWatermark 返回用户的令牌水位线，未设置时返回零值
+	UserWatermark(userID uint) (time.Time, error)
+}
+
+// TokenStore 全局令牌吊销存储，默认使用内存实现
+var TokenStore RevocationStore = NewMemoryRevocationStore()
+
+// InitRevocationStore 根据配置初始化令牌吊销存储
+func InitRevocationStore(db *gorm.DB, driver string) {
+	switch driver {
+	case "memory":
+		TokenStore = NewMemoryRevocationStore()
+	default:
+		TokenStore = NewDBRevocationStore(db)
+	}
+}
+
+// MemoryRevocationStore 基于内存的吊销存储，仅适用于单实例部署
+type MemoryRevocationStore struct {
+	mu         sync.RWMutex
+	revoked    map[string]time.Time
+	watermarks map[uint]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked:    make(map[string]time.Time),
+		watermarks: make(map[uint]time.Time),
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 顺便清理已过期的记录
+	now := time.Now()
+	for k, exp := range s.revoked {
+		if now.After(exp) {
+			delete(s.revoked, k)
+		}
+	}
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.revoked[jti]
+	return ok, nil
+}
+
+func (s *MemoryRevocationStore) SetUserWatermark(userID uint, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watermarks[userID] = t
+	return nil
+}
+
+func (s *MemoryRevocationStore) UserWatermark(userID uint) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.watermarks[userID], nil
+}
+
+// DBRevocationStore 基于数据库的吊销存储，多实例部署时共享吊销状态
+type DBRevocationStore struct {
+	db *gorm.DB
+}
+
+func NewDBRevocationStore(db *gorm.DB) *DBRevocationStore {
+	return &DBRevocationStore{db: db}
+}
+
+func (s *DBRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	if err := s.db.Where("expires_at < ?", time.Now()).Delete(&model.RevokedToken{}).Error; err != nil {
+		Logger.Warn("清理过期的吊销记录失败", zap.Error(err))
+	}
+
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.RevokedToken{
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+	}).Error
+}
+
+func (s *DBRevocationStore) IsRevoked(jti string) (bool, error) {
+	var count int64
+	err := s.db.Model(&model.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *DBRevocationStore) SetUserWatermark(userID uint, t time.Time) error {
+	return s.db.Model(&model.User{}).Where("id = ?", userID).Update("tokens_invalid_before", t).Error
+}
+
+func (s *DBRevocationStore) UserWatermark(userID uint) (time.Time, error) {
+	var user model.User
+	err := s.db.Select("id", "tokens_invalid_before").First(&user, userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, ErrTokenUserNotFound
+		}
+		return time.Time{}, err
+	}
+	if user.TokensInvalidBefore == nil {
+		return time.Time{}, nil
+	}
+	return *user.TokensInvalidBefore, nil
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"errors"
+	"fastgin/internal/model"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval 会话最后活跃时间的更新间隔，避免每个请求都写数据库
+const sessionTouchInterval = time.Minute
+
+// SessionStore 登录会话存储
+type SessionStore interface {
+	// Get 返回指定会话，不存在时返回 nil
+	Get(sessionID string) (*model.UserSession, error)
+	// Touch 更新会话最后活跃时间
+	Touch(sessionID string, t time.Time) error
+}
+
+// UserSessions 全局登录会话存储，未初始化时不校验会话
+var UserSessions SessionStore
+
+// InitSessionStore 初始化登录会话存储
+func InitSessionStore(db *gorm.DB) {
+	UserSessions = NewDBSessionStore(db)
+}
+
+// DBSessionStore 基于数据库的会话存储
+type DBSessionStore struct {
+	db *gorm.DB
+}
+
+func NewDBSessionStore(db *gorm.DB) *DBSessionStore {
+	return &DBSessionStore{db: db}
+}
+
+func (s *DBSessionStore) Get(sessionID string) (*model.UserSession, error) {
+	var session model.UserSession
+	err := s.db.Where("session_id = ?", sessionID).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *DBSessionStore) Touch(sessionID string, t time.Time) error {
+	return s.db.Model(&model.UserSession{}).Where("session_id = ?", sessionID).Update("last_seen_at", t).Error
+}
+
+// checkSession 校验令牌所属会话未被终止，并按间隔更新最后活跃时间
+func checkSession(claims *JWTClaims) error {
+	if claims.SessionID == "" || UserSessions == nil {
+		return nil
+	}
+
+	session, err := UserSessions.Get(claims.SessionID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if session == nil || session.UserID != claims.UserID || !session.IsActive(now) {
+		return errors.New("会话已终止")
+	}
+
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := UserSessions.Touch(session.SessionID, now); err != nil {
+			Logger.Error("更新会话活跃时间失败", zap.String("sessionID", session.SessionID), zap.Error(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey 个人访问令牌，只保存完整密钥的哈希和用于识别的前缀
+type APIKey struct {
+	gorm.Model
+	UserID  uint   `gorm:"index;not null" json:"user_id"`
+	User    User   `gorm:"foreignKey:UserID" json:"-"`
+	Name    string `gorm:"type:varchar(64);not null" json:"name"`
+	Prefix  string `gorm:"type:varchar(16);index;not null" json:"prefix"`
+	KeyHash string `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	// Scopes 以空格分隔的权限范围，格式为 METHOD:/path，为空表示继承所属用户角色的全部权限
+	Scopes     string     `gorm:"type:varchar(1024)" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// ScopeList 返回权限范围列表
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// IsActive 判断密钥是否未吊销且未过期
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// AuthzDecision 抽样记录的鉴权决策，用于排查用户没有权限或权限过大的问题
+type AuthzDecision struct {
+	ID       uint   `gorm:"primarykey" json:"id"`
+	TenantID uint   `gorm:"index;not null" json:"tenant_id"`
+	UserID   uint   `gorm:"index;not null" json:"user_id"`
+	APIKeyID uint   `gorm:"not null;default:0" json:"api_key_id"`
+	Subject  string `gorm:"type:varchar(64);not null" json:"sub"`
+	Domain   string `gorm:"type:varchar(64);not null" json:"dom"`
+	Object   string `gorm:"type:varchar(255);not null" json:"obj"`
+	Action   string `gorm:"type:varchar(16);not null" json:"act"`
+	Allowed  bool   `gorm:"not null" json:"allowed"`
+	// Matched 命中的策略，逗号分隔，没有命中时为空
+	Matched string `gorm:"type:varchar(512)" json:"matched"`
+	// Reason 拒绝原因：no_policy 没有命中任何策略，api_key_scope 超出 API Key 的权限范围
+	Reason    string    `gorm:"type:varchar(32)" json:"reason"`
+	IP        string    `gorm:"type:varchar(64)" json:"ip"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+func (AuthzDecision) TableName() string {
+	return "authz_decisions"
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Captcha 登录验证码，只保存答案，校验一次后删除
+type Captcha struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CaptchaID string    `gorm:"type:varchar(32);uniqueIndex;not null" json:"captcha_id"`
+	Answer    string    `gorm:"type:varchar(16);not null" json:"-"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// CasbinChange 策略变更记录，多实例部署时其他节点轮询该表增量更新内存中的策略
+type CasbinChange struct {
+	ID        uint      `gorm:"primarykey"`
+	Node      string    `gorm:"type:varchar(64);not null"`
+	Payload   string    `gorm:"type:text;not null"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (CasbinChange) TableName() string {
+	return "casbin_change"
+}
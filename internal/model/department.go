@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// 数据权限范围
+const (
+	// DataScopeAll 租户内的全部数据
+	DataScopeAll = "all"
+	// DataScopeDept 本部门及下级部门的数据
+	DataScopeDept = "dept"
+	// DataScopeCustom 指定部门的数据
+	DataScopeCustom = "custom"
+	// DataScopeSelf 仅本人的数据
+	DataScopeSelf = "self"
+)
+
+// Department 租户内的部门，ParentID 为 0 时是顶级部门
+type Department struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	TenantID  uint      `gorm:"index;not null" json:"tenant_id"`
+	ParentID  uint      `gorm:"index;not null;default:0" json:"parent_id"`
+	Name      string    `gorm:"type:varchar(64);not null" json:"name"`
+	Sort      int       `gorm:"not null;default:0" json:"sort"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RoleDataScope 角色在租户内可以访问的数据范围，Scope 为 DataScopeCustom 时可以访问 Departments 中的部门
+type RoleDataScope struct {
+	ID          uint         `gorm:"primarykey" json:"id"`
+	TenantID    uint         `gorm:"uniqueIndex:idx_role_data_scope;not null" json:"tenant_id"`
+	Role        string       `gorm:"type:varchar(64);uniqueIndex:idx_role_data_scope;not null" json:"role"`
+	Scope       string       `gorm:"type:varchar(16);not null" json:"scope"`
+	Departments []Department `gorm:"many2many:role_data_scope_departments" json:"-"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+func (Department) TableName() string {
+	return "departments"
+}
+
+func (RoleDataScope) TableName() string {
+	return "role_data_scopes"
+}
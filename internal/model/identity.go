@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity 本地用户与外部身份提供方账号的关联
+type UserIdentity struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null" json:"user_id"`
+	Provider string `gorm:"type:varchar(32);uniqueIndex:idx_provider_subject;not null" json:"provider"`
+	Subject  string `gorm:"type:varchar(255);uniqueIndex:idx_provider_subject;not null" json:"subject"`
+	Email    string `gorm:"type:varchar(128)" json:"email"`
+}
+
+// OAuthState 授权码流程中待完成的登录请求，回调时校验 state 并取回 nonce 和 PKCE 校验码
+type OAuthState struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	State        string    `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Provider     string    `gorm:"type:varchar(32);not null" json:"provider"`
+	Nonce        string    `gorm:"type:varchar(64);not null" json:"-"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null" json:"-"`
+	ExpiresAt    time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (OAuthState) TableName() string {
+	return "oauth_states"
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// LoginAttempt 登录失败计数，Key 为 user:<用户名> 或 ip:<地址>
+type LoginAttempt struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	Key           string     `gorm:"column:attempt_key;type:varchar(160);uniqueIndex;not null" json:"key"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	Lockouts      int        `gorm:"not null;default:0" json:"lockouts"`
+	FirstFailedAt time.Time  `json:"first_failed_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
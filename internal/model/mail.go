@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+const (
+	MailStatusPending = "pending"
+	MailStatusSent    = "sent"
+	MailStatusFailed  = "failed"
+)
+
+// MailOutbox 待发送的邮件，与业务数据在同一事务中写入，由后台任务发送
+type MailOutbox struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	To            string     `gorm:"column:recipient;type:varchar(128);index;not null" json:"to"`
+	Subject       string     `gorm:"type:varchar(255);not null" json:"subject"`
+	Body          string     `gorm:"type:text;not null" json:"-"`
+	Status        string     `gorm:"type:varchar(16);index;not null" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	LastError     string     `gorm:"type:varchar(512)" json:"last_error"`
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (MailOutbox) TableName() string {
+	return "mail_outbox"
+}
+
+// PasswordResetToken 找回密码令牌，仅存储哈希值，使用一次后失效
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,83 @@
+package model
+
+import "time"
+
+// 菜单类型
+const (
+	// MenuTypeDirectory 目录，只用于组织下级菜单
+	MenuTypeDirectory = "directory"
+	// MenuTypeMenu 菜单，对应前端的一个页面
+	MenuTypeMenu = "menu"
+	// MenuTypeButton 按钮，页面内的操作权限，上级必须是菜单
+	MenuTypeButton = "button"
+)
+
+// Menu 前端菜单和按钮权限，所有租户共用，ParentID 为 0 时是顶级菜单
+type Menu struct {
+	ID       uint   `gorm:"primarykey" json:"id"`
+	ParentID uint   `gorm:"index;not null;default:0" json:"parent_id"`
+	Type     string `gorm:"type:varchar(16);not null" json:"type"`
+	// Name 前端路由名称
+	Name  string `gorm:"type:varchar(64);not null;default:''" json:"name"`
+	Title string `gorm:"type:varchar(64);not null" json:"title"`
+	// Path、Component、Redirect 前端路由配置，按钮没有
+	Path      string `gorm:"type:varchar(255);not null;default:''" json:"path"`
+	Component string `gorm:"type:varchar(255);not null;default:''" json:"component"`
+	Redirect  string `gorm:"type:varchar(255);not null;default:''" json:"redirect"`
+	Icon      string `gorm:"type:varchar(64);not null;default:''" json:"icon"`
+	// Permission 按钮的权限标识，例如 user:create，前端据此控制按钮是否显示
+	Permission string `gorm:"type:varchar(64);not null;default:''" json:"permission"`
+	Sort       int    `gorm:"not null;default:0" json:"sort"`
+	Hidden     bool   `gorm:"not null;default:false" json:"hidden"`
+	KeepAlive  bool   `gorm:"not null;default:false" json:"keep_alive"`
+	// Disabled 禁用的菜单不会返回给前端，但绑定的接口权限仍然保留
+	Disabled bool `gorm:"not null;default:false" json:"disabled"`
+	// APIs 菜单绑定的接口权限，分配菜单时同步为角色的 p 策略
+	APIs      []MenuAPI `gorm:"constraint:OnDelete:CASCADE" json:"apis"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MenuAPI 菜单或按钮需要访问的接口，Path 和 Method 与 p 策略的 obj 和 act 相同
+type MenuAPI struct {
+	ID     uint   `gorm:"primarykey" json:"-"`
+	MenuID uint   `gorm:"uniqueIndex:idx_menu_api;not null" json:"-"`
+	Method string `gorm:"type:varchar(16);uniqueIndex:idx_menu_api;not null" json:"method"`
+	Path   string `gorm:"type:varchar(255);uniqueIndex:idx_menu_api;not null" json:"path"`
+}
+
+// RoleMenu 角色在域内可以使用的菜单和按钮
+type RoleMenu struct {
+	ID        uint   `gorm:"primarykey"`
+	Domain    string `gorm:"type:varchar(64);uniqueIndex:idx_role_menu;not null"`
+	Role      string `gorm:"type:varchar(64);uniqueIndex:idx_role_menu;not null"`
+	MenuID    uint   `gorm:"uniqueIndex:idx_role_menu;index;not null"`
+	CreatedAt time.Time
+}
+
+// MenuPolicy 菜单同步添加的 p 策略。分配菜单时已存在的策略（如通过 /api/rbac 添加的）不会记录，
+// 取消分配、修改或删除菜单时只移除这里记录的策略
+type MenuPolicy struct {
+	ID        uint   `gorm:"primarykey"`
+	Domain    string `gorm:"type:varchar(64);uniqueIndex:idx_menu_policy;not null"`
+	Role      string `gorm:"type:varchar(64);uniqueIndex:idx_menu_policy;index;not null"`
+	Path      string `gorm:"type:varchar(255);uniqueIndex:idx_menu_policy;not null"`
+	Method    string `gorm:"type:varchar(16);uniqueIndex:idx_menu_policy;not null"`
+	CreatedAt time.Time
+}
+
+func (Menu) TableName() string {
+	return "menus"
+}
+
+func (MenuAPI) TableName() string {
+	return "menu_apis"
+}
+
+func (RoleMenu) TableName() string {
+	return "role_menus"
+}
+
+func (MenuPolicy) TableName() string {
+	return "menu_policies"
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+)
+
+// UserMFA 用户的 TOTP 两步验证设置
+type UserMFA struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	UserID         uint       `gorm:"uniqueIndex;not null" json:"user_id"`
+	Secret         string     `gorm:"type:varchar(64);not null" json:"-"`
+	Enabled        bool       `gorm:"not null;default:false" json:"enabled"`
+	EnabledAt      *time.Time `json:"enabled_at"`
+	LastUsedStep   int64      `gorm:"not null;default:0" json:"-"` // 最近一次使用的时间步，防止验证码重放
+	FailedAttempts int        `gorm:"not null;default:0" json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// MFARecoveryCode 一次性恢复码，仅存储哈希值
+type MFARecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"type:varchar(64);not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MFARolePolicy 要求指定角色必须启用两步验证
+type MFARolePolicy struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Role      string    `gorm:"type:varchar(16);uniqueIndex;not null" json:"role"`
+	Required  bool      `gorm:"not null;default:false" json:"required"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+func (MFARolePolicy) TableName() string {
+	return "mfa_role_policies"
+}
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// 角色状态
+const (
+	RoleStatusEnabled  = "enabled"
+	RoleStatusDisabled = "disabled"
+)
+
+// Role 角色，所有租户共用，Code 为 Casbin 策略中的角色名；禁用的角色不能分配，引用该角色的 g 策略全部失效
+type Role struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Code        string    `gorm:"type:varchar(64);uniqueIndex;not null" json:"code"`
+	Name        string    `gorm:"type:varchar(64);not null" json:"name"`
+	Description string    `gorm:"type:varchar(255);not null;default:''" json:"description"`
+	Status      string    `gorm:"type:varchar(16);not null;default:'enabled'" json:"status"`
+	Sort        int       `gorm:"not null;default:0" json:"sort"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+// RoleSuspendedGrouping 角色禁用时移除的、不是由用户角色分配产生的 g 策略（跨租户授权、角色继承），启用角色时恢复
+type RoleSuspendedGrouping struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Role      string    `gorm:"type:varchar(64);index;not null" json:"role"`
+	Subject   string    `gorm:"type:varchar(64);index;not null" json:"subject"`
+	Domain    string    `gorm:"type:varchar(64);not null" json:"domain"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (RoleSuspendedGrouping) TableName() string {
+	return "role_suspended_groupings"
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// UserSession 登录会话，每次登录创建一条记录，刷新令牌时更新当前访问令牌
+type UserSession struct {
+	ID uint `gorm:"primarykey" json:"-"`
+	// SessionID 会话标识，与刷新令牌家族 ID 相同，并写入访问令牌的 sid 声明
+	SessionID  string     `gorm:"type:varchar(32);uniqueIndex;not null" json:"session_id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+	UserAgent  string     `gorm:"type:varchar(255)" json:"user_agent"`
+	IP         string     `gorm:"type:varchar(64)" json:"ip"`
+	JTI        string     `gorm:"column:jti;type:varchar(64)" json:"jti"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// IsActive 判断会话是否未被终止且未过期
+func (s *UserSession) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
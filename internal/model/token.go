@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken 服务端保存的刷新令牌，仅存储哈希值
+// 同一次登录派生出的所有刷新令牌属于同一个 FamilyID，用于重用检测
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	FamilyID  string     `gorm:"type:varchar(64);index;not null" json:"family_id"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// IsExpired 判断刷新令牌是否过期
+func (t *RefreshToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// RevokedToken 已吊销的访问令牌，过期后可清理
+type RevokedToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	JTI       string    `gorm:"column:jti;type:varchar(64);uniqueIndex;not null" json:"jti"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -1,30 +1,59 @@
 package model
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"fastgin/internal/utils"
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// DefaultTenantID 默认租户，启用多租户前的用户、自助注册和第三方登录创建的用户属于该租户
+const DefaultTenantID uint = 1
+
 type User struct {
 	gorm.Model
-	Username string `gorm:"type:varchar(32);uniqueIndex;not null" json:"username"`
-	Password string `gorm:"type:varchar(128);not null" json:"-"`
-	Role     string `gorm:"type:varchar(16);not null;default:'user'" json:"role"`
+	// TenantID 所属租户，只能管理同一租户内的用户
+	TenantID uint `gorm:"index;not null;default:1" json:"tenant_id"`
+	// DepartmentID 所属部门，0 表示未分配部门，用于数据权限
+	DepartmentID uint   `gorm:"index;not null;default:0" json:"department_id"`
+	Username     string `gorm:"type:varchar(32);uniqueIndex;not null" json:"username"`
+	Password     string `gorm:"type:varchar(128);not null" json:"-"`
+	// Role 主角色，用于令牌中的 role 声明，同时包含在 Roles 中
+	Role string `gorm:"type:varchar(64);not null;default:'user'" json:"role"`
+	// Roles 用户的全部角色，同步为用户所属租户内的 g 策略
+	Roles []Role `gorm:"many2many:user_roles" json:"roles,omitempty"`
+	// Email 统一保存为小写，用于找回密码；没有邮箱时为 NULL，唯一索引不限制多个 NULL
+	Email           *string    `gorm:"type:varchar(128);uniqueIndex:idx_users_email_unique" json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// PendingActivation 自助注册后尚未验证邮箱，不能登录
+	PendingActivation bool `gorm:"not null;default:false" json:"pending_activation"`
+	// TokensInvalidBefore 在此时间之前签发的令牌全部失效
+	TokensInvalidBefore *time.Time `json:"-"`
+	// MustChangePassword 初始账号或管理员重置密码后，用户必须先修改密码才能访问其他接口
+	MustChangePassword bool `gorm:"not null;default:false" json:"must_change_password"`
 }
 
-// HashPassword 将明文密码加密
+// HashPassword 使用当前配置的算法将明文密码加密
 func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+	return utils.HashPassword(password)
+}
+
+// EmailAddress 用户的邮箱，没有邮箱时返回空字符串
+func (u *User) EmailAddress() string {
+	if u.Email == nil {
+		return ""
 	}
-	return string(hashedBytes), nil
+	return *u.Email
 }
 
-// CheckPassword 检查密码是否正确
+// CheckPassword 检查密码是否正确，兼容旧算法生成的哈希
 func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
+	return utils.VerifyPassword(u.Password, password)
+}
+
+// PasswordNeedsRehash 密码哈希的算法或参数与当前配置不一致时返回 true
+func (u *User) PasswordNeedsRehash() bool {
+	return utils.PasswordNeedsRehash(u.Password)
 }
 
 // HashPassword 为用户设置加密后的密码
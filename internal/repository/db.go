@@ -3,7 +3,11 @@ package repository
 import (
 	"fastgin/config"
 	"fastgin/internal/model"
+	"fastgin/internal/utils"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -24,8 +28,42 @@ func InitDB() (error, *gorm.DB) {
 	var err error
 	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
 
+	// 邮箱改为唯一索引前先整理已有数据
+	if err := migrateUserEmail(DB); err != nil {
+		panic("数据库迁移失败: " + err.Error())
+	}
+	if err := migrateMenuPolicies(DB); err != nil {
+		panic("数据库迁移失败: " + err.Error())
+	}
+
 	// 自动迁移
-	err = DB.AutoMigrate(&model.User{})
+	err = DB.AutoMigrate(
+		&model.User{},
+		&model.RefreshToken{},
+		&model.RevokedToken{},
+		&model.UserIdentity{},
+		&model.OAuthState{},
+		&model.UserMFA{},
+		&model.MFARecoveryCode{},
+		&model.MFARolePolicy{},
+		&model.LoginAttempt{},
+		&model.PasswordHistory{},
+		&model.APIKey{},
+		&model.UserSession{},
+		&model.Captcha{},
+		&model.MailOutbox{},
+		&model.PasswordResetToken{},
+		&model.CasbinChange{},
+		&model.Department{},
+		&model.RoleDataScope{},
+		&model.AuthzDecision{},
+		&model.Menu{},
+		&model.MenuAPI{},
+		&model.RoleMenu{},
+		&model.MenuPolicy{},
+		&model.Role{},
+		&model.RoleSuspendedGrouping{},
+	)
 	if err != nil {
 		panic("数据库迁移失败: " + err.Error())
 	}
@@ -34,14 +72,107 @@ func InitDB() (error, *gorm.DB) {
 	var adminCount int64
 	DB.Model(&model.User{}).Where("role = ?", "admin").Count(&adminCount)
 	if adminCount == 0 {
+		password, generated, err := initialAdminPassword()
+		if err != nil {
+			panic("读取初始管理员密码失败: " + err.Error())
+		}
 		admin := model.User{
-			Username: "admin",
-			Password: "123456",
-			Role:     "admin",
+			TenantID:           model.DefaultTenantID,
+			Username:           "admin",
+			Password:           password,
+			Role:               "admin",
+			MustChangePassword: true,
 		}
 		admin.HashPassword()
 		DB.Create(&admin)
+		if generated {
+			// 随机生成的密码只在首次启动时输出一次，不写入日志文件
+			fmt.Printf("\n已创建初始管理员账户 admin，密码: %s\n首次登录后必须修改密码\n\n", password)
+		}
+	}
+
+	// 旧版本创建的默认管理员仍在使用 123456 时，要求下次登录后修改密码
+	var legacyAdmin model.User
+	if DB.Where("username = ? AND must_change_password = ?", "admin", false).First(&legacyAdmin).Error == nil &&
+		legacyAdmin.CheckPassword(legacyAdminPassword) {
+		DB.Model(&legacyAdmin).Update("must_change_password", true)
 	}
 
 	return err, DB
 }
+
+// migrateUserEmail 邮箱改为唯一索引：空字符串和已删除用户的邮箱改为 NULL，删除原来的普通索引。
+// 多个用户使用相同邮箱时无法自动处理，返回错误，需要先手动修改
+func migrateUserEmail(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&model.User{}) {
+		return nil
+	}
+	err := db.Model(&model.User{}).Unscoped().
+		Where("email = ? OR deleted_at IS NOT NULL", "").
+		Update("email", nil).Error
+	if err != nil {
+		return err
+	}
+
+	var duplicates []string
+	err = db.Model(&model.User{}).Where("email IS NOT NULL").
+		Group("email").Having("COUNT(*) > 1").Pluck("email", &duplicates).Error
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("以下邮箱被多个用户使用，请修改后再启动: %s", strings.Join(duplicates, ", "))
+	}
+
+	if m.HasIndex(&model.User{}, "idx_users_email") {
+		return m.DropIndex(&model.User{}, "idx_users_email")
+	}
+	return nil
+}
+
+// migrateMenuPolicies 首次创建 menu_policies 时，把已分配菜单的接口对应的现有 p 策略记为菜单同步添加，
+// 升级前菜单同步添加的策略在取消分配菜单后仍然会被移除
+func migrateMenuPolicies(db *gorm.DB) error {
+	m := db.Migrator()
+	if m.HasTable(&model.MenuPolicy{}) || !m.HasTable(&model.RoleMenu{}) || !m.HasTable("casbin_rule") {
+		return nil
+	}
+	if err := m.CreateTable(&model.MenuPolicy{}); err != nil {
+		return err
+	}
+	return db.Exec(`INSERT INTO menu_policies (domain, role, path, method, created_at)
+		SELECT DISTINCT role_menus.domain, role_menus.role, menu_apis.path, menu_apis.method, ?
+		FROM role_menus
+		JOIN menu_apis ON menu_apis.menu_id = role_menus.menu_id
+		JOIN casbin_rule ON casbin_rule.ptype = 'p' AND casbin_rule.v0 = role_menus.role AND casbin_rule.v1 = role_menus.domain
+			AND casbin_rule.v2 = menu_apis.path AND casbin_rule.v3 = menu_apis.method`, time.Now()).Error
+}
+
+const (
+	// AdminPasswordEnv 初始管理员密码的环境变量
+	AdminPasswordEnv = "FASTGIN_ADMIN_PASSWORD"
+	// AdminPasswordFileEnv 保存初始管理员密码的文件路径，适用于 Docker/Kubernetes secret
+	AdminPasswordFileEnv = "FASTGIN_ADMIN_PASSWORD_FILE"
+
+	legacyAdminPassword = "123456"
+)
+
+// initialAdminPassword 依次从环境变量、密码文件读取初始管理员密码，都未配置时随机生成
+func initialAdminPassword() (password string, generated bool, err error) {
+	if password = os.Getenv(AdminPasswordEnv); password != "" {
+		return password, false, nil
+	}
+	if file := os.Getenv(AdminPasswordFileEnv); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, err
+		}
+		if password = strings.TrimSpace(string(data)); password == "" {
+			return "", false, fmt.Errorf("初始管理员密码文件为空: %s", file)
+		}
+		return password, false, nil
+	}
+	password, err = utils.RandomToken(12)
+	return password, true, err
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"fastgin/internal/model"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// legacyUser 邮箱改为唯一索引之前的用户表
+type legacyUser struct {
+	gorm.Model
+	Username string `gorm:"type:varchar(32);uniqueIndex;not null"`
+	Password string `gorm:"type:varchar(128);not null"`
+	Email    string `gorm:"type:varchar(128);index"`
+}
+
+func (legacyUser) TableName() string { return "users" }
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := db.AutoMigrate(&legacyUser{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrateUserEmail(t *testing.T) {
+	db := openTestDB(t)
+	users := []legacyUser{
+		{Username: "alice", Email: "alice@example.com"},
+		{Username: "bob"},
+		{Username: "carol"},
+		{Username: "dave", Email: "shared@example.com"},
+		{Username: "erin", Email: "shared@example.com"},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 已删除用户的邮箱释放给其他用户
+	if err := db.Delete(&users[4]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateUserEmail(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.User{}); err != nil {
+		t.Fatal(err)
+	}
+	var noEmail int64
+	db.Model(&model.User{}).Unscoped().Where("email IS NULL").Count(&noEmail)
+	if noEmail != 3 {
+		t.Errorf("%d users without email, want 3", noEmail)
+	}
+	if db.Migrator().HasIndex(&model.User{}, "idx_users_email") {
+		t.Error("legacy email index not dropped")
+	}
+	email := "alice@example.com"
+	if err := db.Create(&model.User{Username: "mallory", Password: "x", Email: &email}).Error; err == nil {
+		t.Error("duplicate email accepted")
+	}
+	// 再次启动时迁移是幂等的
+	if err := migrateUserEmail(db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateUserEmailDuplicates(t *testing.T) {
+	db := openTestDB(t)
+	users := []legacyUser{
+		{Username: "alice", Email: "shared@example.com"},
+		{Username: "bob", Email: "shared@example.com"},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateUserEmail(db); err == nil {
+		t.Fatal("duplicate emails migrated without error")
+	}
+}
+
+func TestMigrateMenuPolicies(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&model.Menu{}, &model.MenuAPI{}, &model.RoleMenu{}); err != nil {
+		t.Fatal(err)
+	}
+	err := db.Exec("CREATE TABLE casbin_rule (id integer PRIMARY KEY, ptype text, v0 text, v1 text, v2 text, v3 text, v4 text, v5 text)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	menu := model.Menu{Type: model.MenuTypeMenu, Title: "用户", APIs: []model.MenuAPI{
+		{Method: "GET", Path: "/api/users"},
+		{Method: "POST", Path: "/api/users"},
+	}}
+	if err := db.Create(&menu).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.RoleMenu{Domain: "tenant:1", Role: "editor", MenuID: menu.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// POST 策略已被手动删除，不再记录
+	for _, rule := range [][]string{{"editor", "tenant:1", "/api/users", "GET"}, {"viewer", "tenant:1", "/api/users", "GET"}} {
+		err := db.Exec("INSERT INTO casbin_rule (ptype, v0, v1, v2, v3) VALUES ('p', ?, ?, ?, ?)", rule[0], rule[1], rule[2], rule[3]).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrateMenuPolicies(db); err != nil {
+		t.Fatal(err)
+	}
+	var policies []model.MenuPolicy
+	if err := db.Find(&policies).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 || policies[0].Role != "editor" || policies[0].Path != "/api/users" || policies[0].Method != "GET" {
+		t.Fatalf("menu policies = %+v", policies)
+	}
+
+	// 表已存在时不再回填
+	if err := db.Where("1 = 1").Delete(&model.MenuPolicy{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateMenuPolicies(db); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&model.MenuPolicy{}).Count(&count)
+	if count != 0 {
+		t.Errorf("menu policies backfilled twice: %d", count)
+	}
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"fastgin/internal/api"
+	"fastgin/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthRouter 登录后所有用户均可访问的认证接口，不经过 Casbin 鉴权
+func AuthRouter(r *gin.Engine) {
+	// 必须修改密码的用户也可以访问修改密码接口
+	r.PUT("/api/me/password", middleware.PasswordChangeAuth(), middleware.DenyImpersonation(), api.ChangePassword)
+
+	authenticated := r.Group("/api")
+	authenticated.Use(middleware.JWTAuth())
+	{
+		authenticated.POST("/logout", api.Logout)
+
+		// 当前用户的菜单，模拟登录时返回被模拟用户的菜单
+		authenticated.GET("/me/menus", api.GetMyMenus)
+	}
+
+	// 凭证和会话管理接口，模拟登录时不能访问
+	self := r.Group("/api")
+	self.Use(middleware.JWTAuth())
+	self.Use(middleware.DenyImpersonation())
+	{
+		self.POST("/logout-all", api.LogoutAll)
+
+		// 登录会话自助管理
+		sessions := self.Group("/me/sessions")
+		{
+			sessions.GET("", api.ListMySessions)
+			sessions.DELETE("/others", api.RevokeOtherSessions)
+			sessions.DELETE("/:sessionId", api.RevokeMySession)
+		}
+
+		// API Key 自助管理，只接受访问令牌，避免 API Key 创建权限更大的密钥
+		apiKeys := self.Group("/me/api-keys")
+		{
+			apiKeys.GET("", api.ListAPIKeys)
+			apiKeys.POST("", api.CreateAPIKey)
+			apiKeys.DELETE("/:id", api.RevokeAPIKey)
+		}
+
+		// 两步验证自助管理
+		mfa := self.Group("/mfa")
+		{
+			mfa.GET("", api.GetMFAStatus)
+			mfa.POST("/enroll", api.EnrollMFA)
+			mfa.POST("/enroll/verify", api.ConfirmMFA)
+			mfa.POST("/recovery-codes", api.RegenerateRecoveryCodes)
+			mfa.DELETE("", api.DisableMFA)
+		}
+	}
+}
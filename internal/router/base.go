@@ -4,7 +4,9 @@ import (
 	"fastgin/config"
 	"fastgin/docs" // 这个包会在运行 swag init 后自动生成
 	"fastgin/internal/api"
+	"fastgin/internal/idp"
 	"fastgin/internal/middleware"
+	"fastgin/internal/service"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -22,7 +24,13 @@ func InitRouter(db *gorm.DB, Conf config.Config) *gin.Engine {
 		gin.SetMode(gin.TestMode)
 	}
 
-	r := gin.Default()
+	// 与 gin.Default 相同，另外在最前面注册路由探测中间件，用于生成权限目录
+	r := gin.New()
+	// 只信任配置的代理转发的 X-Forwarded-For，否则客户端可以伪造 IP 绕过按 IP 的登录锁定
+	if err := r.SetTrustedProxies(Conf.Server.TrustedProxies); err != nil {
+		panic(err)
+	}
+	r.Use(routeProbe(), gin.Logger(), gin.Recovery())
 
 	// 注册中间件（调整顺序）
 	r.Use(middleware.Loggers())  // 日志中间件放在最前面
@@ -33,20 +41,89 @@ func InitRouter(db *gorm.DB, Conf config.Config) *gin.Engine {
 	docs.SwaggerInfo.BasePath = "/api"
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// 发布 JWT 校验公钥
+	r.GET("/.well-known/jwks.json", api.JWKS)
+
+	// 初始化令牌吊销存储
+	middleware.InitRevocationStore(db, Conf.JWT.RevocationStore)
+
+	// 初始化登录失败计数存储
+	middleware.InitLoginAttemptStore(db, Conf.Login.Store)
+
+	// 初始化验证码存储
+	middleware.InitCaptchaStore(db, Conf.Captcha.Store)
+
+	// 初始化登录会话存储
+	middleware.InitSessionStore(db)
+
+	// 初始化 API Key 存储
+	middleware.InitAPIKeyStore(db)
+
+	// 注册外部身份提供方
+	idp.InitProviders(Conf.OAuth)
+
 	// 初始化 Casbin
-	Enforcer, err := middleware.NewCasbinMiddleware(db)
+	Enforcer, err := middleware.NewCasbinMiddleware(db, Conf.Casbin)
 	if err != nil {
 		panic(err)
 	}
+	// 多实例部署时同步其他节点的策略变更
+	if err := middleware.InitPolicyWatcher(db, Enforcer, Conf.Casbin.Watcher); err != nil {
+		panic(err)
+	}
+	// 按配置抽样记录鉴权决策
+	middleware.InitDecisionAudit(db, Conf.Casbin.Audit)
+	service.InitRBAC(Enforcer)
+	// 用户通过 g 策略关联角色，启动时补齐 User.Role 对应的角色分配
+	if err := service.SyncUserRoles(); err != nil {
+		panic(err)
+	}
 
 	// 添加公开路由组
 	public := r.Group("/api")
 	{
-		public.POST("/login", api.Login) // 登录接口
+		public.POST("/login", api.Login)                // 登录接口
+		public.GET("/captcha", api.GetCaptcha)          // 登录验证码
+		public.POST("/token/refresh", api.RefreshToken) // 刷新令牌接口
+		public.POST("/login/mfa", api.LoginMFA)         // 两步验证登录
+		public.POST("/login/mfa/setup", api.LoginMFASetup)
+
+		// 自助注册和找回密码
+		public.POST("/register", api.Register)
+		public.GET("/register/verify", api.VerifyEmail)
+		public.POST("/register/resend", api.ResendVerification)
+		public.POST("/password/forgot", api.ForgotPassword)
+		public.POST("/password/reset", api.ResetPassword)
+
+		// 外部身份提供方（SSO）登录
+		public.GET("/oauth/:provider/login", api.OAuthLogin)
+		public.GET("/oauth/:provider/callback", api.OAuthCallback)
 	}
 
+	// 认证模块路由
+	AuthRouter(r)
+
 	// 用户模块路由
 	UserRouter(r, Enforcer)
 
+	// 两步验证管理路由
+	MFARouter(r, Enforcer)
+
+	// 权限策略管理路由
+	RBACRouter(r, Enforcer)
+
+	// 部门和数据权限路由
+	DepartmentRouter(r, Enforcer)
+
+	// 菜单和按钮权限路由
+	MenuRouter(r, Enforcer)
+
+	// 角色管理路由
+	RoleRouter(r, Enforcer)
+
+	// 根据已注册的路由生成权限目录，并检查策略覆盖情况
+	service.InitRouteCatalogue(buildRouteCatalogue(r))
+	checkRouteCoverage()
+
 	return r
 }
@@ -0,0 +1,259 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fastgin/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestRouter 使用独立的 SQLite 数据库初始化完整的路由，configure 可以在初始化前修改配置
+func newTestRouter(t *testing.T, configure func(*config.Config)) *gin.Engine {
+	t.Helper()
+	middleware.Logger = zap.NewNop()
+	conf := config.Config{
+		Login:  config.LoginConfig{Store: "db"},
+		Casbin: config.CasbinConfig{Model: "../../config/rbac_model.conf", DefaultPolicy: "../../config/rbac_policy.csv"},
+	}
+	conf.Casbin.Watcher.Driver = "none"
+	if configure != nil {
+		configure(&conf)
+	}
+	config.GlobalConfig = conf
+	service.InitPasswordHasher(config.PasswordConfig{Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1})
+	if err := middleware.InitJWTKeys(config.JWTConfig{Secret: "test-secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	// SQLite 只允许一个写连接
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	err = db.AutoMigrate(
+		&model.User{},
+		&model.RefreshToken{},
+		&model.RevokedToken{},
+		&model.UserIdentity{},
+		&model.OAuthState{},
+		&model.UserMFA{},
+		&model.MFARecoveryCode{},
+		&model.MFARolePolicy{},
+		&model.LoginAttempt{},
+		&model.PasswordHistory{},
+		&model.APIKey{},
+		&model.UserSession{},
+		&model.Captcha{},
+		&model.CasbinChange{},
+		&model.Department{},
+		&model.RoleDataScope{},
+		&model.AuthzDecision{},
+		&model.Menu{},
+		&model.MenuAPI{},
+		&model.RoleMenu{},
+		&model.MenuPolicy{},
+		&model.Role{},
+		&model.RoleSuspendedGrouping{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.DB = db
+	return InitRouter(db, conf)
+}
+
+// postLogin 从 remoteAddr 提交登录请求，forwardedFor 不为空时设置 X-Forwarded-For
+func postLogin(r *gin.Engine, username, remoteAddr, forwardedFor string) (int, map[string]any) {
+	body, _ := json.Marshal(gin.H{"username": username, "password": "wrong-password"})
+	req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestLoginIPLockoutIgnoresForwardedFor(t *testing.T) {
+	r := newTestRouter(t, func(conf *config.Config) {
+		conf.Login.IPMaxAttempts = 3
+	})
+
+	// 未配置可信代理时，每次伪造不同的 X-Forwarded-For 仍然计入连接的对端地址
+	for i, spoofed := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		if status, _ := postLogin(r, "user"+spoofed, "192.0.2.1:1234", spoofed); status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, status)
+		}
+	}
+	if status, _ := postLogin(r, "another", "192.0.2.1:1234", "203.0.113.4"); status != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For reset the IP counter: status = %d, want 429", status)
+	}
+	if status, _ := postLogin(r, "another", "192.0.2.2:1234", ""); status != http.StatusUnauthorized {
+		t.Errorf("login from another IP: status = %d, want 401", status)
+	}
+}
+
+func TestLoginTrustedProxyForwardedFor(t *testing.T) {
+	r := newTestRouter(t, func(conf *config.Config) {
+		conf.Login.IPMaxAttempts = 3
+		conf.Server.TrustedProxies = []string{"10.0.0.1"}
+	})
+
+	// 可信代理转发的 X-Forwarded-For 作为客户端 IP
+	for i := 0; i < 3; i++ {
+		if status, _ := postLogin(r, "user"+string(rune('a'+i)), "10.0.0.1:1234", "203.0.113.1"); status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, status)
+		}
+	}
+	if status, _ := postLogin(r, "another", "10.0.0.1:1234", "203.0.113.1"); status != http.StatusTooManyRequests {
+		t.Fatalf("forwarded client: status = %d, want 429", status)
+	}
+	if status, _ := postLogin(r, "another", "10.0.0.1:1234", "203.0.113.2"); status != http.StatusUnauthorized {
+		t.Errorf("another client behind the proxy: status = %d, want 401", status)
+	}
+}
+
+func TestLoginCaptchaIgnoresForwardedFor(t *testing.T) {
+	r := newTestRouter(t, func(conf *config.Config) {
+		conf.Captcha = config.CaptchaConfig{Mode: "failures", FailureThreshold: 2}
+	})
+	captchaRequired := func(resp map[string]any) bool {
+		data, _ := resp["data"].(map[string]any)
+		return data["captcha_required"] == true
+	}
+
+	if status, resp := postLogin(r, "alice", "192.0.2.1:1234", "203.0.113.1"); status != http.StatusUnauthorized || captchaRequired(resp) {
+		t.Fatalf("first failure: status = %d, resp = %v", status, resp)
+	}
+	// 更换 X-Forwarded-For 和用户名，同一 IP 的失败次数仍然累计
+	if status, resp := postLogin(r, "bob", "192.0.2.1:1234", "203.0.113.2"); status != http.StatusUnauthorized || !captchaRequired(resp) {
+		t.Fatalf("second failure: status = %d, resp = %v, want captcha_required", status, resp)
+	}
+	if status, resp := postLogin(r, "carol", "192.0.2.1:1234", "203.0.113.3"); status != http.StatusBadRequest || !captchaRequired(resp) {
+		t.Errorf("login without captcha: status = %d, resp = %v, want 400 with captcha_required", status, resp)
+	}
+}
+
+// ipAllowListModel 只允许 10.0.0.0/8 访问的 ABAC 模型
+const ipAllowListModel = `[request_definition]
+r = sub, dom, obj, act, ctx
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && keyMatch(r.dom, p.dom) && keyMatch2(r.obj, p.obj) && (r.act == p.act || p.act == "*") && ipMatch(r.ctx.IP, "10.0.0.0/8")
+`
+
+func TestABACIPMatchIgnoresForwardedFor(t *testing.T) {
+	modelFile := filepath.Join(t.TempDir(), "abac_model.conf")
+	if err := os.WriteFile(modelFile, []byte(ipAllowListModel), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(t, func(conf *config.Config) {
+		conf.Casbin.Model = modelFile
+		conf.Server.TrustedProxies = []string{"10.0.0.1"}
+	})
+	admin := model.User{TenantID: model.DefaultTenantID, Username: "root", Password: "Secret#123", Role: "admin"}
+	if err := admin.HashPassword(); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.DB.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SyncUserRoles(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := service.Login(&service.LoginRequest{Username: "root", Password: "Secret#123"}, service.ClientInfo{IP: "10.0.0.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         int
+	}{
+		{"allowed network", "10.0.0.7:1234", "", http.StatusOK},
+		{"spoofed X-Forwarded-For", "192.0.2.1:1234", "10.0.0.7", http.StatusForbidden},
+		{"trusted proxy forwarding an outside client", "10.0.0.1:1234", "192.0.2.1", http.StatusForbidden},
+		{"trusted proxy forwarding an allowed client", "10.0.0.1:1234", "10.0.0.7", http.StatusOK},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("Authorization", middleware.Bearer+resp.Token)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
+
+func TestRouteCatalogue(t *testing.T) {
+	newTestRouter(t, nil)
+	protected := make(map[string]bool)
+	for _, route := range service.ListRouteCatalogue(service.RouteCatalogueQuery{}) {
+		protected[route.Method+" "+route.Path] = route.Protected
+	}
+	for route, want := range map[string]bool{
+		"POST /api/login":                 false,
+		"GET /api/users":                  true,
+		"POST /api/users/:id/impersonate": true,
+		"PUT /api/rbac/roles/:role/menus": true,
+	} {
+		got, ok := protected[route]
+		if !ok {
+			t.Errorf("%s missing from the route catalogue", route)
+		} else if got != want {
+			t.Errorf("%s: protected = %v, want %v", route, got, want)
+		}
+	}
+
+	// 默认策略覆盖全部受保护的接口
+	uncovered, _, err := service.CheckRouteCoverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uncovered) != 0 {
+		t.Errorf("routes without policies: %+v", uncovered)
+	}
+}
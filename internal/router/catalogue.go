@@ -0,0 +1,131 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fastgin/docs"
+	"fastgin/internal/middleware"
+	"fastgin/internal/service"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// authorizeHandlerName Authorize 中间件在处理链中的函数名前缀
+const authorizeHandlerName = "fastgin/internal/middleware.Authorize."
+
+// routeParamPattern 匹配 gin 路由中的 :id 和 *path 参数
+var routeParamPattern = regexp.MustCompile(`[:*]([^/]+)`)
+
+// routeProbeKey 请求上下文中的路由探测标记，只能在进程内设置，外部请求无法触发
+type routeProbeKey struct{}
+
+// routeProbeResult 探测到的路由和处理链
+type routeProbeResult struct {
+	fullPath string
+	handlers []string
+}
+
+// routeProbe 路由探测中间件，必须最先注册：收到探测请求时记录匹配的路由和完整的处理链后直接中止，不执行后续的中间件和处理函数
+func routeProbe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, ok := c.Request.Context().Value(routeProbeKey{}).(*routeProbeResult)
+		if !ok {
+			c.Next()
+			return
+		}
+		result.fullPath = c.FullPath()
+		result.handlers = c.HandlerNames()
+		c.Abort()
+	}
+}
+
+// probeRoute 查询路由的处理链，路由参数用占位值代替；探测请求匹配到其他路由时返回 nil
+func probeRoute(r *gin.Engine, route gin.RouteInfo) []string {
+	path := routeParamPattern.ReplaceAllString(route.Path, "0")
+	result := &routeProbeResult{}
+	req := httptest.NewRequest(route.Method, path, nil).
+		WithContext(context.WithValue(context.Background(), routeProbeKey{}, result))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if result.fullPath != route.Path {
+		return nil
+	}
+	return result.handlers
+}
+
+// swaggerOperation 接口文档中权限目录需要的字段
+type swaggerOperation struct {
+	Summary string   `json:"summary"`
+	Tags    []string `json:"tags"`
+}
+
+// swaggerOperations 读取接口文档，返回 路径 -> 方法 -> 接口说明，读取失败时返回空
+func swaggerOperations() map[string]map[string]swaggerOperation {
+	var doc struct {
+		Paths map[string]map[string]swaggerOperation `json:"paths"`
+	}
+	if err := json.Unmarshal([]byte(docs.SwaggerInfo.ReadDoc()), &doc); err != nil {
+		middleware.Logger.Warn("读取接口文档失败，权限目录不包含接口说明", zap.Error(err))
+		return nil
+	}
+	return doc.Paths
+}
+
+// buildRouteCatalogue 根据已注册的路由生成权限目录，接口说明和分组取自接口文档
+func buildRouteCatalogue(r *gin.Engine) []service.RouteEntry {
+	operations := swaggerOperations()
+	var routes []service.RouteEntry
+	for _, route := range r.Routes() {
+		entry := service.RouteEntry{
+			Method:  route.Method,
+			Path:    route.Path,
+			Tags:    []string{},
+			Handler: route.Handler,
+		}
+
+		for _, name := range probeRoute(r, route) {
+			if strings.HasPrefix(name, authorizeHandlerName) {
+				entry.Protected = true
+				break
+			}
+		}
+
+		// 接口文档的路径不含 basePath，参数写作 {id}
+		docPath := strings.TrimPrefix(route.Path, docs.SwaggerInfo.BasePath)
+		docPath = routeParamPattern.ReplaceAllString(docPath, "{$1}")
+		if op, ok := operations[docPath][strings.ToLower(route.Method)]; ok {
+			entry.Summary = op.Summary
+			if op.Tags != nil {
+				entry.Tags = op.Tags
+			}
+		}
+
+		routes = append(routes, entry)
+	}
+	return routes
+}
+
+// checkRouteCoverage 启动时检查策略：提示没有策略的受保护接口和不匹配任何接口的策略
+func checkRouteCoverage() {
+	uncovered, unused, err := service.CheckRouteCoverage()
+	if err != nil {
+		middleware.Logger.Error("检查权限策略覆盖失败", zap.Error(err))
+		return
+	}
+	for _, route := range uncovered {
+		middleware.Logger.Warn("受保护的接口没有任何策略，所有请求都会被拒绝",
+			zap.String("method", route.Method),
+			zap.String("path", route.Path),
+			zap.String("summary", route.Summary))
+	}
+	for _, rule := range unused {
+		middleware.Logger.Warn("策略不匹配任何已注册的接口",
+			zap.String("sub", rule.Sub),
+			zap.String("dom", rule.Dom),
+			zap.String("obj", rule.Obj),
+			zap.String("act", rule.Act))
+	}
+}
@@ -0,0 +1,32 @@
+package router
+
+import (
+	"fastgin/internal/api"
+	"fastgin/internal/middleware"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// DepartmentRouter 部门和角色数据权限管理接口
+func DepartmentRouter(r *gin.Engine, Enforcer *casbin.SyncedEnforcer) {
+	authorized := r.Group("/api")
+	authorized.Use(middleware.JWTOrAPIKeyAuth())
+	authorized.Use(middleware.Authorize(Enforcer))
+	{
+		departments := authorized.Group("/departments")
+		{
+			departments.GET("", api.ListDepartments)
+			departments.POST("", api.CreateDepartment)
+			departments.PUT("/:id", api.UpdateDepartment)
+			departments.DELETE("/:id", api.DeleteDepartment)
+		}
+
+		dataScopes := authorized.Group("/data-scopes")
+		{
+			dataScopes.GET("", api.ListDataScopes)
+			dataScopes.PUT("/:role", api.SetDataScope)
+			dataScopes.DELETE("/:role", api.DeleteDataScope)
+		}
+	}
+}
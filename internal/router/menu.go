@@ -0,0 +1,23 @@
+package router
+
+import (
+	"fastgin/internal/api"
+	"fastgin/internal/middleware"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// MenuRouter 前端菜单和按钮权限管理接口，模拟登录时不能修改菜单
+func MenuRouter(r *gin.Engine, Enforcer *casbin.SyncedEnforcer) {
+	menus := r.Group("/api/menus")
+	menus.Use(middleware.JWTOrAPIKeyAuth())
+	menus.Use(middleware.DenyImpersonation())
+	menus.Use(middleware.Authorize(Enforcer))
+	{
+		menus.GET("", api.ListMenus)
+		menus.POST("", api.CreateMenu)
+		menus.PUT("/:id", api.UpdateMenu)
+		menus.DELETE("/:id", api.DeleteMenu)
+	}
+}
@@ -0,0 +1,23 @@
+package router
+
+import (
+	"fastgin/internal/api"
+	"fastgin/internal/middleware"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func MFARouter(r *gin.Engine, Enforcer *casbin.SyncedEnforcer) {
+	authorized := r.Group("/api")
+	authorized.Use(middleware.JWTOrAPIKeyAuth())
+	authorized.Use(middleware.Authorize(Enforcer))
+	{
+		// 角色两步验证要求
+		roles := authorized.Group("/mfa/roles")
+		{
+			roles.GET("", api.ListMFARolePolicies)
+			roles.PUT("/:role", api.SetMFARolePolicy)
+		}
+	}
+}
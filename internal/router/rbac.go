@@ -0,0 +1,33 @@
+package router
+
+import (
+	"fastgin/internal/api"
+	"fastgin/internal/middleware"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// RBACRouter 权限策略管理接口，模拟登录时不能修改策略
+func RBACRouter(r *gin.Engine, Enforcer *casbin.SyncedEnforcer) {
+	rbac := r.Group("/api/rbac")
+	rbac.Use(middleware.JWTOrAPIKeyAuth())
+	rbac.Use(middleware.DenyImpersonation())
+	rbac.Use(middleware.Authorize(Enforcer))
+	{
+		rbac.GET("/policies", api.ListPolicies)
+		rbac.POST("/policies", api.AddPolicy)
+		rbac.DELETE("/policies", api.RemovePolicy)
+		rbac.GET("/groupings", api.ListGroupings)
+		rbac.POST("/groupings", api.AddGrouping)
+		rbac.DELETE("/groupings", api.RemoveGrouping)
+		rbac.GET("/roles", api.ListRoles)
+		rbac.GET("/roles/:role", api.GetRole)
+		rbac.GET("/roles/:role/menus", api.GetRoleMenus)
+		rbac.PUT("/roles/:role/menus", api.SetRoleMenus)
+		rbac.POST("/check", api.CheckPolicy)
+		rbac.POST("/explain", api.ExplainDecision)
+		rbac.GET("/decisions", api.ListDecisions)
+		rbac.GET("/routes", api.ListRoutes)
+	}
+}
@@ -0,0 +1,23 @@
+package router
+
+import (
+	"fastgin/internal/api"
+	"fastgin/internal/middleware"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// RoleRouter 角色管理接口，模拟登录时不能修改角色
+func RoleRouter(r *gin.Engine, Enforcer *casbin.SyncedEnforcer) {
+	roles := r.Group("/api/roles")
+	roles.Use(middleware.JWTOrAPIKeyAuth())
+	roles.Use(middleware.DenyImpersonation())
+	roles.Use(middleware.Authorize(Enforcer))
+	{
+		roles.GET("", api.ListRoleDefinitions)
+		roles.POST("", api.CreateRole)
+		roles.PUT("/:code", api.UpdateRole)
+		roles.DELETE("/:code", api.DeleteRole)
+	}
+}
@@ -8,20 +8,33 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func UserRouter(r *gin.Engine, Enforcer *casbin.Enforcer) {
+func UserRouter(r *gin.Engine, Enforcer *casbin.SyncedEnforcer) {
 	// 需要认证的路由组
 	authorized := r.Group("/api")
-	authorized.Use(middleware.JWTAuth())
+	authorized.Use(middleware.JWTOrAPIKeyAuth())
 	authorized.Use(middleware.Authorize(Enforcer))
 	{
 		// 用户管理接口
 		users := authorized.Group("/users")
+		// 只能管理当前租户内、数据权限范围内的用户
+		users.Use(api.UserScopeGuard())
 		{
 			users.POST("", api.CreateUser)
 			users.PUT("/:id", api.UpdateUser)
 			users.DELETE("/:id", api.DeleteUser)
 			users.GET("/:id", api.GetUser)
 			users.GET("", api.ListUsers)
+			users.DELETE("/:id/mfa", api.ResetUserMFA)
+			users.POST("/:id/unlock", api.UnlockUser)
+			users.POST("/:id/impersonate", api.ImpersonateUser)
+			users.GET("/:id/api-keys", api.ListUserAPIKeys)
+			users.DELETE("/:id/api-keys/:keyId", api.RevokeUserAPIKey)
+			users.GET("/:id/sessions", api.ListUserSessions)
+			users.DELETE("/:id/sessions", api.RevokeUserSessions)
+			users.DELETE("/:id/sessions/:sessionId", api.RevokeUserSession)
 		}
+
+		// 在线用户
+		authorized.GET("/sessions", api.ListOnlineSessions)
 	}
 }
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fastgin/internal/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrAPIKeyNotFound     = errors.New("API Key不存在")
+	ErrInvalidAPIKeyScope = errors.New("无效的权限范围，格式为 METHOD:/path，例如 GET:/api/users/*")
+)
+
+// apiKeyMethods 权限范围中允许的请求方法
+var apiKeyMethods = map[string]bool{
+	"*": true, "GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
+	// Scopes 为空表示继承所属用户角色的全部权限
+	Scopes []string `json:"scopes"`
+	// ExpiresIn 有效期（秒），0 表示永不过期
+	ExpiresIn int64 `json:"expires_in" binding:"min=0"`
+}
+
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Key 完整密钥，只在创建时返回一次
+	Key string `json:"key,omitempty"`
+}
+
+func newAPIKeyResponse(key *model.APIKey) *APIKeyResponse {
+	return &APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// normalizeAPIKeyScopes 校验权限范围格式并统一请求方法为大写
+func normalizeAPIKeyScopes(scopes []string) ([]string, error) {
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		method, pattern, found := strings.Cut(strings.TrimSpace(scope), ":")
+		method = strings.ToUpper(method)
+		if !found || !apiKeyMethods[method] || strings.ContainsAny(pattern, " \t") ||
+			(pattern != "*" && !strings.HasPrefix(pattern, "/")) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAPIKeyScope, scope)
+		}
+		normalized = append(normalized, method+":"+pattern)
+	}
+	return normalized, nil
+}
+
+// CreateAPIKey 为用户创建 API Key，返回的完整密钥只显示一次
+func CreateAPIKey(userID uint, req *CreateAPIKeyRequest) (*APIKeyResponse, error) {
+	scopes, err := normalizeAPIKeyScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	prefix := middleware.APIKeyTokenPrefix + hex.EncodeToString(b)
+	raw := prefix + "_" + secret
+
+	key := &model.APIKey{
+		UserID:  userID,
+		Name:    req.Name,
+		Prefix:  prefix,
+		KeyHash: middleware.HashAPIKey(raw),
+		Scopes:  strings.Join(scopes, " "),
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := repository.DB.Create(key).Error; err != nil {
+		return nil, err
+	}
+
+	middleware.Logger.Info("创建API Key",
+		zap.Uint("userID", userID),
+		zap.String("prefix", prefix),
+		zap.Strings("scopes", scopes))
+
+	resp := newAPIKeyResponse(key)
+	resp.Key = raw
+	return resp, nil
+}
+
+// ListAPIKeys 查询用户的 API Key，不包含完整密钥
+func ListAPIKeys(userID uint) ([]*APIKeyResponse, error) {
+	var keys []model.APIKey
+	if err := repository.DB.Where("user_id = ?", userID).Order("id desc").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	resp := make([]*APIKeyResponse, len(keys))
+	for i := range keys {
+		resp[i] = newAPIKeyResponse(&keys[i])
+	}
+	return resp, nil
+}
+
+// RevokeAPIKey 吊销用户的 API Key，吊销后立即失效
+func RevokeAPIKey(userID, keyID uint) error {
+	result := repository.DB.Model(&model.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	middleware.Logger.Info("吊销API Key",
+		zap.Uint("userID", userID),
+		zap.Uint("keyID", keyID))
+	return nil
+}
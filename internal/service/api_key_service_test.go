@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyEngine 使用 API Key 认证和 Casbin 鉴权的测试路由，user 角色可以读写 /api/reports
+func apiKeyEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	for _, act := range []string{"GET", "POST"} {
+		if _, err := enforcer.AddPolicy("user", "*", "/api/reports", act); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api", middleware.JWTOrAPIKeyAuth(), middleware.Authorize(enforcer))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/reports", ok)
+	api.POST("/reports", ok)
+	api.GET("/users", ok)
+	return r
+}
+
+func apiKeyRequest(r *gin.Engine, method, path, key string) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(middleware.APIKeyHeader, key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	r := apiKeyEngine(t)
+
+	scoped, err := CreateAPIKey(user.ID, &CreateAPIKeyRequest{Name: "read", Scopes: []string{"get:/api/reports"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unscoped, err := CreateAPIKey(user.ID, &CreateAPIKeyRequest{Name: "all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key    string
+		method string
+		path   string
+		want   int
+	}{
+		{scoped.Key, "GET", "/api/reports", http.StatusOK},
+		{scoped.Key, "POST", "/api/reports", http.StatusForbidden},
+		{unscoped.Key, "POST", "/api/reports", http.StatusOK},
+		// 权限范围不能超过所属用户的角色
+		{unscoped.Key, "GET", "/api/users", http.StatusForbidden},
+		{"fgk_00000000_forged", "GET", "/api/reports", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		if got := apiKeyRequest(r, tc.method, tc.path, tc.key); got != tc.want {
+			t.Errorf("%s %s with key %.12s: status = %d, want %d", tc.method, tc.path, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestAPIKeyStoredHashed(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	created, err := CreateAPIKey(user.ID, &CreateAPIKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var key model.APIKey
+	if err := repository.DB.First(&key, created.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if key.KeyHash == created.Key || key.KeyHash != middleware.HashAPIKey(created.Key) {
+		t.Error("API key not stored as a hash")
+	}
+	keys, err := ListAPIKeys(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Key != "" {
+		t.Errorf("ListAPIKeys returned the secret: %+v", keys)
+	}
+}
+
+func TestAPIKeyExpiredAndRevoked(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	r := apiKeyEngine(t)
+
+	expiring, err := CreateAPIKey(user.ID, &CreateAPIKeyRequest{Name: "expiring", ExpiresIn: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := CreateAPIKey(user.ID, &CreateAPIKeyRequest{Name: "revoked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{expiring.Key, revoked.Key} {
+		if got := apiKeyRequest(r, "GET", "/api/reports", key); got != http.StatusOK {
+			t.Fatalf("active key rejected: %d", got)
+		}
+	}
+
+	err = repository.DB.Model(&model.APIKey{}).Where("id = ?", expiring.ID).
+		Update("expires_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeAPIKey(user.ID, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{expiring.Key, revoked.Key} {
+		if got := apiKeyRequest(r, "GET", "/api/reports", key); got != http.StatusUnauthorized {
+			t.Errorf("expired or revoked key: status = %d, want 401", got)
+		}
+	}
+
+	// 只能吊销自己的 API Key
+	other := createTestUser(t, "bob", "Secret#123", "user")
+	if err := RevokeAPIKey(other.ID, expiring.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("revoke another user's key: err = %v, want ErrAPIKeyNotFound", err)
+	}
+}
+
+func TestAPIKeyInvalidScope(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	for _, scope := range []string{"/api/reports", "FETCH:/api/reports", "GET:api/reports", "GET:/api/ reports"} {
+		if _, err := CreateAPIKey(user.ID, &CreateAPIKeyRequest{Name: "bad", Scopes: []string{scope}}); !errors.Is(err, ErrInvalidAPIKeyScope) {
+			t.Errorf("scope %q: err = %v, want ErrInvalidAPIKeyScope", scope, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fastgin/internal/utils"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+var (
+	ErrInvalidRefreshToken = errors.New("无效的刷新令牌")
+	ErrRefreshTokenExpired = errors.New("刷新令牌已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，请重新登录")
+	ErrRefreshTokenRevoked = errors.New("刷新令牌已失效，请重新登录")
+)
+
+// refreshTokenTTL 返回刷新令牌有效期，未配置时默认 7 天
+func refreshTokenTTL() time.Duration {
+	if expire := config.GlobalConfig.JWT.RefreshExpire; expire > 0 {
+		return time.Duration(expire) * time.Second
+	}
+	return 7 * 24 * time.Hour
+}
+
+// issueRefreshToken 在令牌家族中生成新的刷新令牌并保存其哈希
+func issueRefreshToken(tx *gorm.DB, userID uint, familyID string) (string, error) {
+	raw, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	record := &model.RefreshToken{
+		UserID:    userID,
+		TokenHash: utils.SHA256Hex(raw),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// issueTokenPair 为用户签发访问令牌和刷新令牌，必须修改密码的用户只能拿到修改密码用的令牌
+// familyID 为空时表示新的登录，开启新的令牌家族并创建会话记录
+func issueTokenPair(tx *gorm.DB, user *model.User, familyID string, client ClientInfo) (*LoginResponse, error) {
+	newSession := familyID == ""
+	if newSession {
+		var err error
+		familyID, err = utils.RandomToken(16)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	generate := middleware.GenerateToken
+	if user.MustChangePassword {
+		generate = middleware.GeneratePasswordChangeToken
+	}
+	token, jti, err := generate(user.ID, user.TenantID, user.Username, user.Role, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := issueRefreshToken(tx, user.ID, familyID)
+	if err != nil {
+		middleware.Logger.Error("生成刷新令牌失败",
+			zap.Uint("userID", user.ID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	if err := saveSession(tx, user.ID, familyID, jti, client, newSession); err != nil {
+		middleware.Logger.Error("保存登录会话失败",
+			zap.Uint("userID", user.ID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        token,
+		ExpiresIn:    int64(middleware.AccessTokenTTL().Seconds()),
+		RefreshToken: refreshToken,
+		Username:     user.Username,
+		Role:         user.Role,
+
+		MustChangePassword: user.MustChangePassword,
+	}, nil
+}
+
+// RevokeTokenFamily 撤销同一家族下所有尚未撤销的刷新令牌
+func RevokeTokenFamily(familyID string) error {
+	return repository.DB.Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserTokens 使用户当前所有令牌失效：设置访问令牌水位线，撤销全部刷新令牌并终止所有会话
+// 用于修改密码、变更角色、删除用户以及退出所有设备
+func RevokeUserTokens(userID uint) error {
+	if err := middleware.TokenStore.SetUserWatermark(userID, time.Now()); err != nil {
+		return err
+	}
+	if err := revokeSessions(userID, ""); err != nil {
+		return err
+	}
+	return repository.DB.Model(&model.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Logout 吊销当前访问令牌并终止当前会话，若提供了刷新令牌则同时撤销其所在的令牌家族
+func Logout(userID uint, sessionID, jti string, expiresAt time.Time, req *LogoutRequest) error {
+	if err := middleware.TokenStore.Revoke(jti, expiresAt); err != nil {
+		return err
+	}
+	if sessionID != "" {
+		if err := RevokeSession(userID, sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+
+	if req.RefreshToken == "" {
+		return nil
+	}
+
+	var record model.RefreshToken
+	err := repository.DB.Where("token_hash = ? AND user_id = ?", utils.SHA256Hex(req.RefreshToken), userID).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return RevokeTokenFamily(record.FamilyID)
+}
+
+// LogoutAll 退出所有设备
+func LogoutAll(userID uint) error {
+	return RevokeUserTokens(userID)
+}
+
+// RefreshToken 使用刷新令牌换取新的令牌对，旧令牌随即失效（轮换）
+// 若已使用或已撤销的刷新令牌被再次提交，视为泄露并撤销整个令牌家族
+func RefreshToken(req *RefreshTokenRequest, client ClientInfo) (*LoginResponse, error) {
+	var record model.RefreshToken
+	err := repository.DB.Where("token_hash = ?", utils.SHA256Hex(req.RefreshToken)).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if record.UsedAt == nil && record.RevokedAt != nil {
+		return nil, ErrRefreshTokenRevoked
+	}
+
+	if record.UsedAt != nil {
+		middleware.Logger.Warn("检测到刷新令牌重用，撤销令牌家族",
+			zap.Uint("userID", record.UserID),
+			zap.String("familyID", record.FamilyID))
+		if err := RevokeTokenFamily(record.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if record.IsExpired() {
+		return nil, ErrRefreshTokenExpired
+	}
+
+	var user model.User
+	if err := repository.DB.First(&user, record.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	var resp *LoginResponse
+	err = repository.DB.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证并发请求中只有一个能成功使用该令牌
+		result := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", record.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		resp, err = issueTokenPair(tx, &user, record.FamilyID, client)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			if revokeErr := RevokeTokenFamily(record.FamilyID); revokeErr != nil {
+				return nil, revokeErr
+			}
+		}
+		return nil, err
+	}
+
+	middleware.Logger.Info("刷新令牌成功",
+		zap.Uint("userID", user.ID),
+		zap.String("familyID", record.FamilyID))
+	return resp, nil
+}
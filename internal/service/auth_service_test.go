@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fastgin/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginTestUser 使用密码登录，返回令牌对
+func loginTestUser(t *testing.T, username, password string) *LoginResponse {
+	t.Helper()
+	resp, err := Login(&LoginRequest{Username: username, Password: password}, testClient)
+	if err != nil {
+		t.Fatalf("Login(%s): %v", username, err)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("Login(%s) did not issue tokens: %+v", username, resp)
+	}
+	return resp
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "alice", "Secret#123", "user")
+	first := loginTestUser(t, "alice", "Secret#123")
+
+	second, err := RefreshToken(&RefreshTokenRequest{RefreshToken: first.RefreshToken}, testClient)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.Token == "" {
+		t.Fatalf("refresh token was not rotated: %+v", second)
+	}
+
+	// 已使用的刷新令牌再次提交视为泄露，撤销整个家族
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: first.RefreshToken}, testClient); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused refresh token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: second.RefreshToken}, testClient); !errors.Is(err, ErrRefreshTokenRevoked) {
+		t.Fatalf("refresh token of a revoked family: err = %v, want ErrRefreshTokenRevoked", err)
+	}
+}
+
+func TestRefreshTokenReuseDoesNotAffectOtherFamilies(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "alice", "Secret#123", "user")
+	laptop := loginTestUser(t, "alice", "Secret#123")
+	phone := loginTestUser(t, "alice", "Secret#123")
+
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: laptop.RefreshToken}, testClient); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: laptop.RefreshToken}, testClient); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: phone.RefreshToken}, testClient); err != nil {
+		t.Fatalf("refresh token of another login was revoked: %v", err)
+	}
+}
+
+func TestRefreshTokenConcurrentUse(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "alice", "Secret#123", "user")
+	resp := loginTestUser(t, "alice", "Secret#123")
+
+	const n = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: resp.RefreshToken}, testClient); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if succeeded != 1 {
+		t.Fatalf("%d concurrent refreshes succeeded, want 1", succeeded)
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "alice", "Secret#123", "user")
+	resp := loginTestUser(t, "alice", "Secret#123")
+	err := repository.DB.Model(&model.RefreshToken{}).
+		Where("token_hash = ?", utils.SHA256Hex(resp.RefreshToken)).
+		Update("expires_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: resp.RefreshToken}, testClient); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Fatalf("err = %v, want ErrRefreshTokenExpired", err)
+	}
+}
+
+func TestRefreshTokenStoredHashed(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "alice", "Secret#123", "user")
+	resp := loginTestUser(t, "alice", "Secret#123")
+
+	var count int64
+	repository.DB.Model(&model.RefreshToken{}).Where("token_hash = ?", resp.RefreshToken).Count(&count)
+	if count != 0 {
+		t.Error("refresh token stored in plain text")
+	}
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: "unknown"}, testClient); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown refresh token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+// tokenContext 使用访问令牌经过 JWTAuth 访问受保护接口，返回状态码和中间件解析出的令牌信息
+func tokenContext(t *testing.T, token string) (int, gin.H) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var info gin.H
+	r.GET("/protected", middleware.JWTAuth(), func(c *gin.Context) {
+		info = gin.H{
+			"userID":         c.GetUint("userID"),
+			"jti":            c.GetString("jti"),
+			"sessionID":      c.GetString("sessionID"),
+			"tokenExpiresAt": c.GetTime("tokenExpiresAt"),
+			"actorID":        c.GetUint("actorID"),
+		}
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", middleware.Bearer+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code, info
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "alice", "Secret#123", "user")
+	resp := loginTestUser(t, "alice", "Secret#123")
+	other := loginTestUser(t, "alice", "Secret#123")
+
+	status, info := tokenContext(t, resp.Token)
+	if status != http.StatusOK {
+		t.Fatalf("valid token rejected: %d", status)
+	}
+	err := Logout(info["userID"].(uint), info["sessionID"].(string), info["jti"].(string),
+		info["tokenExpiresAt"].(time.Time), &LogoutRequest{RefreshToken: resp.RefreshToken})
+	if err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if status, _ := tokenContext(t, resp.Token); status != http.StatusUnauthorized {
+		t.Errorf("access token after logout: status = %d, want 401", status)
+	}
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: resp.RefreshToken}, testClient); !errors.Is(err, ErrRefreshTokenRevoked) {
+		t.Errorf("refresh token after logout: err = %v, want ErrRefreshTokenRevoked", err)
+	}
+	// 其他设备的登录不受影响
+	if status, _ := tokenContext(t, other.Token); status != http.StatusOK {
+		t.Errorf("token of another session after logout: status = %d, want 200", status)
+	}
+}
+
+func TestLogoutAllRevokesEverySession(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	laptop := loginTestUser(t, "alice", "Secret#123")
+	phone := loginTestUser(t, "alice", "Secret#123")
+
+	if err := LogoutAll(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, resp := range []*LoginResponse{laptop, phone} {
+		if status, _ := tokenContext(t, resp.Token); status != http.StatusUnauthorized {
+			t.Errorf("access token after logout from all devices: status = %d, want 401", status)
+		}
+		if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: resp.RefreshToken}, testClient); !errors.Is(err, ErrRefreshTokenRevoked) {
+			t.Errorf("refresh token after logout from all devices: err = %v, want ErrRefreshTokenRevoked", err)
+		}
+	}
+
+	// 之后重新登录签发的令牌有效
+	time.Sleep(2 * time.Millisecond)
+	if status, _ := tokenContext(t, loginTestUser(t, "alice", "Secret#123").Token); status != http.StatusOK {
+		t.Errorf("token issued after logout from all devices: status = %d, want 200", status)
+	}
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2/util"
+	"gorm.io/gorm"
+)
+
+// DecisionQuery 鉴权审计记录的查询条件，为空的条件不过滤
+type DecisionQuery struct {
+	UserID  uint
+	Allowed *bool
+	// Path 请求路径前缀
+	Path  string
+	Since time.Time
+	Until time.Time
+}
+
+type ExplainRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+	// TenantID 默认为用户所属的租户
+	TenantID uint   `json:"tenant_id"`
+	Method   string `json:"method" binding:"required"`
+	Path     string `json:"path" binding:"required"`
+	// Params、IP、Time 用于 ABAC 模型，Time 默认为当前时间
+	Params map[string]string `json:"params"`
+	IP     string            `json:"ip"`
+	Time   *time.Time        `json:"time"`
+}
+
+type ExplainResult struct {
+	Allowed  bool   `json:"allowed"`
+	Sub      string `json:"sub"`
+	Dom      string `json:"dom"`
+	Username string `json:"username"`
+	// Matched 命中的策略，未命中时为空
+	Matched *PolicyRule `json:"matched"`
+	// Roles 用户在该租户内的全部角色，包含继承的角色
+	Roles []string `json:"roles"`
+	// Candidates 用户及其角色的策略中路径匹配的部分，用于判断是缺少策略还是方法、租户不匹配
+	Candidates  []PolicyRule `json:"candidates"`
+	Explanation string       `json:"explanation"`
+}
+
+// ListDecisions 分页查询操作者可以查看的鉴权审计记录，按时间倒序
+func ListDecisions(op RBACOperator, q DecisionQuery, page, pageSize int) ([]model.AuthzDecision, int64, error) {
+	dom, err := visibleDomain(op)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		if dom != "" {
+			db = db.Where("domain = ?", dom)
+		}
+		if q.UserID != 0 {
+			db = db.Where("user_id = ?", q.UserID)
+		}
+		if q.Allowed != nil {
+			db = db.Where("allowed = ?", *q.Allowed)
+		}
+		if q.Path != "" {
+			db = db.Where("object LIKE ?", strings.NewReplacer("%", `\%`, "_", `\_`).Replace(q.Path)+"%")
+		}
+		if !q.Since.IsZero() {
+			db = db.Where("created_at >= ?", q.Since)
+		}
+		if !q.Until.IsZero() {
+			db = db.Where("created_at < ?", q.Until)
+		}
+		return db
+	}
+
+	var total int64
+	if err := repository.DB.Model(&model.AuthzDecision{}).Scopes(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var list []model.AuthzDecision
+	err = repository.DB.Scopes(filter).Order("id desc").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&list).Error
+	return list, total, err
+}
+
+// ExplainDecision 使用当前生效的策略判断用户能否访问指定接口，并说明原因，不会修改任何数据
+func ExplainDecision(op RBACOperator, req *ExplainRequest) (*ExplainResult, error) {
+	user, err := getUser(req.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	tenantID := req.TenantID
+	if tenantID == 0 {
+		tenantID = user.TenantID
+	}
+	dom := middleware.TenantDomain(tenantID)
+	if err := checkDomain(op, dom); err != nil {
+		return nil, err
+	}
+	// 只有平台管理员可以检查其他租户的用户，与 UserScopeGuard 一样返回用户不存在，不暴露用户名和角色
+	if user.TenantID != tenantID {
+		if err := checkDomain(op, "*"); errors.Is(err, ErrRBACDomainForbidden) {
+			return nil, ErrUserNotFound
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	sub := middleware.UserSubject(user.ID)
+	act := strings.ToUpper(strings.TrimSpace(req.Method))
+	rctx := &middleware.RequestContext{
+		UserID:   user.ID,
+		TenantID: tenantID,
+		Params:   req.Params,
+		IP:       req.IP,
+		Time:     time.Now(),
+	}
+	if rctx.Params == nil {
+		rctx.Params = map[string]string{}
+	}
+	if req.Time != nil {
+		rctx.Time = *req.Time
+	}
+
+	allowed, explain, err := middleware.EnforceRequestEx(enforcer, rctx, sub, dom, req.Path, act)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := enforcer.GetImplicitRolesForUser(sub, dom)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExplainResult{
+		Allowed:    allowed,
+		Sub:        sub,
+		Dom:        dom,
+		Username:   user.Username,
+		Roles:      nonNil(roles),
+		Candidates: []PolicyRule{},
+	}
+	if len(explain) >= 4 {
+		result.Matched = &PolicyRule{Sub: explain[0], Dom: explain[1], Obj: explain[2], Act: explain[3]}
+	}
+
+	for _, subject := range append([]string{sub}, roles...) {
+		rules, err := enforcer.GetFilteredPolicy(0, subject)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range toPolicyRules(rules) {
+			if util.KeyMatch2(req.Path, rule.Obj) {
+				result.Candidates = append(result.Candidates, rule)
+			}
+		}
+	}
+
+	switch {
+	case result.Matched != nil:
+		m := result.Matched
+		result.Explanation = fmt.Sprintf("允许：命中策略 p, %s, %s, %s, %s", m.Sub, m.Dom, m.Obj, m.Act)
+	case allowed:
+		result.Explanation = "允许"
+	case len(result.Candidates) > 0:
+		result.Explanation = fmt.Sprintf("拒绝：%s 的角色 %v 有路径匹配 %s 的策略，但方法、租户或模型中的其他条件不满足",
+			dom, result.Roles, req.Path)
+	default:
+		result.Explanation = fmt.Sprintf("拒绝：%s 的角色 %v 没有路径匹配 %s 的策略", dom, result.Roles, req.Path)
+	}
+	return result, nil
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fastgin/internal/utils"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	CaptchaModeOff      = "off"
+	CaptchaModeAlways   = "always"
+	CaptchaModeFailures = "failures"
+
+	CaptchaTypeDigit = "digit"
+	CaptchaTypeMath  = "math"
+)
+
+var (
+	ErrCaptchaRequired = errors.New("请输入验证码")
+	ErrCaptchaInvalid  = errors.New("验证码错误或已过期")
+)
+
+type CaptchaResponse struct {
+	CaptchaID string `json:"captcha_id"`
+	// Image PNG 图片的 data URI，可直接用作 img 标签的 src
+	Image     string `json:"image"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// captchaPolicy 验证码参数，未配置时使用默认值
+type captchaPolicy struct {
+	mode             string
+	failureThreshold int
+	kind             string
+	length           int
+	expire           time.Duration
+	width            int
+	height           int
+}
+
+func currentCaptchaPolicy() captchaPolicy {
+	conf := config.GlobalConfig.Captcha
+	p := captchaPolicy{
+		mode:             CaptchaModeOff,
+		failureThreshold: 3,
+		kind:             CaptchaTypeDigit,
+		length:           4,
+		expire:           5 * time.Minute,
+		width:            120,
+		height:           40,
+	}
+	if conf.Mode != "" {
+		p.mode = conf.Mode
+	}
+	if conf.FailureThreshold > 0 {
+		p.failureThreshold = conf.FailureThreshold
+	}
+	if conf.Type != "" {
+		p.kind = conf.Type
+	}
+	if conf.Length > 0 {
+		p.length = conf.Length
+	}
+	if conf.Expire > 0 {
+		p.expire = time.Duration(conf.Expire) * time.Second
+	}
+	if conf.Width > 0 {
+		p.width = conf.Width
+	}
+	if conf.Height > 0 {
+		p.height = conf.Height
+	}
+	return p
+}
+
+// newCaptchaChallenge 生成验证码题目和答案
+func newCaptchaChallenge(p captchaPolicy) (question, answer string) {
+	if p.kind == CaptchaTypeMath {
+		a, b := rand.IntN(10)+1, rand.IntN(10)+1
+		switch rand.IntN(3) {
+		case 0:
+			return fmt.Sprintf("%d+%d=?", a, b), strconv.Itoa(a + b)
+		case 1:
+			if a < b {
+				a, b = b, a
+			}
+			return fmt.Sprintf("%d-%d=?", a, b), strconv.Itoa(a - b)
+		default:
+			return fmt.Sprintf("%dx%d=?", a, b), strconv.Itoa(a * b)
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < p.length; i++ {
+		sb.WriteByte(byte('0' + rand.IntN(10)))
+	}
+	return sb.String(), sb.String()
+}
+
+// GenerateCaptcha 生成一个新的验证码，答案保存在验证码存储中
+func GenerateCaptcha() (*CaptchaResponse, error) {
+	p := currentCaptchaPolicy()
+
+	id, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	question, answer := newCaptchaChallenge(p)
+	image, err := utils.RenderCaptcha(question, p.width, p.height)
+	if err != nil {
+		return nil, err
+	}
+	if err := middleware.Captchas.Set(id, answer, time.Now().Add(p.expire)); err != nil {
+		middleware.Logger.Error("保存验证码失败", zap.Error(err))
+		return nil, err
+	}
+
+	return &CaptchaResponse{
+		CaptchaID: id,
+		Image:     image,
+		ExpiresIn: int64(p.expire.Seconds()),
+	}, nil
+}
+
+// CaptchaRequired 判断本次登录是否需要验证码
+// failures 模式下，用户名或 IP 在失败计数窗口期内的失败次数达到阈值，或已被锁定过时需要验证码
+func CaptchaRequired(username, ip string) bool {
+	p := currentCaptchaPolicy()
+	switch p.mode {
+	case CaptchaModeAlways:
+		return true
+	case CaptchaModeFailures:
+	default:
+		return false
+	}
+
+	window := currentLoginPolicy().window
+	now := time.Now()
+	for _, key := range []string{userAttemptKey(username), ipAttemptKey(ip)} {
+		attempt, err := middleware.AttemptStore.Get(key)
+		if err != nil {
+			// 无法读取失败计数时按需要验证码处理
+			middleware.Logger.Error("读取登录失败次数失败",
+				zap.String("key", key),
+				zap.Error(err))
+			return true
+		}
+		if attempt == nil || now.Sub(attempt.FirstFailedAt) > window {
+			continue
+		}
+		if attempt.Failures >= p.failureThreshold || attempt.Lockouts > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCaptcha 校验验证码，无论结果如何验证码都会失效
+func verifyCaptcha(id, code string) error {
+	if id == "" || code == "" {
+		return ErrCaptchaRequired
+	}
+	answer, err := middleware.Captchas.Take(id)
+	if err != nil {
+		return err
+	}
+	code = strings.TrimSpace(code)
+	if answer == "" || subtle.ConstantTimeCompare([]byte(answer), []byte(code)) != 1 {
+		return ErrCaptchaInvalid
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidDataScope = errors.New("无效的数据权限，scope 为 all、dept、custom 或 self")
+	// ErrDataScopeNotFound 角色没有设置数据权限
+	ErrDataScopeNotFound = errors.New("角色未设置数据权限")
+	// ErrDepartmentOutOfScope 不能把用户分配到操作者数据权限之外的部门
+	ErrDepartmentOutOfScope = errors.New("不能将用户分配到数据权限范围之外的部门")
+)
+
+type DataScopeRequest struct {
+	Scope string `json:"scope" binding:"required"`
+	// Scope 为 custom 时可以访问的部门
+	DepartmentIDs []uint `json:"department_ids"`
+}
+
+type DataScopeResponse struct {
+	Role          string `json:"role"`
+	Scope         string `json:"scope"`
+	DepartmentIDs []uint `json:"department_ids"`
+}
+
+// DataScope 操作者在租户内可以访问的数据范围，由操作者在该租户内所有角色的数据权限合并得到
+type DataScope struct {
+	TenantID uint
+	UserID   uint
+	// All 为 true 时可以访问租户内的全部数据
+	All bool
+	// DepartmentIDs 可以访问这些部门的数据
+	DepartmentIDs []uint
+	// Self 为 true 时可以访问本人的数据
+	Self bool
+}
+
+// ResolveDataScope 计算用户在租户内的数据范围，取用户所有角色（含继承的角色）数据范围的并集。
+// 角色未设置数据权限时不限制，因此只要有一个角色未设置，就可以访问租户内的全部数据
+func ResolveDataScope(tenantID, userID uint) (*DataScope, error) {
+	scope := &DataScope{TenantID: tenantID, UserID: userID}
+
+	roles, err := enforcer.GetImplicitRolesForUser(middleware.UserSubject(userID), middleware.TenantDomain(tenantID))
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		scope.All = true
+		return scope, nil
+	}
+	var rules []model.RoleDataScope
+	err = repository.DB.Preload("Departments").
+		Where("tenant_id = ? AND role IN ?", tenantID, roles).
+		Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	configured := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		configured[rule.Role] = true
+	}
+	for _, role := range roles {
+		if !configured[role] {
+			scope.All = true
+			return scope, nil
+		}
+	}
+
+	var roots, custom []uint
+	// 多个角色为 dept 时只需要查询一次用户所属部门
+	deptResolved := false
+	for _, rule := range rules {
+		switch rule.Scope {
+		case model.DataScopeAll:
+			scope.All = true
+			return scope, nil
+		case model.DataScopeDept:
+			if deptResolved {
+				continue
+			}
+			deptResolved = true
+			user, err := getUser(userID)
+			if err != nil {
+				return nil, err
+			}
+			if user.DepartmentID == 0 {
+				// 未分配部门时只能访问本人的数据
+				scope.Self = true
+			} else {
+				roots = []uint{user.DepartmentID}
+			}
+		case model.DataScopeCustom:
+			for _, dept := range rule.Departments {
+				custom = append(custom, dept.ID)
+			}
+		case model.DataScopeSelf:
+			scope.Self = true
+		}
+	}
+
+	depts, err := tenantDepartments(repository.DB, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	scope.DepartmentIDs = departmentDescendants(depts, roots...)
+	seen := make(map[uint]bool)
+	for _, id := range scope.DepartmentIDs {
+		seen[id] = true
+	}
+	for _, id := range custom {
+		if !seen[id] {
+			seen[id] = true
+			scope.DepartmentIDs = append(scope.DepartmentIDs, id)
+		}
+	}
+	return scope, nil
+}
+
+// Scope 将查询限定在数据范围内，deptColumn 为数据所属部门的列，ownerColumn 为数据所属用户的列，
+// 数据没有对应的属性时传空字符串。不会限定租户，需要时与 tenantScope 一起使用
+func (s *DataScope) Scope(deptColumn, ownerColumn string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if s.All {
+			return db
+		}
+		var conds []string
+		var args []interface{}
+		if deptColumn != "" && len(s.DepartmentIDs) > 0 {
+			conds = append(conds, deptColumn+" IN ?")
+			args = append(args, s.DepartmentIDs)
+		}
+		if ownerColumn != "" && s.Self {
+			conds = append(conds, ownerColumn+" = ?")
+			args = append(args, s.UserID)
+		}
+		if len(conds) == 0 {
+			return db.Where("1 = 0")
+		}
+		return db.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+}
+
+// Users 将用户查询限定在租户和数据范围内
+func (s *DataScope) Users() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(tenantScope(s.TenantID), s.Scope("department_id", "id"))
+	}
+}
+
+// checkDepartment 检查能否把用户分配到部门，部门必须属于租户并且在数据范围内；
+// 数据范围不是全部时不能把用户移出部门，否则操作者将无法再访问该用户
+func (s *DataScope) checkDepartment(deptID uint) error {
+	if deptID != 0 {
+		if _, err := getDepartment(repository.DB, s.TenantID, deptID); err != nil {
+			return err
+		}
+	}
+	if s.All {
+		return nil
+	}
+	for _, id := range s.DepartmentIDs {
+		if id == deptID {
+			return nil
+		}
+	}
+	return ErrDepartmentOutOfScope
+}
+
+func newDataScopeResponse(rule *model.RoleDataScope) *DataScopeResponse {
+	resp := &DataScopeResponse{Role: rule.Role, Scope: rule.Scope, DepartmentIDs: []uint{}}
+	for _, dept := range rule.Departments {
+		resp.DepartmentIDs = append(resp.DepartmentIDs, dept.ID)
+	}
+	return resp
+}
+
+// ListDataScopes 查询租户内所有设置过数据权限的角色
+func ListDataScopes(tenantID uint) ([]*DataScopeResponse, error) {
+	var rules []model.RoleDataScope
+	err := repository.DB.Preload("Departments").Scopes(tenantScope(tenantID)).Order("role").Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*DataScopeResponse, len(rules))
+	for i := range rules {
+		list[i] = newDataScopeResponse(&rules[i])
+	}
+	return list, nil
+}
+
+// SetDataScope 设置角色在租户内的数据权限，custom 以外的范围会清空指定的部门
+func SetDataScope(tenantID uint, role string, req *DataScopeRequest) error {
+	switch req.Scope {
+	case model.DataScopeAll, model.DataScopeDept, model.DataScopeSelf:
+		req.DepartmentIDs = nil
+	case model.DataScopeCustom:
+	default:
+		return ErrInvalidDataScope
+	}
+	role = strings.TrimSpace(role)
+	if role == "" {
+		return ErrInvalidDataScope
+	}
+	if _, err := findRoles(repository.DB, []string{role}); err != nil {
+		return err
+	}
+
+	return repository.DB.Transaction(func(tx *gorm.DB) error {
+		depts := []model.Department{}
+		if len(req.DepartmentIDs) > 0 {
+			if err := tx.Scopes(tenantScope(tenantID)).Find(&depts, req.DepartmentIDs).Error; err != nil {
+				return err
+			}
+			if len(depts) != len(uniqueIDs(req.DepartmentIDs)) {
+				return ErrDepartmentNotFound
+			}
+		}
+
+		var rule model.RoleDataScope
+		err := tx.Where(model.RoleDataScope{TenantID: tenantID, Role: role}).
+			Attrs(model.RoleDataScope{Scope: req.Scope}).
+			FirstOrCreate(&rule).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&rule).Update("scope", req.Scope).Error; err != nil {
+			return err
+		}
+		return tx.Model(&rule).Association("Departments").Replace(depts)
+	})
+}
+
+// DeleteDataScope 删除角色在租户内的数据权限，之后计算数据范围时不再考虑该角色
+func DeleteDataScope(tenantID uint, role string) error {
+	return repository.DB.Transaction(func(tx *gorm.DB) error {
+		var rule model.RoleDataScope
+		err := tx.Where("tenant_id = ? AND role = ?", tenantID, role).First(&rule).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDataScopeNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&rule).Association("Departments").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&rule).Error
+	})
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
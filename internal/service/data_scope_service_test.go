@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"slices"
+	"testing"
+)
+
+func TestResolveDataScope(t *testing.T) {
+	tests := []struct {
+		name string
+		// roles 用户的角色，第一个为主角色
+		roles []string
+		// noDept 用户未分配部门
+		noDept bool
+		// platformAdmin 同时是平台管理员
+		platformAdmin bool
+		all           bool
+		depts         []string
+		self          bool
+	}{
+		{name: "dept", roles: []string{"deptRole"}, depts: []string{"研发", "前端"}},
+		{name: "dept without department", roles: []string{"deptRole"}, noDept: true, self: true},
+		{name: "custom", roles: []string{"customRole"}, depts: []string{"销售"}},
+		{name: "self", roles: []string{"selfRole"}, self: true},
+		{name: "dept and custom", roles: []string{"deptRole", "customRole"}, depts: []string{"研发", "前端", "销售"}},
+		{name: "dept and self", roles: []string{"selfRole", "deptRole"}, depts: []string{"研发", "前端"}, self: true},
+		{name: "inherited rule", roles: []string{"lead"}, depts: []string{"研发", "前端", "销售"}},
+		{name: "all", roles: []string{"selfRole", "allRole"}, all: true},
+		{name: "role without rule", roles: []string{"customRole", "open"}, all: true},
+		{name: "platform admin", roles: []string{"selfRole"}, platformAdmin: true, all: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestDB(t)
+			depts := make(map[string]uint)
+			for _, d := range []struct{ name, parent string }{{"总部", ""}, {"研发", "总部"}, {"前端", "研发"}, {"销售", "总部"}} {
+				dept, err := CreateDepartment(model.DefaultTenantID, &DepartmentRequest{Name: d.name, ParentID: depts[d.parent]})
+				if err != nil {
+					t.Fatal(err)
+				}
+				depts[d.name] = dept.ID
+			}
+			rules := map[string]*DataScopeRequest{
+				"allRole":    {Scope: model.DataScopeAll},
+				"deptRole":   {Scope: model.DataScopeDept},
+				"customRole": {Scope: model.DataScopeCustom, DepartmentIDs: []uint{depts["销售"]}},
+				"selfRole":   {Scope: model.DataScopeSelf},
+				"lead":       {Scope: model.DataScopeDept},
+				"open":       nil,
+			}
+			for role, rule := range rules {
+				if _, err := CreateRole(RBACOperator{}, &CreateRoleRequest{Code: role, Name: role}); err != nil {
+					t.Fatal(err)
+				}
+				if rule == nil {
+					continue
+				}
+				if err := SetDataScope(model.DefaultTenantID, role, rule); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// lead 继承 customRole
+			if _, err := enforcer.AddGroupingPolicy("lead", "customRole", "*"); err != nil {
+				t.Fatal(err)
+			}
+
+			user := createTestUser(t, "alice", "Secret#123", tc.roles[0])
+			sub, dom := middleware.UserSubject(user.ID), middleware.TenantDomain(user.TenantID)
+			for _, role := range tc.roles[1:] {
+				if _, err := enforcer.AddGroupingPolicy(sub, role, dom); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.platformAdmin {
+				if _, err := enforcer.AddGroupingPolicy(sub, platformAdminRole, "*"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !tc.noDept {
+				if err := repository.DB.Model(user).Update("department_id", depts["研发"]).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			scope, err := ResolveDataScope(user.TenantID, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []uint
+			for _, name := range tc.depts {
+				want = append(want, depts[name])
+			}
+			got := slices.Clone(scope.DepartmentIDs)
+			slices.Sort(got)
+			slices.Sort(want)
+			if scope.All != tc.all || scope.Self != tc.self || !slices.Equal(got, want) {
+				t.Errorf("scope = {All:%v Self:%v Depts:%v}, want {All:%v Self:%v Depts:%v}",
+					scope.All, scope.Self, got, tc.all, tc.self, want)
+			}
+		})
+	}
+}
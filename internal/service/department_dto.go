@@ -0,0 +1,34 @@
+package service
+
+// DepartmentRequests 创建或修改部门请求
+type DepartmentRequests struct {
+	Name     string `json:"name" binding:"required,max=64" example:"研发部"`
+	ParentID uint   `json:"parent_id" example:"0"`
+	Sort     int    `json:"sort" example:"1"`
+}
+
+// DepartmentNodes 部门树节点
+type DepartmentNodes struct {
+	ID        uint              `json:"id" example:"2"`
+	TenantID  uint              `json:"tenant_id" example:"1"`
+	ParentID  uint              `json:"parent_id" example:"1"`
+	Name      string            `json:"name" example:"研发部"`
+	Sort      int               `json:"sort" example:"1"`
+	CreatedAt string            `json:"created_at" example:"2025-03-01T12:00:00Z"`
+	UpdatedAt string            `json:"updated_at" example:"2025-03-01T12:00:00Z"`
+	Children  []DepartmentNodes `json:"children"`
+}
+
+// DataScopeRequests 设置角色数据权限请求
+type DataScopeRequests struct {
+	// all 全部数据，dept 本部门及下级部门，custom 指定部门，self 仅本人
+	Scope         string `json:"scope" binding:"required" example:"custom"`
+	DepartmentIDs []uint `json:"department_ids" example:"2,3"`
+}
+
+// DataScopeResponses 角色数据权限
+type DataScopeResponses struct {
+	Role          string `json:"role" example:"manager"`
+	Scope         string `json:"scope" example:"custom"`
+	DepartmentIDs []uint `json:"department_ids" example:"2,3"`
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDepartmentNotFound = errors.New("部门不存在")
+	// ErrDepartmentInUse 部门下还有子部门或用户时不能删除
+	ErrDepartmentInUse = errors.New("部门下还有子部门或用户，不能删除")
+	// ErrInvalidParentDepartment 上级部门不能是部门自己或其下级部门
+	ErrInvalidParentDepartment = errors.New("无效的上级部门")
+)
+
+type DepartmentRequest struct {
+	Name     string `json:"name" binding:"required,max=64"`
+	ParentID uint   `json:"parent_id"`
+	Sort     int    `json:"sort"`
+}
+
+// DepartmentNode 部门树的节点
+type DepartmentNode struct {
+	model.Department
+	Children []*DepartmentNode `json:"children"`
+}
+
+// tenantDepartments 查询租户内的全部部门
+func tenantDepartments(db *gorm.DB, tenantID uint) ([]model.Department, error) {
+	var depts []model.Department
+	err := db.Scopes(tenantScope(tenantID)).Order("sort, id").Find(&depts).Error
+	return depts, err
+}
+
+// getDepartment 查询租户内的部门，部门不属于该租户时返回 ErrDepartmentNotFound
+func getDepartment(db *gorm.DB, tenantID, id uint) (*model.Department, error) {
+	var dept model.Department
+	err := db.Scopes(tenantScope(tenantID)).First(&dept, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDepartmentNotFound
+	}
+	return &dept, err
+}
+
+// departmentDescendants 返回 roots 及其全部下级部门的 ID
+func departmentDescendants(depts []model.Department, roots ...uint) []uint {
+	children := make(map[uint][]uint)
+	for _, d := range depts {
+		children[d.ParentID] = append(children[d.ParentID], d.ID)
+	}
+	seen := make(map[uint]bool)
+	queue := append([]uint(nil), roots...)
+	ids := []uint{}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		queue = append(queue, children[id]...)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// ListDepartments 以树的形式返回租户内的全部部门
+func ListDepartments(tenantID uint) ([]*DepartmentNode, error) {
+	depts, err := tenantDepartments(repository.DB, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[uint]*DepartmentNode, len(depts))
+	for i := range depts {
+		nodes[depts[i].ID] = &DepartmentNode{Department: depts[i], Children: []*DepartmentNode{}}
+	}
+	tree := []*DepartmentNode{}
+	for i := range depts {
+		node := nodes[depts[i].ID]
+		if parent, ok := nodes[depts[i].ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			tree = append(tree, node)
+		}
+	}
+	return tree, nil
+}
+
+// CreateDepartment 在租户内创建部门
+func CreateDepartment(tenantID uint, req *DepartmentRequest) (*model.Department, error) {
+	if req.ParentID != 0 {
+		if _, err := getDepartment(repository.DB, tenantID, req.ParentID); err != nil {
+			if errors.Is(err, ErrDepartmentNotFound) {
+				return nil, ErrInvalidParentDepartment
+			}
+			return nil, err
+		}
+	}
+
+	dept := &model.Department{
+		TenantID: tenantID,
+		ParentID: req.ParentID,
+		Name:     req.Name,
+		Sort:     req.Sort,
+	}
+	if err := repository.DB.Create(dept).Error; err != nil {
+		return nil, err
+	}
+	return dept, nil
+}
+
+// UpdateDepartment 修改租户内的部门，上级部门不能是部门自己或其下级部门
+func UpdateDepartment(tenantID, id uint, req *DepartmentRequest) error {
+	return repository.DB.Transaction(func(tx *gorm.DB) error {
+		dept, err := getDepartment(tx, tenantID, id)
+		if err != nil {
+			return err
+		}
+		if req.ParentID != 0 {
+			depts, err := tenantDepartments(tx, tenantID)
+			if err != nil {
+				return err
+			}
+			valid := false
+			for _, d := range depts {
+				valid = valid || d.ID == req.ParentID
+			}
+			for _, descendant := range departmentDescendants(depts, id) {
+				valid = valid && descendant != req.ParentID
+			}
+			if !valid {
+				return ErrInvalidParentDepartment
+			}
+		}
+
+		return tx.Model(dept).Updates(map[string]interface{}{
+			"name":      req.Name,
+			"parent_id": req.ParentID,
+			"sort":      req.Sort,
+		}).Error
+	})
+}
+
+// DeleteDepartment 删除租户内没有子部门和用户的部门，同时从自定义数据权限中移除
+func DeleteDepartment(tenantID, id uint) error {
+	return repository.DB.Transaction(func(tx *gorm.DB) error {
+		dept, err := getDepartment(tx, tenantID, id)
+		if err != nil {
+			return err
+		}
+
+		var children, users int64
+		if err := tx.Model(&model.Department{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.User{}).Where("department_id = ?", id).Count(&users).Error; err != nil {
+			return err
+		}
+		if children > 0 || users > 0 {
+			return ErrDepartmentInUse
+		}
+
+		if err := tx.Table("role_data_scope_departments").Where("department_id = ?", id).Delete(map[string]interface{}{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(dept).Error
+	})
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"net/http"
+	"testing"
+)
+
+func TestImpersonationTargets(t *testing.T) {
+	setupTestDB(t)
+	for _, role := range []string{"support", "editor", "viewer", "lead"} {
+		if _, err := CreateRole(RBACOperator{}, &CreateRoleRequest{Code: role, Name: role}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	policies := [][]string{
+		{"support", "*", "/api/users/:id/impersonate", "POST"},
+		{"support", "*", "/api/users", "GET"},
+		{"viewer", "tenant:1", "/api/users", "GET"},
+		{"editor", "tenant:1", "/api/reports", "POST"},
+	}
+	for _, p := range policies {
+		if _, err := enforcer.AddPolicy(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := enforcer.AddGroupingPolicy("lead", platformAdminRole, "*"); err != nil {
+		t.Fatal(err)
+	}
+
+	actor := createTestUser(t, "support", "Secret#123", "support")
+	grant := func(user *model.User, role, dom string) {
+		t.Helper()
+		if _, err := enforcer.AddGroupingPolicy(middleware.UserSubject(user.ID), role, dom); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin := createTestUser(t, "root", "Secret#123", platformAdminRole)
+	secondaryAdmin := createTestUser(t, "alice", "Secret#123", "viewer")
+	grant(secondaryAdmin, platformAdminRole, "tenant:1")
+	otherTenantAdmin := createTestUser(t, "bob", "Secret#123", "viewer")
+	grant(otherTenantAdmin, platformAdminRole, "tenant:2")
+	inheritedAdmin := createTestUser(t, "carol", "Secret#123", "lead")
+	editor := createTestUser(t, "dave", "Secret#123", "editor")
+	viewer := createTestUser(t, "erin", "Secret#123", "viewer")
+	directPolicy := createTestUser(t, "frank", "Secret#123", "viewer")
+	if _, err := enforcer.AddPolicy(middleware.UserSubject(directPolicy.ID), "tenant:1", "/api/logs", "GET"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target uint
+		want   error
+	}{
+		{"self", actor.ID, ErrImpersonateSelf},
+		{"unknown user", 9999, ErrUserNotFound},
+		{"platform admin", admin.ID, ErrImpersonateAdmin},
+		{"admin as another role", secondaryAdmin.ID, ErrImpersonateAdmin},
+		{"admin in another tenant", otherTenantAdmin.ID, ErrImpersonateAdmin},
+		{"inherited admin", inheritedAdmin.ID, ErrImpersonateAdmin},
+		{"permission the actor lacks", editor.ID, ErrImpersonatePrivileged},
+		{"policy on the user subject", directPolicy.ID, ErrImpersonatePrivileged},
+		{"subset of the actor's permissions", viewer.ID, nil},
+	}
+	actorClaims := middleware.ActorClaims{UserID: actor.ID, Username: actor.Username}
+	for _, tc := range tests {
+		resp, err := Impersonate(actorClaims, tc.target, &ImpersonateRequest{Reason: "排查问题"}, testClient)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		// 模拟登录的令牌属于目标用户，记录操作者，不签发刷新令牌
+		status, info := tokenContext(t, resp.Token)
+		if status != http.StatusOK || info["userID"] != tc.target || info["actorID"] != actor.ID {
+			t.Errorf("%s: status = %d, token info = %v", tc.name, status, info)
+		}
+		if resp.RefreshToken != "" || resp.ExpiresIn != int64(middleware.ImpersonationTokenTTL.Seconds()) {
+			t.Errorf("%s: response = %+v", tc.name, resp)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrLoginFailed 登录失败统一返回的错误，不区分用户不存在和密码错误
+var ErrLoginFailed = errors.New("用户名或密码错误")
+
+// LoginLockedError 登录被临时锁定
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("登录失败次数过多，请%d秒后再试", int(e.RetryAfter.Seconds())+1)
+}
+
+// loginPolicy 登录防暴力破解参数，未配置时使用默认值
+type loginPolicy struct {
+	maxAttempts   int
+	ipMaxAttempts int
+	window        time.Duration
+	lockout       time.Duration
+	maxLockout    time.Duration
+}
+
+func currentLoginPolicy() loginPolicy {
+	conf := config.GlobalConfig.Login
+	p := loginPolicy{
+		maxAttempts:   5,
+		ipMaxAttempts: 20,
+		window:        15 * time.Minute,
+		lockout:       time.Minute,
+		maxLockout:    time.Hour,
+	}
+	if conf.MaxAttempts > 0 {
+		p.maxAttempts = conf.MaxAttempts
+	}
+	if conf.IPMaxAttempts > 0 {
+		p.ipMaxAttempts = conf.IPMaxAttempts
+	}
+	if conf.Window > 0 {
+		p.window = time.Duration(conf.Window) * time.Second
+	}
+	if conf.LockoutDuration > 0 {
+		p.lockout = time.Duration(conf.LockoutDuration) * time.Second
+	}
+	if conf.MaxLockoutDuration > 0 {
+		p.maxLockout = time.Duration(conf.MaxLockoutDuration) * time.Second
+	}
+	return p
+}
+
+func userAttemptKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLoginAllowed 用户名或 IP 处于锁定期内时拒绝登录
+func checkLoginAllowed(username, ip string) error {
+	now := time.Now()
+	for _, key := range []string{userAttemptKey(username), ipAttemptKey(ip)} {
+		attempt, err := middleware.AttemptStore.Get(key)
+		if err != nil {
+			return err
+		}
+		if attempt != nil && attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+			return &LoginLockedError{RetryAfter: attempt.LockedUntil.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// recordLoginFailure 分别累计用户名和 IP 的失败次数，达到上限后按指数退避锁定
+func recordLoginFailure(username, ip string) {
+	p := currentLoginPolicy()
+	limits := map[string]int{
+		userAttemptKey(username): p.maxAttempts,
+		ipAttemptKey(ip):         p.ipMaxAttempts,
+	}
+	for key, limit := range limits {
+		if err := recordAttemptFailure(key, limit, p); err != nil {
+			middleware.Logger.Error("记录登录失败次数失败",
+				zap.String("key", key),
+				zap.Error(err))
+		}
+	}
+}
+
+// recordAttemptFailure 原子地累计失败次数，是否锁定根据累计后的次数判断
+func recordAttemptFailure(key string, limit int, p loginPolicy) error {
+	_, err := middleware.AttemptStore.Update(key, func(attempt *model.LoginAttempt) {
+		now := time.Now()
+		// 窗口期已过，重新计数；长时间没有再被锁定时，退避级别也随之清零
+		if now.Sub(attempt.FirstFailedAt) > p.window {
+			attempt.Failures = 0
+			attempt.FirstFailedAt = now
+			if attempt.LockedUntil == nil || now.Sub(*attempt.LockedUntil) > p.maxLockout {
+				attempt.Lockouts = 0
+			}
+		}
+
+		attempt.Failures++
+		attempt.UpdatedAt = now
+		if attempt.Failures < limit {
+			return
+		}
+		attempt.Lockouts++
+		duration := p.lockout << (attempt.Lockouts - 1)
+		if duration > p.maxLockout || duration <= 0 {
+			duration = p.maxLockout
+		}
+		lockedUntil := now.Add(duration)
+		attempt.LockedUntil = &lockedUntil
+		attempt.Failures = 0
+		attempt.FirstFailedAt = now
+
+		middleware.Logger.Warn("登录失败次数过多，临时锁定",
+			zap.String("key", key),
+			zap.Int("lockouts", attempt.Lockouts),
+			zap.Duration("duration", duration))
+	})
+	return err
+}
+
+// resetLoginFailures 登录成功后清除用户名的失败计数，IP 计数保留到窗口期结束
+func resetLoginFailures(username string) {
+	if err := middleware.AttemptStore.Delete(userAttemptKey(username)); err != nil {
+		middleware.Logger.Error("清除登录失败次数失败",
+			zap.String("username", username),
+			zap.Error(err))
+	}
+}
+
+// UnlockUser 管理员解除数据范围内用户的登录锁定
+func UnlockUser(scope *DataScope, id uint) error {
+	user, err := GetUser(scope, id)
+	if err != nil {
+		return err
+	}
+	return middleware.AttemptStore.Delete(userAttemptKey(user.Username))
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failLogin 使用错误的密码登录 n 次
+func failLogin(t *testing.T, username string, n int, client ClientInfo) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := Login(&LoginRequest{Username: username, Password: "wrong"}, client); !errors.Is(err, ErrLoginFailed) {
+			t.Fatalf("attempt %d: err = %v, want ErrLoginFailed", i+1, err)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "alice", "Secret#123", "user")
+	failLogin(t, "alice", currentLoginPolicy().maxAttempts, testClient)
+
+	// 锁定期间正确的密码同样被拒绝
+	_, err := Login(&LoginRequest{Username: "alice", Password: "Secret#123"}, testClient)
+	var locked *LoginLockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("err = %v, want LoginLockedError", err)
+	}
+	if locked.RetryAfter <= 0 || locked.RetryAfter > currentLoginPolicy().lockout {
+		t.Errorf("RetryAfter = %v", locked.RetryAfter)
+	}
+}
+
+func TestLoginLockoutUnknownUser(t *testing.T) {
+	setupTestDB(t)
+	failLogin(t, "nobody", currentLoginPolicy().maxAttempts, testClient)
+
+	var locked *LoginLockedError
+	if _, err := Login(&LoginRequest{Username: "nobody", Password: "wrong"}, testClient); !errors.As(err, &locked) {
+		t.Fatalf("unknown username: err = %v, want LoginLockedError", err)
+	}
+}
+
+func TestLoginLockoutBackoff(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "alice", "Secret#123", "user")
+	p := currentLoginPolicy()
+
+	failLogin(t, "alice", p.maxAttempts, testClient)
+	// 第一次锁定结束后再次达到上限，锁定时长翻倍
+	_, err := middleware.AttemptStore.Update(userAttemptKey("alice"), func(attempt *model.LoginAttempt) {
+		past := time.Now().Add(-time.Second)
+		attempt.LockedUntil = &past
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failLogin(t, "alice", p.maxAttempts, testClient)
+
+	var locked *LoginLockedError
+	if _, err := Login(&LoginRequest{Username: "alice", Password: "Secret#123"}, testClient); !errors.As(err, &locked) {
+		t.Fatalf("err = %v, want LoginLockedError", err)
+	}
+	if locked.RetryAfter <= p.lockout || locked.RetryAfter > 2*p.lockout {
+		t.Errorf("second lockout RetryAfter = %v, want about %v", locked.RetryAfter, 2*p.lockout)
+	}
+}
+
+func TestLoginSuccessResetsFailures(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "alice", "Secret#123", "user")
+	p := currentLoginPolicy()
+
+	failLogin(t, "alice", p.maxAttempts-1, testClient)
+	loginTestUser(t, "alice", "Secret#123")
+	failLogin(t, "alice", p.maxAttempts-1, testClient)
+	loginTestUser(t, "alice", "Secret#123")
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	setupTestDB(t)
+	config.GlobalConfig.Login.IPMaxAttempts = 3
+	createTestUser(t, "alice", "Secret#123", "user")
+
+	// 同一 IP 尝试不同的用户名
+	failLogin(t, "bob", 1, testClient)
+	failLogin(t, "carol", 1, testClient)
+	failLogin(t, "dave", 1, testClient)
+
+	var locked *LoginLockedError
+	if _, err := Login(&LoginRequest{Username: "alice", Password: "Secret#123"}, testClient); !errors.As(err, &locked) {
+		t.Fatalf("err = %v, want LoginLockedError", err)
+	}
+	other := ClientInfo{IP: "198.51.100.7", UserAgent: testClient.UserAgent}
+	if _, err := Login(&LoginRequest{Username: "alice", Password: "Secret#123"}, other); err != nil {
+		t.Errorf("login from another IP: %v", err)
+	}
+}
+
+func TestRecordAttemptFailureConcurrent(t *testing.T) {
+	db := setupTestDB(t)
+	stores := map[string]middleware.LoginAttemptStore{
+		"db":     middleware.NewDBLoginAttemptStore(db),
+		"memory": middleware.NewMemoryLoginAttemptStore(),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			middleware.AttemptStore = store
+			p := currentLoginPolicy()
+
+			const n = 20
+			var wg sync.WaitGroup
+			errs := make(chan error, n)
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- recordAttemptFailure("user:alice", 1000, p)
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			attempt, err := store.Get("user:alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attempt == nil || attempt.Failures != n {
+				t.Fatalf("attempt = %+v, want %d failures", attempt, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"fastgin/config"
+	"fastgin/internal/mail"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// mailClaimLease 发件箱中的邮件被某个实例取出后，其他实例在此期间不会重复发送
+	mailClaimLease = 2 * time.Minute
+	// mailBatchSize 每次轮询最多发送的邮件数量
+	mailBatchSize = 20
+	// mailThrottleWindow 同一收件人在此时间内只发送一封验证或找回密码邮件
+	mailThrottleWindow = time.Minute
+)
+
+var (
+	mailerMu sync.RWMutex
+	mailer   mail.Mailer = mail.NewLogMailer()
+
+	// outboxWake 写入新邮件后唤醒发件任务，不必等到下一次轮询
+	outboxWake = make(chan struct{}, 1)
+)
+
+// InitMailer 根据配置设置邮件发送器，配置热重载时重新调用
+func InitMailer(conf config.MailConfig) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	mailer = mail.New(conf)
+}
+
+func currentMailer() mail.Mailer {
+	mailerMu.RLock()
+	defer mailerMu.RUnlock()
+	return mailer
+}
+
+// enqueueMail 将邮件写入发件箱，与业务数据在同一事务中提交
+func enqueueMail(tx *gorm.DB, to, subject, body string) error {
+	return tx.Create(&model.MailOutbox{
+		To:            to,
+		Subject:       subject,
+		Body:          body,
+		Status:        model.MailStatusPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// notifyOutbox 事务提交后唤醒发件任务
+func notifyOutbox() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// mailThrottled 同一收件人最近已有邮件时返回 true，防止被用来轰炸邮箱
+func mailThrottled(to string) (bool, error) {
+	var count int64
+	err := repository.DB.Model(&model.MailOutbox{}).
+		Where("recipient = ? AND created_at > ?", to, time.Now().Add(-mailThrottleWindow)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// RunMailOutbox 后台发送发件箱中的邮件，直到 ctx 被取消
+func RunMailOutbox(ctx context.Context) {
+	interval := 5 * time.Second
+	if conf := config.GlobalConfig.Mail; conf.PollInterval > 0 {
+		interval = time.Duration(conf.PollInterval) * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := DispatchMail(ctx); err != nil {
+			middleware.Logger.Error("发送发件箱邮件失败", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-outboxWake:
+		}
+	}
+}
+
+// DispatchMail 发送一批到期的邮件，返回成功发送的数量
+func DispatchMail(ctx context.Context) (int, error) {
+	maxAttempts := config.GlobalConfig.Mail.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	from := config.GlobalConfig.Mail.From
+	if from == "" {
+		from = "FastGin <noreply@localhost>"
+	}
+
+	var pending []model.MailOutbox
+	err := repository.DB.
+		Where("status = ? AND next_attempt_at <= ?", model.MailStatusPending, time.Now()).
+		Order("id").Limit(mailBatchSize).
+		Find(&pending).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, m := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// 以尝试次数作为版本号抢占邮件，多实例部署时同一封邮件只会被一个实例发送
+		now := time.Now()
+		result := repository.DB.Model(&model.MailOutbox{}).
+			Where("id = ? AND status = ? AND attempts = ?", m.ID, model.MailStatusPending, m.Attempts).
+			Updates(map[string]interface{}{
+				"attempts":        m.Attempts + 1,
+				"next_attempt_at": now.Add(mailClaimLease),
+			})
+		if result.Error != nil {
+			return sent, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		m.Attempts++
+
+		sendErr := currentMailer().Send(ctx, &mail.Message{
+			From:    from,
+			To:      m.To,
+			Subject: m.Subject,
+			Body:    m.Body,
+		})
+
+		updates := map[string]interface{}{}
+		if sendErr == nil {
+			updates["status"] = model.MailStatusSent
+			updates["sent_at"] = time.Now()
+			updates["last_error"] = ""
+			sent++
+		} else {
+			updates["last_error"] = truncate(sendErr.Error(), 512)
+			if m.Attempts >= maxAttempts {
+				updates["status"] = model.MailStatusFailed
+			} else {
+				// 按指数退避重试：30 秒、1 分钟、2 分钟……最长 1 小时
+				backoff := 30 * time.Second << (m.Attempts - 1)
+				if backoff > time.Hour || backoff <= 0 {
+					backoff = time.Hour
+				}
+				updates["next_attempt_at"] = time.Now().Add(backoff)
+			}
+			middleware.Logger.Warn("邮件发送失败",
+				zap.Uint("id", m.ID),
+				zap.String("to", m.To),
+				zap.Int("attempts", m.Attempts),
+				zap.Error(sendErr))
+		}
+		if err := repository.DB.Model(&model.MailOutbox{}).Where("id = ?", m.ID).Updates(updates).Error; err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+// MenuAPIs 菜单绑定的接口
+type MenuAPIs struct {
+	Method string `json:"method" binding:"required" example:"POST"`
+	Path   string `json:"path" binding:"required" example:"/api/users"`
+}
+
+// MenuRequests 创建或修改菜单请求
+type MenuRequests struct {
+	ParentID uint `json:"parent_id" example:"2"`
+	// directory 目录，menu 菜单，button 按钮
+	Type       string     `json:"type" binding:"required" example:"button"`
+	Name       string     `json:"name" example:""`
+	Title      string     `json:"title" binding:"required" example:"新增用户"`
+	Path       string     `json:"path" example:""`
+	Component  string     `json:"component" example:""`
+	Redirect   string     `json:"redirect" example:""`
+	Icon       string     `json:"icon" example:""`
+	Permission string     `json:"permission" example:"user:create"`
+	Sort       int        `json:"sort" example:"1"`
+	Hidden     bool       `json:"hidden" example:"false"`
+	KeepAlive  bool       `json:"keep_alive" example:"false"`
+	Disabled   bool       `json:"disabled" example:"false"`
+	APIs       []MenuAPIs `json:"apis"`
+}
+
+// MenuNodes 菜单树节点
+type MenuNodes struct {
+	ID         uint        `json:"id" example:"2"`
+	ParentID   uint        `json:"parent_id" example:"1"`
+	Type       string      `json:"type" example:"menu"`
+	Name       string      `json:"name" example:"UserList"`
+	Title      string      `json:"title" example:"用户管理"`
+	Path       string      `json:"path" example:"/system/users"`
+	Component  string      `json:"component" example:"system/user/index"`
+	Redirect   string      `json:"redirect" example:""`
+	Icon       string      `json:"icon" example:"user"`
+	Permission string      `json:"permission" example:""`
+	Sort       int         `json:"sort" example:"1"`
+	Hidden     bool        `json:"hidden" example:"false"`
+	KeepAlive  bool        `json:"keep_alive" example:"true"`
+	Disabled   bool        `json:"disabled" example:"false"`
+	APIs       []MenuAPIs  `json:"apis"`
+	CreatedAt  string      `json:"created_at" example:"2025-03-01T12:00:00Z"`
+	UpdatedAt  string      `json:"updated_at" example:"2025-03-01T12:00:00Z"`
+	Children   []MenuNodes `json:"children"`
+}
+
+// RoleMenuRequests 设置角色菜单请求
+type RoleMenuRequests struct {
+	// 默认为当前租户
+	Dom     string `json:"dom" example:"tenant:1"`
+	MenuIDs []uint `json:"menu_ids" example:"1,2,3"`
+}
+
+// MenuMetas 前端路由的 meta
+type MenuMetas struct {
+	Title     string `json:"title" example:"用户管理"`
+	Icon      string `json:"icon" example:"user"`
+	Hidden    bool   `json:"hidden" example:"false"`
+	KeepAlive bool   `json:"keep_alive" example:"true"`
+}
+
+// MenuRoutes 前端路由
+type MenuRoutes struct {
+	ID        uint         `json:"id" example:"2"`
+	ParentID  uint         `json:"parent_id" example:"1"`
+	Name      string       `json:"name" example:"UserList"`
+	Path      string       `json:"path" example:"/system/users"`
+	Component string       `json:"component" example:"system/user/index"`
+	Redirect  string       `json:"redirect" example:""`
+	Meta      MenuMetas    `json:"meta"`
+	Children  []MenuRoutes `json:"children"`
+}
+
+// UserMenusResponses 当前用户的菜单和按钮权限
+type UserMenusResponses struct {
+	Menus       []MenuRoutes `json:"menus"`
+	Permissions []string     `json:"permissions" example:"user:create,user:delete"`
+}
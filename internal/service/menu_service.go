@@ -0,0 +1,690 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMenuNotFound = errors.New("菜单不存在")
+	ErrInvalidMenu  = errors.New("无效的菜单")
+	// ErrMenuInUse 菜单下还有子菜单或按钮时不能删除
+	ErrMenuInUse = errors.New("菜单下还有子菜单或按钮，不能删除")
+)
+
+// menuManagePath 可以访问该接口的用户能看到全部菜单
+const menuManagePath = "/api/menus"
+
+type MenuAPIRequest struct {
+	Method string `json:"method" binding:"required"`
+	Path   string `json:"path" binding:"required"`
+}
+
+type MenuRequest struct {
+	ParentID uint `json:"parent_id"`
+	// Type directory 目录，menu 菜单，button 按钮
+	Type       string           `json:"type" binding:"required,oneof=directory menu button"`
+	Name       string           `json:"name" binding:"max=64"`
+	Title      string           `json:"title" binding:"required,max=64"`
+	Path       string           `json:"path" binding:"max=255"`
+	Component  string           `json:"component" binding:"max=255"`
+	Redirect   string           `json:"redirect" binding:"max=255"`
+	Icon       string           `json:"icon" binding:"max=64"`
+	Permission string           `json:"permission" binding:"max=64"`
+	Sort       int              `json:"sort"`
+	Hidden     bool             `json:"hidden"`
+	KeepAlive  bool             `json:"keep_alive"`
+	Disabled   bool             `json:"disabled"`
+	APIs       []MenuAPIRequest `json:"apis" binding:"dive"`
+}
+
+type RoleMenuRequest struct {
+	// Dom 默认为操作者当前的租户
+	Dom     string `json:"dom"`
+	MenuIDs []uint `json:"menu_ids"`
+}
+
+// MenuNode 菜单树的节点
+type MenuNode struct {
+	model.Menu
+	Children []*MenuNode `json:"children"`
+}
+
+// MenuMeta 前端路由的 meta
+type MenuMeta struct {
+	Title     string `json:"title"`
+	Icon      string `json:"icon"`
+	Hidden    bool   `json:"hidden"`
+	KeepAlive bool   `json:"keep_alive"`
+}
+
+// MenuRoute 返回给前端的路由，不包含按钮
+type MenuRoute struct {
+	ID        uint         `json:"id"`
+	ParentID  uint         `json:"parent_id"`
+	Name      string       `json:"name"`
+	Path      string       `json:"path"`
+	Component string       `json:"component"`
+	Redirect  string       `json:"redirect"`
+	Meta      MenuMeta     `json:"meta"`
+	Children  []*MenuRoute `json:"children"`
+}
+
+// UserMenus 用户可以使用的菜单和按钮权限标识
+type UserMenus struct {
+	Menus       []*MenuRoute `json:"menus"`
+	Permissions []string     `json:"permissions"`
+}
+
+// menuGrant 菜单分配的对象：域内的角色
+type menuGrant struct {
+	Role   string
+	Domain string
+}
+
+// menuPolicy 菜单绑定的接口对应的策略 obj 和 act
+type menuPolicy struct {
+	Path   string
+	Method string
+}
+
+// checkMenuAdmin 菜单是所有租户共用的，只有平台管理员可以修改
+func checkMenuAdmin(op RBACOperator) error {
+	return checkDomain(op, "*")
+}
+
+func getMenu(db *gorm.DB, id uint) (*model.Menu, error) {
+	var menu model.Menu
+	err := db.Preload("APIs").First(&menu, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMenuNotFound
+	}
+	return &menu, err
+}
+
+// allMenus 按排序查询全部菜单
+func allMenus(db *gorm.DB) ([]model.Menu, error) {
+	var menus []model.Menu
+	err := db.Preload("APIs").Order("sort, id").Find(&menus).Error
+	return menus, err
+}
+
+// validate 检查菜单类型、上级菜单和绑定的接口，id 为修改的菜单，创建时为 0
+func (r *MenuRequest) validate(db *gorm.DB, id uint) error {
+	switch r.Type {
+	case model.MenuTypeMenu:
+		if r.Path == "" {
+			return fmt.Errorf("%w：菜单的 path 不能为空", ErrInvalidMenu)
+		}
+	case model.MenuTypeButton:
+		if r.Permission == "" {
+			return fmt.Errorf("%w：按钮的 permission 不能为空", ErrInvalidMenu)
+		}
+		if r.ParentID == 0 {
+			return fmt.Errorf("%w：按钮的上级必须是菜单", ErrInvalidMenu)
+		}
+	}
+
+	if r.ParentID != 0 {
+		menus, err := allMenus(db)
+		if err != nil {
+			return err
+		}
+		var parent *model.Menu
+		for i := range menus {
+			if menus[i].ID == r.ParentID {
+				parent = &menus[i]
+			}
+		}
+		if parent == nil {
+			return fmt.Errorf("%w：上级菜单不存在", ErrInvalidMenu)
+		}
+		if parent.Type == model.MenuTypeButton {
+			return fmt.Errorf("%w：按钮不能有下级", ErrInvalidMenu)
+		}
+		if r.Type == model.MenuTypeButton && parent.Type != model.MenuTypeMenu {
+			return fmt.Errorf("%w：按钮的上级必须是菜单", ErrInvalidMenu)
+		}
+		if id != 0 {
+			for _, descendant := range menuDescendants(menus, id) {
+				if descendant == r.ParentID {
+					return fmt.Errorf("%w：上级菜单不能是菜单自己或其下级", ErrInvalidMenu)
+				}
+			}
+		}
+	}
+
+	for i := range r.APIs {
+		api := MenuAPIRequest{
+			Method: strings.ToUpper(strings.TrimSpace(r.APIs[i].Method)),
+			Path:   strings.TrimSpace(r.APIs[i].Path),
+		}
+		if !objectPattern.MatchString(api.Path) || !policyActions[api.Method] {
+			return fmt.Errorf("%w：接口 %s %s 无效", ErrInvalidMenu, r.APIs[i].Method, r.APIs[i].Path)
+		}
+		if !routeRegistered(PolicyRule{Obj: api.Path, Act: api.Method}) {
+			return fmt.Errorf("%w：接口 %s %s 不匹配任何已注册的接口", ErrInvalidMenu, api.Method, api.Path)
+		}
+		r.APIs[i] = api
+	}
+	return nil
+}
+
+// routeRegistered 判断策略是否作用于权限目录中的某个接口，权限目录尚未生成时不检查
+func routeRegistered(rule PolicyRule) bool {
+	if len(routeCatalogue) == 0 {
+		return true
+	}
+	for _, route := range routeCatalogue {
+		if policyMatchesRoute(rule, route) {
+			return true
+		}
+	}
+	return false
+}
+
+// menuDescendants 返回 roots 及其全部下级菜单的 ID
+func menuDescendants(menus []model.Menu, roots ...uint) []uint {
+	children := make(map[uint][]uint)
+	for _, m := range menus {
+		children[m.ParentID] = append(children[m.ParentID], m.ID)
+	}
+	seen := make(map[uint]bool)
+	queue := append([]uint(nil), roots...)
+	ids := []uint{}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		queue = append(queue, children[id]...)
+	}
+	return ids
+}
+
+// menuAPIs 将请求中的接口转换为模型，去掉重复的接口
+func (r *MenuRequest) menuAPIs(menuID uint) []model.MenuAPI {
+	seen := make(map[MenuAPIRequest]bool)
+	apis := []model.MenuAPI{}
+	for _, api := range r.APIs {
+		if !seen[api] {
+			seen[api] = true
+			apis = append(apis, model.MenuAPI{MenuID: menuID, Method: api.Method, Path: api.Path})
+		}
+	}
+	return apis
+}
+
+func (r *MenuRequest) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"parent_id":  r.ParentID,
+		"type":       r.Type,
+		"name":       r.Name,
+		"title":      r.Title,
+		"path":       r.Path,
+		"component":  r.Component,
+		"redirect":   r.Redirect,
+		"icon":       r.Icon,
+		"permission": r.Permission,
+		"sort":       r.Sort,
+		"hidden":     r.Hidden,
+		"keep_alive": r.KeepAlive,
+		"disabled":   r.Disabled,
+	}
+}
+
+// ListMenus 以树的形式返回全部菜单和按钮，包括绑定的接口
+func ListMenus() ([]*MenuNode, error) {
+	menus, err := allMenus(repository.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[uint]*MenuNode, len(menus))
+	for i := range menus {
+		nodes[menus[i].ID] = &MenuNode{Menu: menus[i], Children: []*MenuNode{}}
+	}
+	tree := []*MenuNode{}
+	for i := range menus {
+		node := nodes[menus[i].ID]
+		if parent, ok := nodes[menus[i].ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			tree = append(tree, node)
+		}
+	}
+	return tree, nil
+}
+
+// CreateMenu 创建菜单或按钮
+func CreateMenu(op RBACOperator, req *MenuRequest) (*model.Menu, error) {
+	if err := checkMenuAdmin(op); err != nil {
+		return nil, err
+	}
+	if err := req.validate(repository.DB, 0); err != nil {
+		return nil, err
+	}
+
+	menu := &model.Menu{
+		ParentID:   req.ParentID,
+		Type:       req.Type,
+		Name:       req.Name,
+		Title:      req.Title,
+		Path:       req.Path,
+		Component:  req.Component,
+		Redirect:   req.Redirect,
+		Icon:       req.Icon,
+		Permission: req.Permission,
+		Sort:       req.Sort,
+		Hidden:     req.Hidden,
+		KeepAlive:  req.KeepAlive,
+		Disabled:   req.Disabled,
+	}
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(menu).Error; err != nil {
+			return err
+		}
+		if apis := req.menuAPIs(menu.ID); len(apis) > 0 {
+			if err := tx.Create(&apis).Error; err != nil {
+				return err
+			}
+			menu.APIs = apis
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auditPolicyChange(op, "create_menu", zap.Uint("menuID", menu.ID), zap.String("title", menu.Title))
+	return menu, nil
+}
+
+// UpdateMenu 修改菜单，绑定的接口变化时同步已分配该菜单的角色的策略
+func UpdateMenu(op RBACOperator, id uint, req *MenuRequest) error {
+	if err := checkMenuAdmin(op); err != nil {
+		return err
+	}
+	return syncMenuPolicies(op, func(tx *gorm.DB) ([]menuGrant, error) {
+		if _, err := getMenu(tx, id); err != nil {
+			return nil, err
+		}
+		return menuGrants(tx, id)
+	}, func(tx *gorm.DB) error {
+		if err := req.validate(tx, id); err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Menu{ID: id}).Updates(req.fields()).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("menu_id = ?", id).Delete(&model.MenuAPI{}).Error; err != nil {
+			return err
+		}
+		if apis := req.menuAPIs(id); len(apis) > 0 {
+			return tx.Create(&apis).Error
+		}
+		return nil
+	}, zap.Uint("menuID", id))
+}
+
+// DeleteMenu 删除没有下级的菜单或按钮，同时移除角色的菜单分配和对应的策略
+func DeleteMenu(op RBACOperator, id uint) error {
+	if err := checkMenuAdmin(op); err != nil {
+		return err
+	}
+	return syncMenuPolicies(op, func(tx *gorm.DB) ([]menuGrant, error) {
+		if _, err := getMenu(tx, id); err != nil {
+			return nil, err
+		}
+		var children int64
+		if err := tx.Model(&model.Menu{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return nil, err
+		}
+		if children > 0 {
+			return nil, ErrMenuInUse
+		}
+		return menuGrants(tx, id)
+	}, func(tx *gorm.DB) error {
+		if err := tx.Where("menu_id = ?", id).Delete(&model.RoleMenu{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("menu_id = ?", id).Delete(&model.MenuAPI{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Menu{}, id).Error
+	}, zap.Uint("menuID", id))
+}
+
+// GetRoleMenus 返回角色在域 dom 内分配的菜单和按钮
+func GetRoleMenus(op RBACOperator, role, dom string) ([]uint, error) {
+	if err := checkDomain(op, dom); err != nil {
+		return nil, err
+	}
+	ids := []uint{}
+	err := repository.DB.Model(&model.RoleMenu{}).
+		Where("role = ? AND domain = ?", role, dom).
+		Order("menu_id").Pluck("menu_id", &ids).Error
+	return ids, err
+}
+
+// SetRoleMenus 设置角色在域 dom 内的菜单和按钮，并同步菜单绑定的接口策略
+func SetRoleMenus(op RBACOperator, role string, req *RoleMenuRequest) error {
+	grant := menuGrant{Role: strings.TrimSpace(role), Domain: strings.TrimSpace(req.Dom)}
+	if !subjectPattern.MatchString(grant.Role) || !domainPattern.MatchString(grant.Domain) {
+		return fmt.Errorf("%w：角色或域格式错误", ErrInvalidPolicy)
+	}
+	if err := checkDomain(op, grant.Domain); err != nil {
+		return err
+	}
+	if _, err := findRoles(repository.DB, []string{grant.Role}); err != nil {
+		return err
+	}
+
+	return syncMenuPolicies(op, func(tx *gorm.DB) ([]menuGrant, error) {
+		return []menuGrant{grant}, nil
+	}, func(tx *gorm.DB) error {
+		seen := make(map[uint]bool)
+		var grants []model.RoleMenu
+		for _, id := range req.MenuIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			grants = append(grants, model.RoleMenu{Domain: grant.Domain, Role: grant.Role, MenuID: id})
+		}
+
+		var found int64
+		if err := tx.Model(&model.Menu{}).Where("id IN ?", append([]uint{0}, req.MenuIDs...)).Count(&found).Error; err != nil {
+			return err
+		}
+		if int(found) != len(grants) {
+			return fmt.Errorf("%w：菜单不存在", ErrInvalidMenu)
+		}
+
+		if err := tx.Where("role = ? AND domain = ?", grant.Role, grant.Domain).Delete(&model.RoleMenu{}).Error; err != nil {
+			return err
+		}
+		if len(grants) > 0 {
+			return tx.Create(&grants).Error
+		}
+		return nil
+	}, zap.String("role", grant.Role), zap.String("dom", grant.Domain), zap.Uints("menuIDs", req.MenuIDs))
+}
+
+// menuGrants 返回分配了菜单的全部角色
+func menuGrants(db *gorm.DB, menuID uint) ([]menuGrant, error) {
+	var grants []menuGrant
+	err := db.Model(&model.RoleMenu{}).Distinct("role", "domain").
+		Where("menu_id = ?", menuID).Scan(&grants).Error
+	return grants, err
+}
+
+// grantPolicies 返回角色在域内分配的菜单绑定的全部接口，包括已禁用的菜单
+func grantPolicies(db *gorm.DB, grant menuGrant) (map[menuPolicy]bool, error) {
+	var list []menuPolicy
+	err := db.Model(&model.RoleMenu{}).
+		Select("menu_apis.path, menu_apis.method").
+		Joins("JOIN menu_apis ON menu_apis.menu_id = role_menus.menu_id").
+		Where("role_menus.role = ? AND role_menus.domain = ?", grant.Role, grant.Domain).
+		Scan(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[menuPolicy]bool, len(list))
+	for _, p := range list {
+		set[p] = true
+	}
+	return set, nil
+}
+
+// syncMenuPolicies 在事务中执行 change，比较 change 前后受影响角色的菜单接口，增删对应的 p 策略；
+// 策略写入失败、修改后操作者无法再管理权限策略或事务提交失败时回滚，不会移除 change 前后都需要的策略，
+// 也不会移除不是菜单同步添加的策略
+func syncMenuPolicies(op RBACOperator, affected func(tx *gorm.DB) ([]menuGrant, error), change func(tx *gorm.DB) error, fields ...zap.Field) error {
+	var added, removed [][]string
+	applied := false
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		grants, err := affected(tx)
+		if err != nil {
+			return err
+		}
+		before := make([]map[menuPolicy]bool, len(grants))
+		for i, grant := range grants {
+			if before[i], err = grantPolicies(tx, grant); err != nil {
+				return err
+			}
+		}
+
+		if err := change(tx); err != nil {
+			return err
+		}
+
+		for i, grant := range grants {
+			after, err := grantPolicies(tx, grant)
+			if err != nil {
+				return err
+			}
+			for p := range after {
+				if !before[i][p] {
+					added = append(added, []string{grant.Role, grant.Domain, p.Path, p.Method})
+				}
+			}
+			for p := range before[i] {
+				if !after[p] {
+					removed = append(removed, []string{grant.Role, grant.Domain, p.Path, p.Method})
+				}
+			}
+		}
+
+		// 只移除菜单同步添加的策略，分配菜单之前已存在的策略保留
+		owned, err := ownedMenuPolicies(tx, removed)
+		if err != nil {
+			return err
+		}
+		if added, removed, err = applyMenuPolicies(added, owned); err != nil {
+			return err
+		}
+		applied = true
+		if err := recordMenuPolicies(tx, added, owned); err != nil {
+			return err
+		}
+		return checkLockout(op)
+	})
+	if err != nil {
+		if applied {
+			if _, _, restoreErr := applyMenuPolicies(removed, added); restoreErr != nil {
+				middleware.Logger.Error("恢复菜单策略失败", zap.Error(restoreErr))
+			}
+		}
+		return err
+	}
+
+	auditPolicyChange(op, "sync_menu_policies", append(fields,
+		zap.Int("added", len(added)),
+		zap.Int("removed", len(removed)))...)
+	return nil
+}
+
+// menuPolicyCond 按策略查询 menu_policies 的条件
+func menuPolicyCond(db *gorm.DB, rule []string) *gorm.DB {
+	return db.Where("role = ? AND domain = ? AND path = ? AND method = ?", rule[0], rule[1], rule[2], rule[3])
+}
+
+// ownedMenuPolicies 返回 rules 中由菜单同步添加的策略
+func ownedMenuPolicies(tx *gorm.DB, rules [][]string) ([][]string, error) {
+	var owned [][]string
+	for _, rule := range rules {
+		var count int64
+		if err := menuPolicyCond(tx.Model(&model.MenuPolicy{}), rule).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			owned = append(owned, rule)
+		}
+	}
+	return owned, nil
+}
+
+// recordMenuPolicies 记录菜单同步添加的策略，删除不再由菜单同步管理的策略的记录
+func recordMenuPolicies(tx *gorm.DB, added, released [][]string) error {
+	for _, rule := range released {
+		if err := menuPolicyCond(tx, rule).Delete(&model.MenuPolicy{}).Error; err != nil {
+			return err
+		}
+	}
+	for _, rule := range added {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.MenuPolicy{
+			Role: rule[0], Domain: rule[1], Path: rule[2], Method: rule[3],
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMenuPolicies 添加和移除策略，跳过已存在的和不存在的策略，返回实际添加和移除的策略
+func applyMenuPolicies(add, remove [][]string) ([][]string, [][]string, error) {
+	var added, removed [][]string
+	for _, rule := range add {
+		ok, err := enforcer.HasPolicy(rule)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			added = append(added, rule)
+		}
+	}
+	for _, rule := range remove {
+		ok, err := enforcer.HasPolicy(rule)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			removed = append(removed, rule)
+		}
+	}
+
+	if len(added) > 0 {
+		if _, err := enforcer.AddPolicies(added); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := enforcer.RemovePolicies(removed); err != nil {
+			if len(added) > 0 {
+				if _, restoreErr := enforcer.RemovePolicies(added); restoreErr != nil {
+					middleware.Logger.Error("恢复菜单策略失败", zap.Error(restoreErr))
+				}
+			}
+			return nil, nil, err
+		}
+	}
+	return added, removed, nil
+}
+
+// GetUserMenus 返回用户在租户内的角色可以使用的菜单树和按钮权限标识，
+// 可以管理菜单的用户（平台管理员）返回全部菜单；分配了下级菜单时自动包含其上级目录
+func GetUserMenus(userID, tenantID uint) (*UserMenus, error) {
+	sub := middleware.UserSubject(userID)
+	dom := middleware.TenantDomain(tenantID)
+
+	var menus []model.Menu
+	if err := repository.DB.Order("sort, id").Find(&menus).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*model.Menu, len(menus))
+	for i := range menus {
+		byID[menus[i].ID] = &menus[i]
+	}
+
+	granted := make(map[uint]bool)
+	manager, err := middleware.EnforceRequest(enforcer, nil, sub, dom, menuManagePath, "POST")
+	if err != nil {
+		return nil, err
+	}
+	if manager {
+		for _, m := range menus {
+			granted[m.ID] = true
+		}
+	} else {
+		roles, err := enforcer.GetImplicitRolesForUser(sub, dom)
+		if err != nil {
+			return nil, err
+		}
+		var ids []uint
+		if len(roles) > 0 {
+			err = repository.DB.Model(&model.RoleMenu{}).
+				Where("role IN ? AND domain IN ?", roles, []string{dom, "*"}).
+				Pluck("menu_id", &ids).Error
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range ids {
+			for m := byID[id]; m != nil && !granted[m.ID]; m = byID[m.ParentID] {
+				granted[m.ID] = true
+			}
+		}
+	}
+
+	// visible 菜单及其所有上级都没有被禁用
+	visible := func(m *model.Menu) bool {
+		for ; m != nil; m = byID[m.ParentID] {
+			if m.Disabled {
+				return false
+			}
+		}
+		return true
+	}
+
+	result := &UserMenus{Menus: []*MenuRoute{}, Permissions: []string{}}
+	nodes := make(map[uint]*MenuRoute)
+	for i := range menus {
+		m := &menus[i]
+		if !granted[m.ID] || !visible(m) {
+			continue
+		}
+		if m.Type == model.MenuTypeButton {
+			result.Permissions = append(result.Permissions, m.Permission)
+			continue
+		}
+		nodes[m.ID] = &MenuRoute{
+			ID:        m.ID,
+			ParentID:  m.ParentID,
+			Name:      m.Name,
+			Path:      m.Path,
+			Component: m.Component,
+			Redirect:  m.Redirect,
+			Meta:      MenuMeta{Title: m.Title, Icon: m.Icon, Hidden: m.Hidden, KeepAlive: m.KeepAlive},
+			Children:  []*MenuRoute{},
+		}
+	}
+	for i := range menus {
+		node, ok := nodes[menus[i].ID]
+		if !ok {
+			continue
+		}
+		if parent, ok := nodes[menus[i].ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			result.Menus = append(result.Menus, node)
+		}
+	}
+
+	slices.Sort(result.Permissions)
+	result.Permissions = slices.Compact(result.Permissions)
+	return result, nil
+}
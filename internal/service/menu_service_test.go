@@ -0,0 +1,179 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"testing"
+)
+
+// setupMenuTest 创建 editor 角色和绑定 GET /api/users 的用户菜单
+func setupMenuTest(t *testing.T) *model.Menu {
+	t.Helper()
+	setupTestDB(t)
+	if _, err := CreateRole(RBACOperator{}, &CreateRoleRequest{Code: "editor", Name: "editor"}); err != nil {
+		t.Fatal(err)
+	}
+	return createTestMenu(t, "用户", "/system/users", MenuAPIRequest{Method: "GET", Path: "/api/users"})
+}
+
+func createTestMenu(t *testing.T, title, path string, apis ...MenuAPIRequest) *model.Menu {
+	t.Helper()
+	menu, err := CreateMenu(RBACOperator{}, &MenuRequest{Type: model.MenuTypeMenu, Title: title, Path: path, APIs: apis})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return menu
+}
+
+func setRoleMenus(t *testing.T, role string, ids ...uint) {
+	t.Helper()
+	if err := SetRoleMenus(RBACOperator{}, role, &RoleMenuRequest{Dom: "tenant:1", MenuIDs: ids}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hasEditorPolicy(path, method string) bool {
+	ok, _ := enforcer.HasPolicy("editor", "tenant:1", path, method)
+	return ok
+}
+
+func TestSetRoleMenus(t *testing.T) {
+	users := setupMenuTest(t)
+	logs := createTestMenu(t, "日志", "/system/logs",
+		MenuAPIRequest{Method: "get", Path: " /api/logs "},
+		MenuAPIRequest{Method: "GET", Path: "/api/users"})
+
+	setRoleMenus(t, "editor", users.ID, logs.ID)
+	if !hasEditorPolicy("/api/users", "GET") || !hasEditorPolicy("/api/logs", "GET") {
+		t.Fatal("menu policies not added")
+	}
+	ids, err := GetRoleMenus(RBACOperator{}, "editor", "tenant:1")
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("role menus = %v, %v", ids, err)
+	}
+
+	// 其他菜单仍然需要的接口保留
+	setRoleMenus(t, "editor", logs.ID)
+	if !hasEditorPolicy("/api/users", "GET") {
+		t.Error("policy still needed by another menu removed")
+	}
+
+	setRoleMenus(t, "editor")
+	if hasEditorPolicy("/api/users", "GET") || hasEditorPolicy("/api/logs", "GET") {
+		t.Error("menu policies kept after unassigning all menus")
+	}
+	var owned int64
+	repository.DB.Model(&model.MenuPolicy{}).Count(&owned)
+	if owned != 0 {
+		t.Errorf("%d menu policy records left", owned)
+	}
+
+	// 菜单不存在时不修改分配和策略
+	err = SetRoleMenus(RBACOperator{}, "editor", &RoleMenuRequest{Dom: "tenant:1", MenuIDs: []uint{users.ID, 9999}})
+	if !errors.Is(err, ErrInvalidMenu) {
+		t.Fatalf("err = %v, want ErrInvalidMenu", err)
+	}
+	if hasEditorPolicy("/api/users", "GET") {
+		t.Error("policy added by a failed assignment")
+	}
+}
+
+func TestMenuKeepsManualPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		remove func(t *testing.T, menu *model.Menu)
+	}{
+		{"unassign", func(t *testing.T, menu *model.Menu) { setRoleMenus(t, "editor") }},
+		{"delete menu", func(t *testing.T, menu *model.Menu) {
+			if err := DeleteMenu(RBACOperator{}, menu.ID); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"change menu apis", func(t *testing.T, menu *model.Menu) {
+			err := UpdateMenu(RBACOperator{}, menu.ID, &MenuRequest{Type: model.MenuTypeMenu, Title: menu.Title, Path: menu.Path})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			menu := setupMenuTest(t)
+			// 分配菜单前通过 /api/rbac 添加的策略
+			if err := AddPolicy(RBACOperator{}, PolicyRule{Sub: "editor", Dom: "tenant:1", Obj: "/api/users", Act: "GET"}); err != nil {
+				t.Fatal(err)
+			}
+			setRoleMenus(t, "editor", menu.ID)
+			tc.remove(t, menu)
+			if !hasEditorPolicy("/api/users", "GET") {
+				t.Error("manually added policy removed by the menu sync")
+			}
+		})
+	}
+}
+
+func TestRemovePolicyReleasesMenuPolicy(t *testing.T) {
+	menu := setupMenuTest(t)
+	setRoleMenus(t, "editor", menu.ID)
+	rule := PolicyRule{Sub: "editor", Dom: "tenant:1", Obj: "/api/users", Act: "GET"}
+	if err := RemovePolicy(RBACOperator{}, rule); err != nil {
+		t.Fatal(err)
+	}
+	// 手动重新添加后归手动管理，取消分配菜单不再移除
+	if err := AddPolicy(RBACOperator{}, rule); err != nil {
+		t.Fatal(err)
+	}
+	setRoleMenus(t, "editor")
+	if !hasEditorPolicy("/api/users", "GET") {
+		t.Error("policy re-added through /api/rbac removed by the menu sync")
+	}
+}
+
+func TestUpdateMenuSyncsPolicies(t *testing.T) {
+	menu := setupMenuTest(t)
+	setRoleMenus(t, "editor", menu.ID)
+
+	err := UpdateMenu(RBACOperator{}, menu.ID, &MenuRequest{
+		Type: model.MenuTypeMenu, Title: menu.Title, Path: menu.Path,
+		APIs: []MenuAPIRequest{{Method: "POST", Path: "/api/users"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasEditorPolicy("/api/users", "GET") || !hasEditorPolicy("/api/users", "POST") {
+		t.Error("policies not synced with the menu apis")
+	}
+}
+
+func TestDeleteMenu(t *testing.T) {
+	menu := setupMenuTest(t)
+	button, err := CreateMenu(RBACOperator{}, &MenuRequest{
+		Type: model.MenuTypeButton, Title: "新增", ParentID: menu.ID, Permission: "user:create",
+		APIs: []MenuAPIRequest{{Method: "POST", Path: "/api/users"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setRoleMenus(t, "editor", menu.ID, button.ID)
+
+	if err := DeleteMenu(RBACOperator{}, menu.ID); !errors.Is(err, ErrMenuInUse) {
+		t.Fatalf("delete menu with a button: err = %v, want ErrMenuInUse", err)
+	}
+	if err := DeleteMenu(RBACOperator{}, button.ID); err != nil {
+		t.Fatal(err)
+	}
+	if hasEditorPolicy("/api/users", "POST") || !hasEditorPolicy("/api/users", "GET") {
+		t.Error("button policy not removed with the button")
+	}
+	ids, err := GetRoleMenus(RBACOperator{}, "editor", "tenant:1")
+	if err != nil || len(ids) != 1 || ids[0] != menu.ID {
+		t.Errorf("role menus = %v, %v", ids, err)
+	}
+
+	if err := DeleteMenu(RBACOperator{}, menu.ID); err != nil {
+		t.Fatal(err)
+	}
+	if hasEditorPolicy("/api/users", "GET") {
+		t.Error("menu policy kept after deleting the menu")
+	}
+}
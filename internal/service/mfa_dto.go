@@ -0,0 +1,36 @@
+package service
+
+// MFALoginRequests 两步验证登录请求参数，code 和 recovery_code 二选一
+type MFALoginRequests struct {
+	MFAToken     string `json:"mfa_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIs..."`
+	Code         string `json:"code" example:"123456"`
+	RecoveryCode string `json:"recovery_code" example:"3f9a2c-81b0d4"`
+}
+
+// MFASetupRequests 登录时设置两步验证请求参数
+type MFASetupRequests struct {
+	MFAToken string `json:"mfa_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIs..."`
+}
+
+// MFACodeRequests 验证码请求参数
+type MFACodeRequests struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// MFAEnrollResponses 两步验证密钥
+type MFAEnrollResponses struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/FastGin:admin?secret=JBSWY3DPEHPK3PXP&issuer=FastGin"`
+}
+
+// MFAStatusResponses 两步验证状态
+type MFAStatusResponses struct {
+	Enabled                bool  `json:"enabled" example:"true"`
+	Required               bool  `json:"required" example:"true"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining" example:"10"`
+}
+
+// MFARolePolicyRequests 角色两步验证要求请求参数
+type MFARolePolicyRequests struct {
+	Required bool `json:"required" example:"true"`
+}
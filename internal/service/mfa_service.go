@@ -0,0 +1,465 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fastgin/internal/utils"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	mfaIssuer            = "FastGin"
+	mfaRecoveryCodeCount = 10
+	mfaMaxFailedAttempts = 5
+)
+
+var (
+	ErrMFANotEnrolled      = errors.New("未启用两步验证")
+	ErrMFAAlreadyEnabled   = errors.New("已启用两步验证")
+	ErrMFASetupNotStarted  = errors.New("请先获取两步验证密钥")
+	ErrMFAInvalidCode      = errors.New("验证码错误")
+	ErrMFATooManyAttempts  = errors.New("验证码错误次数过多，请重新登录")
+	ErrMFARequiredByRole   = errors.New("当前角色要求启用两步验证，不能关闭")
+	ErrInvalidMFALoginCode = errors.New("请提供验证码或恢复码")
+)
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFASetupRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFARolePolicyRequest struct {
+	Required bool `json:"required"`
+}
+
+type MFAEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFAStatusResponse struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// mfaRequiredForUser 判断用户是否被要求启用两步验证：用户在任一域内的任一角色（包括继承的角色）要求即可
+func mfaRequiredForUser(user *model.User) (bool, error) {
+	roles, err := userImplicitRoles(user)
+	if err != nil {
+		return false, err
+	}
+	var count int64
+	err = repository.DB.Model(&model.MFARolePolicy{}).
+		Where("role IN ? AND required = ?", roles, true).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// mfaRequiredForUserID 按用户ID判断是否被要求启用两步验证
+func mfaRequiredForUserID(userID uint) (bool, error) {
+	var user model.User
+	if err := repository.DB.First(&user, userID).Error; err != nil {
+		return false, err
+	}
+	return mfaRequiredForUser(&user)
+}
+
+func getUserMFA(userID uint) (*model.UserMFA, error) {
+	var mfa model.UserMFA
+	err := repository.DB.Where("user_id = ?", userID).First(&mfa).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+// mfaChallenge 密码验证通过后，若用户已启用或角色要求两步验证，返回等待两步验证的响应
+func mfaChallenge(user *model.User) (*LoginResponse, error) {
+	mfa, err := getUserMFA(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	enabled := mfa != nil && mfa.Enabled
+
+	required, err := mfaRequiredForUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && !required {
+		return nil, nil
+	}
+
+	token, err := middleware.GenerateMFAToken(user.ID, user.Username, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResponse{
+		Username:         user.Username,
+		Role:             user.Role,
+		MFARequired:      true,
+		MFASetupRequired: !enabled,
+		MFAToken:         token,
+	}, nil
+}
+
+// SetupLoginMFA 角色要求两步验证但用户尚未启用时，使用两步验证令牌获取密钥
+func SetupLoginMFA(req *MFASetupRequest) (*MFAEnrollResponse, error) {
+	claims, err := middleware.ParseMFAToken(req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+	return EnrollMFA(claims.UserID, claims.Username)
+}
+
+// VerifyLoginMFA 校验两步验证令牌和验证码（或恢复码），通过后签发正式令牌
+// 对于尚未启用两步验证的用户，验证码校验通过即完成启用，并在响应中返回恢复码
+func VerifyLoginMFA(req *MFALoginRequest, client ClientInfo) (*LoginResponse, error) {
+	if req.Code == "" && req.RecoveryCode == "" {
+		return nil, ErrInvalidMFALoginCode
+	}
+
+	claims, err := middleware.ParseMFAToken(req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var user model.User
+	if err := repository.DB.First(&user, claims.UserID).Error; err != nil {
+		return nil, err
+	}
+	// 验证码错误同样计入登录失败次数，锁定期间不能继续尝试
+	if err := checkLoginAllowed(user.Username, client.IP); err != nil {
+		return nil, err
+	}
+
+	mfa, err := getUserMFA(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, ErrMFASetupNotStarted
+	}
+
+	var recoveryCodes []string
+	var ok bool
+	switch {
+	case !mfa.Enabled:
+		recoveryCodes, err = ConfirmMFA(user.ID, req.Code)
+		if err != nil && !errors.Is(err, ErrMFAInvalidCode) {
+			return nil, err
+		}
+		ok = err == nil
+	case req.Code != "":
+		ok, err = useTOTPCode(mfa, req.Code)
+	default:
+		ok, err = useRecoveryCode(user.ID, req.RecoveryCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		recordLoginFailure(user.Username, client.IP)
+		return nil, recordMFAFailure(mfa, claims)
+	}
+
+	// 两步验证令牌只能使用一次
+	if err := middleware.TokenStore.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+	repository.DB.Model(mfa).Update("failed_attempts", 0)
+
+	resp, err := issueTokenPair(repository.DB, &user, "", client)
+	if err != nil {
+		return nil, err
+	}
+	resp.RecoveryCodes = recoveryCodes
+	resetLoginFailures(user.Username)
+
+	middleware.Logger.Info("两步验证通过",
+		zap.String("username", user.Username))
+	return resp, nil
+}
+
+// recordMFAFailure 记录本次两步验证令牌的失败次数，超过上限后吊销令牌，需要重新输入密码；
+// 失败同时计入用户名和 IP 的登录失败次数，重新输入密码不会清除，因此总的猜测次数受登录锁定限制
+func recordMFAFailure(mfa *model.UserMFA, claims *middleware.JWTClaims) error {
+	middleware.Logger.Warn("两步验证失败",
+		zap.Uint("userID", mfa.UserID),
+		zap.Int("failedAttempts", mfa.FailedAttempts+1))
+
+	if mfa.FailedAttempts+1 < mfaMaxFailedAttempts {
+		if err := repository.DB.Model(mfa).Update("failed_attempts", gorm.Expr("failed_attempts + 1")).Error; err != nil {
+			return err
+		}
+		return ErrMFAInvalidCode
+	}
+
+	if err := repository.DB.Model(mfa).Update("failed_attempts", 0).Error; err != nil {
+		return err
+	}
+	if err := middleware.TokenStore.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+	return ErrMFATooManyAttempts
+}
+
+// useTOTPCode 校验验证码，同一时间步的验证码只能使用一次
+func useTOTPCode(mfa *model.UserMFA, code string) (bool, error) {
+	step, ok := utils.ValidateTOTP(mfa.Secret, strings.TrimSpace(code), time.Now(), 1)
+	if !ok {
+		return false, nil
+	}
+
+	result := repository.DB.Model(&model.UserMFA{}).
+		Where("id = ? AND last_used_step < ?", mfa.ID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// useRecoveryCode 使用一次性恢复码
+func useRecoveryCode(userID uint, code string) (bool, error) {
+	hash := utils.SHA256Hex(normalizeRecoveryCode(code))
+	result := repository.DB.Model(&model.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		middleware.Logger.Info("使用了两步验证恢复码", zap.Uint("userID", userID))
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// generateRecoveryCodes 生成新的恢复码并替换旧的恢复码
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, mfaRecoveryCodeCount)
+	records := make([]model.MFARecoveryCode, 0, mfaRecoveryCodeCount)
+	for i := 0; i < mfaRecoveryCodeCount; i++ {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(b)
+		codes = append(codes, raw[:6]+"-"+raw[6:])
+		records = append(records, model.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.SHA256Hex(raw),
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// EnrollMFA 生成新的 TOTP 密钥，验证码确认之前不会生效
+func EnrollMFA(userID uint, username string) (*MFAEnrollResponse, error) {
+	mfa, err := getUserMFA(userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa != nil && mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	record := &model.UserMFA{UserID: userID, Secret: secret}
+	err = repository.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "failed_attempts", "updated_at"}),
+	}).Create(record).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(mfaIssuer, username, secret),
+	}, nil
+}
+
+// ConfirmMFA 使用验证码确认密钥并启用两步验证，返回恢复码
+func ConfirmMFA(userID uint, code string) ([]string, error) {
+	mfa, err := getUserMFA(userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, ErrMFASetupNotStarted
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	ok, err := useTOTPCode(mfa, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMFAInvalidCode
+	}
+
+	var codes []string
+	err = repository.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(mfa).Updates(map[string]interface{}{"enabled": true, "enabled_at": &now}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = generateRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	middleware.Logger.Info("启用两步验证", zap.Uint("userID", userID))
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码
+func RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	mfa, err := getUserMFA(userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return nil, ErrMFANotEnrolled
+	}
+
+	ok, err := useTOTPCode(mfa, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMFAInvalidCode
+	}
+
+	var codes []string
+	err = repository.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = generateRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableMFA 校验验证码后关闭两步验证，角色要求两步验证时不允许关闭
+func DisableMFA(userID uint, code string) error {
+	required, err := mfaRequiredForUserID(userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequiredByRole
+	}
+
+	mfa, err := getUserMFA(userID)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return ErrMFANotEnrolled
+	}
+
+	ok, err := useTOTPCode(mfa, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrMFAInvalidCode
+	}
+
+	middleware.Logger.Info("关闭两步验证", zap.Uint("userID", userID))
+	return ResetUserMFA(userID)
+}
+
+// ResetUserMFA 删除用户的两步验证设置和恢复码，用于用户关闭或管理员重置
+func ResetUserMFA(userID uint) error {
+	return repository.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserMFA{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error
+	})
+}
+
+// GetMFAStatus 查询当前用户的两步验证状态
+func GetMFAStatus(userID uint) (*MFAStatusResponse, error) {
+	mfa, err := getUserMFA(userID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := mfaRequiredForUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MFAStatusResponse{
+		Enabled:  mfa != nil && mfa.Enabled,
+		Required: required,
+	}
+	err = repository.DB.Model(&model.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&status.RecoveryCodesRemaining).Error
+	return status, err
+}
+
+// ListMFARolePolicies 查询所有角色的两步验证要求
+func ListMFARolePolicies() ([]model.MFARolePolicy, error) {
+	var policies []model.MFARolePolicy
+	err := repository.DB.Order("role").Find(&policies).Error
+	return policies, err
+}
+
+// SetMFARolePolicy 设置角色是否必须启用两步验证，角色必须已存在
+func SetMFARolePolicy(role string, req *MFARolePolicyRequest) error {
+	if _, err := findRoles(repository.DB, []string{role}); err != nil {
+		return err
+	}
+	policy := &model.MFARolePolicy{Role: role, Required: req.Required}
+	return repository.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}},
+		DoUpdates: clause.AssignmentColumns([]string{"required", "updated_at"}),
+	}).Create(policy).Error
+}
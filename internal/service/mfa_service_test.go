@@ -0,0 +1,181 @@
+package service
+
+import (
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/utils"
+	"testing"
+	"time"
+)
+
+// totpCode 计算当前时间偏移 offset 个时间步的验证码
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enableTestMFA 为用户启用两步验证，确认时使用上一个时间步的验证码，返回密钥和恢复码
+func enableTestMFA(t *testing.T, user *model.User) (string, []string) {
+	t.Helper()
+	enroll, err := EnrollMFA(user.ID, user.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := ConfirmMFA(user.ID, totpCode(t, enroll.Secret, -1))
+	if err != nil {
+		t.Fatalf("ConfirmMFA: %v", err)
+	}
+	return enroll.Secret, codes
+}
+
+// mfaLogin 使用密码登录并返回两步验证令牌
+func mfaLogin(t *testing.T, username, password string) string {
+	t.Helper()
+	resp, err := Login(&LoginRequest{Username: username, Password: password}, testClient)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if resp.Token != "" || resp.RefreshToken != "" || !resp.MFARequired || resp.MFAToken == "" {
+		t.Fatalf("login issued tokens before two-factor authentication: %+v", resp)
+	}
+	return resp.MFAToken
+}
+
+func TestMFALogin(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	secret, _ := enableTestMFA(t, user)
+
+	mfaToken := mfaLogin(t, "alice", "Secret#123")
+	resp, err := VerifyLoginMFA(&MFALoginRequest{MFAToken: mfaToken, Code: totpCode(t, secret, 0)}, testClient)
+	if err != nil {
+		t.Fatalf("VerifyLoginMFA: %v", err)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("response = %+v", resp)
+	}
+
+	// 两步验证令牌只能使用一次
+	if _, err := VerifyLoginMFA(&MFALoginRequest{MFAToken: mfaToken, Code: totpCode(t, secret, 1)}, testClient); err == nil {
+		t.Error("two-factor token accepted twice")
+	}
+}
+
+func TestMFACodeReplay(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	secret, _ := enableTestMFA(t, user)
+	code := totpCode(t, secret, 0)
+
+	if _, err := VerifyLoginMFA(&MFALoginRequest{MFAToken: mfaLogin(t, "alice", "Secret#123"), Code: code}, testClient); err != nil {
+		t.Fatal(err)
+	}
+	for name, replay := range map[string]string{"same step": code, "earlier step": totpCode(t, secret, -1)} {
+		_, err := VerifyLoginMFA(&MFALoginRequest{MFAToken: mfaLogin(t, "alice", "Secret#123"), Code: replay}, testClient)
+		if !errors.Is(err, ErrMFAInvalidCode) {
+			t.Errorf("%s: err = %v, want ErrMFAInvalidCode", name, err)
+		}
+	}
+}
+
+func TestMFARecoveryCodeSingleUse(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	_, codes := enableTestMFA(t, user)
+
+	if _, err := VerifyLoginMFA(&MFALoginRequest{MFAToken: mfaLogin(t, "alice", "Secret#123"), RecoveryCode: codes[0]}, testClient); err != nil {
+		t.Fatalf("recovery code rejected: %v", err)
+	}
+	_, err := VerifyLoginMFA(&MFALoginRequest{MFAToken: mfaLogin(t, "alice", "Secret#123"), RecoveryCode: codes[0]}, testClient)
+	if !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("reused recovery code: err = %v, want ErrMFAInvalidCode", err)
+	}
+}
+
+func TestMFAFailuresLockAccount(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	secret, _ := enableTestMFA(t, user)
+	wrong := func(code string) string {
+		if code == "000000" {
+			return "111111"
+		}
+		return "000000"
+	}(totpCode(t, secret, 0))
+
+	// 每次重新输入密码获得新的两步验证令牌，验证码失败仍累计到登录锁定
+	var err error
+	for i := 0; i < currentLoginPolicy().maxAttempts; i++ {
+		_, err = VerifyLoginMFA(&MFALoginRequest{MFAToken: mfaLogin(t, "alice", "Secret#123"), Code: wrong}, testClient)
+		if !errors.Is(err, ErrMFAInvalidCode) && !errors.Is(err, ErrMFATooManyAttempts) {
+			t.Fatalf("attempt %d: err = %v, want ErrMFAInvalidCode", i+1, err)
+		}
+	}
+
+	var locked *LoginLockedError
+	if _, err := Login(&LoginRequest{Username: "alice", Password: "Secret#123"}, testClient); !errors.As(err, &locked) {
+		t.Fatalf("login after repeated two-factor failures: err = %v, want LoginLockedError", err)
+	}
+}
+
+func TestMFATooManyAttemptsRevokesChallenge(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	secret, _ := enableTestMFA(t, user)
+	// 放宽登录锁定，只验证单个两步验证令牌的失败上限
+	config.GlobalConfig.Login.MaxAttempts = 100
+	mfaToken := mfaLogin(t, "alice", "Secret#123")
+
+	var err error
+	for i := 0; i < mfaMaxFailedAttempts; i++ {
+		_, err = VerifyLoginMFA(&MFALoginRequest{MFAToken: mfaToken, RecoveryCode: "not-a-code"}, testClient)
+	}
+	if !errors.Is(err, ErrMFATooManyAttempts) {
+		t.Fatalf("err = %v, want ErrMFATooManyAttempts", err)
+	}
+	if _, err := VerifyLoginMFA(&MFALoginRequest{MFAToken: mfaToken, Code: totpCode(t, secret, 0)}, testClient); err == nil {
+		t.Error("revoked two-factor token accepted")
+	}
+}
+
+func TestMFARequiredByInheritedRole(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	if _, err := CreateRole(RBACOperator{}, &CreateRoleRequest{Code: "auditor", Name: "审计"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMFARolePolicy("auditor", &MFARolePolicyRequest{Required: true}); err != nil {
+		t.Fatal(err)
+	}
+	if resp := loginTestUser(t, "alice", "Secret#123"); resp.MFARequired {
+		t.Fatal("two-factor authentication required before the role was granted")
+	}
+
+	// 通过其他租户的授权继承要求两步验证的角色
+	if _, err := enforcer.AddGroupingPolicy("user", "auditor", middleware.TenantDomain(2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enforcer.AddGroupingPolicy(middleware.UserSubject(user.ID), "user", middleware.TenantDomain(2)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Login(&LoginRequest{Username: "alice", Password: "Secret#123"}, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.MFARequired || !resp.MFASetupRequired || resp.Token != "" {
+		t.Errorf("inherited role requiring two-factor authentication ignored: %+v", resp)
+	}
+}
+
+func TestSetMFARolePolicyUnknownRole(t *testing.T) {
+	setupTestDB(t)
+	if err := SetMFARolePolicy("ghost", &MFARolePolicyRequest{Required: true}); !errors.Is(err, ErrRoleNotFound) {
+		t.Fatalf("err = %v, want ErrRoleNotFound", err)
+	}
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fastgin/internal/idp"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fastgin/internal/utils"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const oauthStateTTL = 10 * time.Minute
+
+var (
+	ErrInvalidOAuthState = errors.New("无效或已过期的登录请求")
+	ErrOAuthUserDeleted  = errors.New("关联的本地用户已被删除")
+	// ErrOAuthExchange 授权码换取或 ID Token 校验失败，具体原因只记录在日志中
+	ErrOAuthExchange = errors.New("身份提供方登录失败")
+)
+
+type OAuthCallbackRequest struct {
+	Code  string `form:"code" binding:"required"`
+	State string `form:"state" binding:"required"`
+}
+
+// OAuthLoginURL 生成 state、nonce 和 PKCE 校验码，返回跳转到身份提供方的登录地址
+func OAuthLoginURL(ctx context.Context, providerName string) (string, error) {
+	provider, err := idp.Get(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := utils.RandomToken(48)
+	if err != nil {
+		return "", err
+	}
+
+	// 顺便清理过期的登录请求
+	repository.DB.Where("expires_at < ?", time.Now()).Delete(&model.OAuthState{})
+
+	record := &model.OAuthState{
+		State:        state,
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oauthStateTTL),
+	}
+	if err := repository.DB.Create(record).Error; err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	return provider.AuthCodeURL(ctx, idp.AuthRequest{
+		State:         state,
+		Nonce:         nonce,
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(challenge[:]),
+	})
+}
+
+// OAuthCallback 校验 state，用授权码换取身份，关联或创建本地用户后按与密码登录相同的流程签发 FastGin 令牌，
+// 包括账号激活检查和两步验证
+func OAuthCallback(ctx context.Context, providerName string, req *OAuthCallbackRequest, client ClientInfo) (*LoginResponse, error) {
+	provider, err := idp.Get(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var state model.OAuthState
+	err = repository.DB.Where("state = ? AND provider = ?", req.State, providerName).First(&state).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOAuthState
+		}
+		return nil, err
+	}
+
+	// state 只能使用一次
+	result := repository.DB.Delete(&model.OAuthState{}, state.ID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(state.ExpiresAt) {
+		return nil, ErrInvalidOAuthState
+	}
+
+	identity, err := provider.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		middleware.Logger.Warn("OIDC身份校验失败",
+			zap.String("provider", providerName),
+			zap.Error(err))
+		return nil, fmt.Errorf("%w: %w", ErrOAuthExchange, err)
+	}
+
+	user, err := provisionUser(provider, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	middleware.Logger.Info("OIDC身份校验通过",
+		zap.String("provider", providerName),
+		zap.String("subject", identity.Subject),
+		zap.String("username", user.Username),
+		zap.String("role", user.Role))
+	return completeLogin(user, client)
+}
+
+// provisionUser 查找已关联的本地用户，首次登录时关联同名用户或按用户组映射的角色创建新用户；
+// 已有用户的角色在本地管理，只有提供方配置为角色的权威来源（syncRoles）时才在每次登录时同步主角色
+func provisionUser(provider idp.Provider, identity *idp.Identity) (*model.User, error) {
+	role := provider.MapRole(identity.Groups)
+
+	var user model.User
+	var before, after []string
+	var created, roleChanged bool
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		var link model.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&user, link.UserID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrOAuthUserDeleted
+				}
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			created, err = linkOrCreateUser(tx, provider, identity, role, &user)
+			if err != nil {
+				return err
+			}
+			link = model.UserIdentity{
+				UserID:   user.ID,
+				Provider: identity.Provider,
+				Subject:  identity.Subject,
+				Email:    identity.Email,
+			}
+			if err := tx.Create(&link).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		if !created && !provider.SyncRoles() {
+			return nil
+		}
+		oldRole := user.Role
+		if user.Role != role {
+			if err := tx.Model(&user).Update("role", role).Error; err != nil {
+				return err
+			}
+			roleChanged = true
+		}
+		before, after, err = replaceUserRole(tx, user.ID, oldRole, role)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := syncUserGroupings(user.ID, user.TenantID, before, after); err != nil {
+		return nil, err
+	}
+
+	// 角色变化后，之前签发的令牌全部失效
+	if roleChanged {
+		if err := RevokeUserTokens(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// linkOrCreateUser 关联同名的本地用户或创建新用户，返回是否创建了新用户
+func linkOrCreateUser(tx *gorm.DB, provider idp.Provider, identity *idp.Identity, role string, user *model.User) (bool, error) {
+	username := oauthUsername(identity)
+
+	if provider.LinkByUsername() && identity.Username != "" {
+		var local model.User
+		err := tx.Where("username = ?", identity.Username).First(&local).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+		if err == nil {
+			ok, err := canLinkUser(&local, identity)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				middleware.Logger.Info("关联已有本地用户",
+					zap.String("provider", identity.Provider),
+					zap.String("username", local.Username))
+				*user = local
+				return false, nil
+			}
+			middleware.Logger.Warn("不满足关联条件，为外部身份创建新用户",
+				zap.String("provider", identity.Provider),
+				zap.String("subject", identity.Subject),
+				zap.String("username", local.Username))
+		}
+	}
+
+	var count int64
+	if err := tx.Model(&model.User{}).Unscoped().Where("username = ?", username).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		suffix, err := utils.RandomToken(4)
+		if err != nil {
+			return false, err
+		}
+		username = fmt.Sprintf("%s_%s", truncate(username, 25), suffix)
+	}
+
+	// 外部账号不使用本地密码，写入随机密码
+	password, err := utils.RandomToken(32)
+	if err != nil {
+		return false, err
+	}
+	*user = model.User{
+		TenantID: model.DefaultTenantID,
+		Username: username,
+		Password: password,
+		Role:     role,
+	}
+	if err := user.HashPassword(); err != nil {
+		return false, err
+	}
+	return true, tx.Create(user).Error
+}
+
+// canLinkUser 同名本地用户只有在双方邮箱都已验证且一致、并且不是特权用户时才能自动关联，
+// 避免在 IdP 中注册同名账号即可接管本地管理员
+func canLinkUser(local *model.User, identity *idp.Identity) (bool, error) {
+	if !identity.EmailVerified || identity.Email == "" || local.EmailVerifiedAt == nil ||
+		normalizeEmail(identity.Email) != local.EmailAddress() {
+		return false, nil
+	}
+	privileged, err := privilegedUser(local)
+	return !privileged, err
+}
+
+// privilegedUser 用户在任一域内拥有 admin 角色，或可以在所属租户内管理权限策略
+func privilegedUser(user *model.User) (bool, error) {
+	roles, err := userImplicitRoles(user)
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(roles, platformAdminRole) {
+		return true, nil
+	}
+	return middleware.EnforceRequest(enforcer, nil, middleware.UserSubject(user.ID),
+		middleware.TenantDomain(user.TenantID), rbacGuardPath, "POST")
+}
+
+// oauthUsername 依次使用用户名声明、邮箱前缀和 provider_sub 作为本地用户名
+func oauthUsername(identity *idp.Identity) string {
+	username := identity.Username
+	if username == "" && identity.Email != "" {
+		username = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	if username == "" {
+		username = identity.Provider + "_" + identity.Subject
+	}
+	return truncate(username, 32)
+}
+
+// truncate 按字符截断字符串
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
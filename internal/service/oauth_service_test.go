@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/idp"
+	"fastgin/internal/idp/idptest"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// setupOAuth 启动模拟身份提供方并注册为 stub，组 ops 映射为 operator 角色
+func setupOAuth(t *testing.T, configure func(*config.OIDCProviderConfig)) *idptest.Server {
+	t.Helper()
+	setupTestDB(t)
+	if _, err := CreateRole(RBACOperator{}, &CreateRoleRequest{Code: "operator", Name: "运维"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := idptest.NewServer("app", "secret")
+	t.Cleanup(s.Close)
+	conf := config.OIDCProviderConfig{
+		Name:         "stub",
+		Issuer:       s.URL,
+		ClientID:     "app",
+		ClientSecret: "secret",
+		RedirectURL:  "http://app.test/api/oauth/stub/callback",
+		RoleMappings: []config.OIDCRoleMapping{{Group: "ops", Role: "operator"}},
+	}
+	if configure != nil {
+		configure(&conf)
+	}
+	idp.Register(idp.NewOIDCProvider(conf))
+	return s
+}
+
+// startSSO 发起单点登录并在身份提供方完成授权，返回回调参数
+func startSSO(t *testing.T, s *idptest.Server, claims jwt.MapClaims) *OAuthCallbackRequest {
+	t.Helper()
+	s.Claims = claims
+	authURL, err := OAuthLoginURL(context.Background(), "stub")
+	if err != nil {
+		t.Fatalf("OAuthLoginURL: %v", err)
+	}
+	code, state, err := s.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return &OAuthCallbackRequest{Code: code, State: state}
+}
+
+// ssoLogin 完成一次单点登录
+func ssoLogin(t *testing.T, s *idptest.Server, claims jwt.MapClaims) (*LoginResponse, error) {
+	t.Helper()
+	return OAuthCallback(context.Background(), "stub", startSSO(t, s, claims), testClient)
+}
+
+// linkedUser 查询外部身份关联的本地用户
+func linkedUser(t *testing.T, subject string) *model.User {
+	t.Helper()
+	var link model.UserIdentity
+	if err := repository.DB.Where("provider = ? AND subject = ?", "stub", subject).First(&link).Error; err != nil {
+		t.Fatalf("identity %s not linked: %v", subject, err)
+	}
+	var user model.User
+	if err := repository.DB.First(&user, link.UserID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func verifyEmail(t *testing.T, user *model.User, email string) {
+	t.Helper()
+	now := time.Now()
+	err := repository.DB.Model(user).Updates(map[string]interface{}{"email": email, "email_verified_at": &now}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOAuthCallbackProvisionsUser(t *testing.T) {
+	s := setupOAuth(t, nil)
+
+	resp, err := ssoLogin(t, s, jwt.MapClaims{"sub": "u-1", "preferred_username": "carol", "groups": []string{"ops"}})
+	if err != nil {
+		t.Fatalf("OAuthCallback: %v", err)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" || resp.Role != "operator" {
+		t.Fatalf("response = %+v", resp)
+	}
+	user := linkedUser(t, "u-1")
+	if user.Username != "carol" || user.Role != "operator" || user.TenantID != model.DefaultTenantID {
+		t.Errorf("user = %+v", user)
+	}
+	ok, err := enforcer.HasGroupingPolicy(middleware.UserSubject(user.ID), "operator", middleware.TenantDomain(user.TenantID))
+	if err != nil || !ok {
+		t.Errorf("grouping for provisioned user missing: %v", err)
+	}
+
+	// 再次登录使用已关联的用户
+	if _, err := ssoLogin(t, s, jwt.MapClaims{"sub": "u-1", "preferred_username": "carol", "groups": []string{"ops"}}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	repository.DB.Model(&model.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("users = %d, want 1", count)
+	}
+}
+
+func TestOAuthStateSingleUse(t *testing.T) {
+	s := setupOAuth(t, nil)
+	req := startSSO(t, s, jwt.MapClaims{"sub": "u-1"})
+
+	if _, err := OAuthCallback(context.Background(), "stub", req, testClient); err != nil {
+		t.Fatalf("first callback: %v", err)
+	}
+	if _, err := OAuthCallback(context.Background(), "stub", req, testClient); !errors.Is(err, ErrInvalidOAuthState) {
+		t.Errorf("replayed state: err = %v, want ErrInvalidOAuthState", err)
+	}
+	unknown := &OAuthCallbackRequest{Code: req.Code, State: "unknown"}
+	if _, err := OAuthCallback(context.Background(), "stub", unknown, testClient); !errors.Is(err, ErrInvalidOAuthState) {
+		t.Errorf("unknown state: err = %v, want ErrInvalidOAuthState", err)
+	}
+}
+
+func TestOAuthStateExpired(t *testing.T) {
+	s := setupOAuth(t, nil)
+	req := startSSO(t, s, jwt.MapClaims{"sub": "u-1"})
+	err := repository.DB.Model(&model.OAuthState{}).Where("state = ?", req.State).
+		Update("expires_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OAuthCallback(context.Background(), "stub", req, testClient); !errors.Is(err, ErrInvalidOAuthState) {
+		t.Fatalf("expired state: err = %v, want ErrInvalidOAuthState", err)
+	}
+	var count int64
+	repository.DB.Model(&model.OAuthState{}).Where("state = ?", req.State).Count(&count)
+	if count != 0 {
+		t.Error("expired state was not consumed")
+	}
+}
+
+func TestOAuthStateBoundToProvider(t *testing.T) {
+	s := setupOAuth(t, nil)
+	idp.Register(idp.NewOIDCProvider(config.OIDCProviderConfig{Name: "other", Issuer: s.URL, ClientID: "app"}))
+	req := startSSO(t, s, jwt.MapClaims{"sub": "u-1"})
+
+	if _, err := OAuthCallback(context.Background(), "other", req, testClient); !errors.Is(err, ErrInvalidOAuthState) {
+		t.Fatalf("state of another provider: err = %v, want ErrInvalidOAuthState", err)
+	}
+}
+
+func TestOAuthCallbackRejectsInvalidIDToken(t *testing.T) {
+	s := setupOAuth(t, nil)
+
+	for name, claims := range map[string]jwt.MapClaims{
+		"nonce":    {"sub": "u-1", "nonce": "forged"},
+		"audience": {"sub": "u-1", "aud": "someone-else"},
+		"issuer":   {"sub": "u-1", "iss": "https://evil.example.com"},
+		"expired":  {"sub": "u-1", "exp": time.Now().Add(-time.Hour).Unix()},
+	} {
+		if _, err := ssoLogin(t, s, claims); !errors.Is(err, ErrOAuthExchange) {
+			t.Errorf("%s: err = %v, want ErrOAuthExchange", name, err)
+		}
+	}
+	var count int64
+	repository.DB.Model(&model.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("users created from invalid id_token: %d", count)
+	}
+}
+
+func TestOAuthLinkByUsername(t *testing.T) {
+	tests := []struct {
+		name          string
+		role          string
+		localVerified bool
+		localEmail    string
+		claims        jwt.MapClaims
+		link          bool
+	}{
+		{
+			name:          "verified matching email",
+			role:          "user",
+			localVerified: true,
+			localEmail:    "alice@example.com",
+			claims:        jwt.MapClaims{"email": "Alice@Example.com", "email_verified": true},
+			link:          true,
+		},
+		{
+			name:          "identity email not verified",
+			role:          "user",
+			localVerified: true,
+			localEmail:    "alice@example.com",
+			claims:        jwt.MapClaims{"email": "alice@example.com", "email_verified": false},
+		},
+		{
+			name:       "local email not verified",
+			role:       "user",
+			localEmail: "alice@example.com",
+			claims:     jwt.MapClaims{"email": "alice@example.com", "email_verified": true},
+		},
+		{
+			name:          "different email",
+			role:          "user",
+			localVerified: true,
+			localEmail:    "alice@example.com",
+			claims:        jwt.MapClaims{"email": "mallory@example.com", "email_verified": true},
+		},
+		{
+			name:          "privileged user",
+			role:          "admin",
+			localVerified: true,
+			localEmail:    "alice@example.com",
+			claims:        jwt.MapClaims{"email": "alice@example.com", "email_verified": true},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := setupOAuth(t, func(c *config.OIDCProviderConfig) { c.LinkByUsername = true })
+			local := createTestUser(t, "alice", "Secret#123", tc.role)
+			if tc.localVerified {
+				verifyEmail(t, local, tc.localEmail)
+			} else if err := repository.DB.Model(local).Update("email", tc.localEmail).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			claims := jwt.MapClaims{"sub": "u-1", "preferred_username": "alice"}
+			for k, v := range tc.claims {
+				claims[k] = v
+			}
+			if _, err := ssoLogin(t, s, claims); err != nil {
+				t.Fatalf("OAuthCallback: %v", err)
+			}
+			user := linkedUser(t, "u-1")
+			if linked := user.ID == local.ID; linked != tc.link {
+				t.Errorf("linked = %v, want %v (user %s)", linked, tc.link, user.Username)
+			}
+			if !tc.link && user.Username == "alice" {
+				t.Error("new user reused the local username")
+			}
+		})
+	}
+}
+
+func TestOAuthLinkByUsernameDisabled(t *testing.T) {
+	s := setupOAuth(t, nil)
+	local := createTestUser(t, "alice", "Secret#123", "user")
+	verifyEmail(t, local, "alice@example.com")
+
+	_, err := ssoLogin(t, s, jwt.MapClaims{"sub": "u-1", "preferred_username": "alice", "email": "alice@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := linkedUser(t, "u-1"); user.ID == local.ID {
+		t.Error("linked to the local user although linkByUsername is off")
+	}
+}
+
+func TestOAuthRoleSync(t *testing.T) {
+	for _, syncRoles := range []bool{false, true} {
+		s := setupOAuth(t, func(c *config.OIDCProviderConfig) { c.SyncRoles = syncRoles })
+		if _, err := ssoLogin(t, s, jwt.MapClaims{"sub": "u-1", "groups": []string{"ops"}}); err != nil {
+			t.Fatal(err)
+		}
+		// IdP 中移出 ops 组后再次登录
+		resp, err := ssoLogin(t, s, jwt.MapClaims{"sub": "u-1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := "operator"
+		if syncRoles {
+			want = "user"
+		}
+		user := linkedUser(t, "u-1")
+		if user.Role != want || resp.Role != want {
+			t.Errorf("syncRoles=%v: role = %s (response %s), want %s", syncRoles, user.Role, resp.Role, want)
+		}
+		ok, err := enforcer.HasGroupingPolicy(middleware.UserSubject(user.ID), want, middleware.TenantDomain(user.TenantID))
+		if err != nil || !ok {
+			t.Errorf("syncRoles=%v: grouping for %s missing", syncRoles, want)
+		}
+	}
+}
+
+func TestOAuthCallbackRequiresMFA(t *testing.T) {
+	s := setupOAuth(t, nil)
+	if err := SetMFARolePolicy("operator", &MFARolePolicyRequest{Required: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := ssoLogin(t, s, jwt.MapClaims{"sub": "u-1", "groups": []string{"ops"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Token != "" || resp.RefreshToken != "" || !resp.MFARequired || resp.MFAToken == "" {
+		t.Errorf("SSO login skipped two-factor authentication: %+v", resp)
+	}
+}
+
+func TestOAuthCallbackPendingActivation(t *testing.T) {
+	s := setupOAuth(t, nil)
+	local := createTestUser(t, "pending", "Secret#123", "user")
+	if err := repository.DB.Model(local).Update("pending_activation", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	link := model.UserIdentity{UserID: local.ID, Provider: "stub", Subject: "u-1"}
+	if err := repository.DB.Create(&link).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ssoLogin(t, s, jwt.MapClaims{"sub": "u-1"}); !errors.Is(err, ErrAccountNotActivated) {
+		t.Fatalf("err = %v, want ErrAccountNotActivated", err)
+	}
+}
+
+func TestOAuthCallbackMustChangePassword(t *testing.T) {
+	s := setupOAuth(t, nil)
+	local := createTestUser(t, "initial", "Secret#123", "user")
+	if err := repository.DB.Model(local).Update("must_change_password", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	link := model.UserIdentity{UserID: local.ID, Provider: "stub", Subject: "u-1"}
+	if err := repository.DB.Create(&link).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := ssoLogin(t, s, jwt.MapClaims{"sub": "u-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.MustChangePassword {
+		t.Errorf("response = %+v, want MustChangePassword", resp)
+	}
+}
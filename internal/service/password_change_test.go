@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fastgin/internal/repository"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMustChangePassword(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	if err := repository.DB.Model(user).Update("must_change_password", true).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 必须修改密码的用户只能拿到修改密码用的令牌，刷新后仍然受限
+	resp := loginTestUser(t, "alice", "Secret#123")
+	if !resp.MustChangePassword {
+		t.Error("login response does not require a password change")
+	}
+	if status, _ := tokenContext(t, resp.Token); status != http.StatusForbidden {
+		t.Errorf("restricted token: status = %d, want 403", status)
+	}
+	refreshed, err := RefreshToken(&RefreshTokenRequest{RefreshToken: resp.RefreshToken}, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := tokenContext(t, refreshed.Token); !refreshed.MustChangePassword || status != http.StatusForbidden {
+		t.Errorf("refreshed token: must_change_password = %v, status = %d, want 403", refreshed.MustChangePassword, status)
+	}
+
+	changed, err := ChangePassword(user.ID, &ChangePasswordRequest{OldPassword: "Secret#123", NewPassword: "Changed#456"}, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.MustChangePassword {
+		t.Error("password change still required after changing the password")
+	}
+	if status, _ := tokenContext(t, changed.Token); status != http.StatusOK {
+		t.Errorf("token after changing the password: status = %d, want 200", status)
+	}
+	if status, _ := tokenContext(t, refreshed.Token); status != http.StatusUnauthorized {
+		t.Errorf("restricted token after changing the password: status = %d, want 401", status)
+	}
+}
+
+func TestAdminResetRequiresPasswordChange(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Secret#123", "user")
+	before := loginTestUser(t, "alice", "Secret#123")
+	time.Sleep(2 * time.Millisecond)
+
+	if err := UpdateUser(adminScope(t), user.ID, &UpdateUserRequest{Password: "Reset#4567"}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := tokenContext(t, before.Token); status != http.StatusUnauthorized {
+		t.Errorf("token issued before the reset: status = %d, want 401", status)
+	}
+	resp := loginTestUser(t, "alice", "Reset#4567")
+	if status, _ := tokenContext(t, resp.Token); !resp.MustChangePassword || status != http.StatusForbidden {
+		t.Errorf("login after an admin reset: must_change_password = %v, status = %d, want 403", resp.MustChangePassword, status)
+	}
+}
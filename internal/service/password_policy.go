@@ -0,0 +1,211 @@
+package service
+
+import (
+	"bufio"
+	_ "embed"
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/utils"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+//go:embed common_passwords.txt
+var bundledCommonPasswords string
+
+// PasswordViolation 密码不满足的单条策略
+type PasswordViolation struct {
+	Rule    string `json:"rule" example:"min_length"`
+	Message string `json:"message" example:"密码长度不能少于8位"`
+}
+
+// PasswordPolicyError 密码不满足策略，Violations 列出所有未通过的规则
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return "密码不符合要求：" + strings.Join(msgs, "；")
+}
+
+// currentPasswordPolicy 返回当前密码策略，未配置的长度限制使用默认值
+func currentPasswordPolicy() config.PasswordConfig {
+	p := config.GlobalConfig.Password
+	if p.MinLength <= 0 {
+		p.MinLength = 8
+	}
+	if p.MaxLength <= 0 {
+		p.MaxLength = 64
+	}
+	return p
+}
+
+// InitPasswordHasher 根据配置设置新密码使用的哈希算法，旧算法的哈希在用户下次登录时自动升级。
+// 同时重新生成用户不存在时校验的哈希，使两种情况的耗时一致
+func InitPasswordHasher(conf config.PasswordConfig) {
+	switch conf.Algorithm {
+	case "bcrypt":
+		utils.SetPasswordHasher(utils.NewBcryptHasher(conf.BcryptCost))
+	default:
+		utils.SetPasswordHasher(utils.NewArgon2idHasher(utils.Argon2Params{
+			Memory:      conf.Argon2Memory,
+			Iterations:  conf.Argon2Iterations,
+			Parallelism: conf.Argon2Parallelism,
+		}))
+	}
+	resetDummyPassword()
+}
+
+// ValidatePassword 校验密码长度、字符类型和常见弱密码，返回 *PasswordPolicyError
+func ValidatePassword(password string) error {
+	p := currentPasswordPolicy()
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{"min_length", fmt.Sprintf("密码长度不能少于%d位", p.MinLength)})
+	}
+	if length > p.MaxLength {
+		violations = append(violations, PasswordViolation{"max_length", fmt.Sprintf("密码长度不能超过%d位", p.MaxLength)})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, PasswordViolation{"require_upper", "密码必须包含大写字母"})
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, PasswordViolation{"require_lower", "密码必须包含小写字母"})
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, PasswordViolation{"require_digit", "密码必须包含数字"})
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, PasswordViolation{"require_symbol", "密码必须包含特殊字符"})
+	}
+
+	if p.CheckCommon && isCommonPassword(password, p.BlocklistFile) {
+		violations = append(violations, PasswordViolation{"common", "密码过于常见，请更换"})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+var (
+	blocklistMu    sync.Mutex
+	blocklistCache = map[string]map[string]bool{}
+)
+
+// loadBlocklist 解析弱密码列表，忽略空行和 # 开头的注释，结果按文件路径缓存
+func loadBlocklist(file string) map[string]bool {
+	blocklistMu.Lock()
+	defer blocklistMu.Unlock()
+	if list, ok := blocklistCache[file]; ok {
+		return list
+	}
+
+	content := bundledCommonPasswords
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			// 读取失败时不缓存，下次校验重试
+			middleware.Logger.Error("读取弱密码列表失败", zap.String("file", file), zap.Error(err))
+			return nil
+		}
+		content = string(data)
+	}
+
+	list := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = true
+	}
+	blocklistCache[file] = list
+	return list
+}
+
+func isCommonPassword(password, extraFile string) bool {
+	key := strings.ToLower(password)
+	if loadBlocklist("")[key] {
+		return true
+	}
+	return extraFile != "" && loadBlocklist(extraFile)[key]
+}
+
+// checkPasswordHistory 检查新密码是否与当前密码或最近使用过的密码相同
+func checkPasswordHistory(db *gorm.DB, user *model.User, password string) error {
+	size := currentPasswordPolicy().HistorySize
+	if size <= 0 {
+		return nil
+	}
+
+	reused := user.Password != "" && user.CheckPassword(password)
+	if !reused {
+		var history []model.PasswordHistory
+		if err := db.Where("user_id = ?", user.ID).Order("id desc").Limit(size).Find(&history).Error; err != nil {
+			return err
+		}
+		for _, h := range history {
+			if (&model.User{Password: h.Password}).CheckPassword(password) {
+				reused = true
+				break
+			}
+		}
+	}
+
+	if reused {
+		return &PasswordPolicyError{Violations: []PasswordViolation{
+			{"history", fmt.Sprintf("不能使用最近%d次使用过的密码", size)},
+		}}
+	}
+	return nil
+}
+
+// recordPasswordHistory 记录新密码的哈希，只保留策略要求的最近 N 条
+func recordPasswordHistory(tx *gorm.DB, userID uint, hashed string) error {
+	size := currentPasswordPolicy().HistorySize
+	if size <= 0 {
+		return nil
+	}
+
+	if err := tx.Create(&model.PasswordHistory{UserID: userID, Password: hashed}).Error; err != nil {
+		return err
+	}
+
+	var keep []uint
+	if err := tx.Model(&model.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("id desc").Limit(size).Pluck("id", &keep).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ? AND id NOT IN ?", userID, keep).Delete(&model.PasswordHistory{}).Error
+}
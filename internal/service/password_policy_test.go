@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// violatedRules 返回 err 中未通过的规则，err 不是 *PasswordPolicyError 时返回 nil
+func violatedRules(err error) []string {
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+	var rules []string
+	for _, v := range policyErr.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestValidatePassword(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(blocklist, []byte("# 公司名称\nFastGin2024!\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	strict := config.PasswordConfig{
+		MinLength: 10, MaxLength: 16,
+		RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true,
+		CheckCommon: true, BlocklistFile: blocklist,
+	}
+
+	tests := []struct {
+		name     string
+		conf     config.PasswordConfig
+		password string
+		want     []string
+	}{
+		{"default length", config.PasswordConfig{}, "1234567", []string{"min_length"}},
+		{"default policy", config.PasswordConfig{}, "abcdefgh", nil},
+		{"default max length", config.PasswordConfig{}, string(make([]byte, 65)), []string{"max_length"}},
+		{"length counts runes", config.PasswordConfig{MinLength: 4}, "密码测试", nil},
+		{"strict ok", strict, "Correct#Horse9", nil},
+		{"every rule", strict, "abc", []string{"min_length", "require_upper", "require_digit", "require_symbol"}},
+		{"too long", strict, "Correct#Horse9Battery", []string{"max_length"}},
+		{"bundled common password", config.PasswordConfig{CheckCommon: true}, "QWERTY123", []string{"common"}},
+		{"extra blocklist", strict, "fastgin2024!", []string{"require_upper", "common"}},
+		{"common check disabled", config.PasswordConfig{}, "qwerty123", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config.GlobalConfig.Password = tc.conf
+			err := ValidatePassword(tc.password)
+			if got := violatedRules(err); !slices.Equal(got, tc.want) {
+				t.Errorf("violations = %v, want %v (err = %v)", got, tc.want, err)
+			}
+		})
+	}
+	config.GlobalConfig.Password = config.PasswordConfig{}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	setupTestDB(t)
+	config.GlobalConfig.Password.HistorySize = 2
+	user := createTestUser(t, "alice", "Initial#0", "user")
+
+	change := func(old, new string) error {
+		t.Helper()
+		_, err := ChangePassword(user.ID, &ChangePasswordRequest{OldPassword: old, NewPassword: new}, testClient)
+		return err
+	}
+	passwords := []string{"Initial#0", "Second#1", "Thirdpw#2", "Fourth#3"}
+	for i := 1; i < len(passwords); i++ {
+		if err := change(passwords[i-1], passwords[i]); err != nil {
+			t.Fatalf("change to %s: %v", passwords[i], err)
+		}
+	}
+
+	// 只保留最近 2 次的密码
+	var kept int64
+	repository.DB.Model(&model.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&kept)
+	if kept != 2 {
+		t.Errorf("password history size = %d, want 2", kept)
+	}
+	if rules := violatedRules(change("Fourth#3", "Thirdpw#2")); !slices.Equal(rules, []string{"history"}) {
+		t.Errorf("reusing a recent password: violations = %v", rules)
+	}
+	if rules := violatedRules(change("Fourth#3", "Fourth#3")); !slices.Equal(rules, []string{"same_as_old"}) {
+		t.Errorf("reusing the current password: violations = %v", rules)
+	}
+	// 超出历史记录数量的密码可以重新使用
+	if err := change("Fourth#3", "Second#1"); err != nil {
+		t.Errorf("reusing an old password: %v", err)
+	}
+
+	// 管理员重置密码同样检查历史记录
+	err := UpdateUser(adminScope(t), user.ID, &UpdateUserRequest{Password: "Fourth#3"})
+	if rules := violatedRules(err); !slices.Equal(rules, []string{"history"}) {
+		t.Errorf("admin reset to a recent password: violations = %v", rules)
+	}
+}
+
+func TestPasswordHistoryDisabled(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice", "Initial#0", "user")
+	for _, p := range [][2]string{{"Initial#0", "Second#1"}, {"Second#1", "Initial#0"}} {
+		if _, err := ChangePassword(user.ID, &ChangePasswordRequest{OldPassword: p[0], NewPassword: p[1]}, testClient); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var count int64
+	repository.DB.Model(&model.PasswordHistory{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d password history records saved with history disabled", count)
+	}
+}
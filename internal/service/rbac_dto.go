@@ -0,0 +1,81 @@
+package service
+
+// PolicyRules p 策略
+type PolicyRules struct {
+	Sub string `json:"sub" binding:"required" example:"editor"`
+	Dom string `json:"dom" binding:"required" example:"tenant:1"`
+	Obj string `json:"obj" binding:"required" example:"/api/users/:id"`
+	Act string `json:"act" binding:"required" example:"GET"`
+}
+
+// GroupingRules g 策略
+type GroupingRules struct {
+	User string `json:"user" binding:"required" example:"user:2"`
+	Role string `json:"role" binding:"required" example:"editor"`
+	Dom  string `json:"dom" binding:"required" example:"tenant:1"`
+}
+
+// RoleInfos 角色及其权限
+type RoleInfos struct {
+	Role        string        `json:"role" example:"editor"`
+	Permissions []PolicyRules `json:"permissions"`
+	Inherits    []string      `json:"inherits" example:"viewer"`
+	Members     []string      `json:"members" example:"user:2"`
+}
+
+// PolicyCheckResults 权限检查结果
+type PolicyCheckResults struct {
+	Allowed bool         `json:"allowed" example:"true"`
+	Matched *PolicyRules `json:"matched"`
+	Roles   []string     `json:"roles" example:"editor,viewer"`
+}
+
+// ExplainRequests 解释鉴权结果请求
+type ExplainRequests struct {
+	UserID   uint              `json:"user_id" binding:"required" example:"2"`
+	TenantID uint              `json:"tenant_id" example:"1"`
+	Method   string            `json:"method" binding:"required" example:"PUT"`
+	Path     string            `json:"path" binding:"required" example:"/api/users/2"`
+	Params   map[string]string `json:"params"`
+	IP       string            `json:"ip" example:"192.168.1.10"`
+	Time     string            `json:"time" example:"2025-03-01T12:00:00+08:00"`
+}
+
+// ExplainResults 鉴权结果及原因
+type ExplainResults struct {
+	Allowed     bool          `json:"allowed" example:"false"`
+	Sub         string        `json:"sub" example:"user:2"`
+	Dom         string        `json:"dom" example:"tenant:1"`
+	Username    string        `json:"username" example:"alice"`
+	Matched     *PolicyRules  `json:"matched"`
+	Roles       []string      `json:"roles" example:"editor"`
+	Candidates  []PolicyRules `json:"candidates"`
+	Explanation string        `json:"explanation" example:"拒绝：tenant:1 的角色 [editor] 有路径匹配 /api/users/2 的策略，但方法、租户或模型中的其他条件不满足"`
+}
+
+// AuthzDecisions 鉴权审计记录
+type AuthzDecisions struct {
+	ID        uint   `json:"id" example:"1"`
+	TenantID  uint   `json:"tenant_id" example:"1"`
+	UserID    uint   `json:"user_id" example:"2"`
+	APIKeyID  uint   `json:"api_key_id" example:"0"`
+	Sub       string `json:"sub" example:"user:2"`
+	Dom       string `json:"dom" example:"tenant:1"`
+	Obj       string `json:"obj" example:"/api/users"`
+	Act       string `json:"act" example:"GET"`
+	Allowed   bool   `json:"allowed" example:"false"`
+	Matched   string `json:"matched" example:""`
+	Reason    string `json:"reason" example:"no_policy"`
+	IP        string `json:"ip" example:"192.168.1.10"`
+	CreatedAt string `json:"created_at" example:"2025-03-01T12:00:00Z"`
+}
+
+// RouteEntries 权限目录中的接口
+type RouteEntries struct {
+	Method    string   `json:"method" example:"GET"`
+	Path      string   `json:"path" example:"/api/users/:id"`
+	Summary   string   `json:"summary" example:"获取用户信息"`
+	Tags      []string `json:"tags" example:"用户管理"`
+	Protected bool     `json:"protected" example:"true"`
+	Handler   string   `json:"handler" example:"fastgin/internal/api.GetUser"`
+}
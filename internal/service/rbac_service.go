@@ -0,0 +1,622 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/util"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidPolicy  = errors.New("无效的策略")
+	ErrPolicyExists   = errors.New("策略已存在")
+	ErrPolicyNotFound = errors.New("策略不存在")
+	// ErrRBACLockout 修改后操作者将无法再管理权限策略
+	ErrRBACLockout = errors.New("不能移除自己管理权限策略的权限")
+	// ErrRBACDomainForbidden 操作者不能管理该域的权限策略
+	ErrRBACDomainForbidden = errors.New("没有管理该租户权限策略的权限")
+)
+
+// rbacGuardPath 修改策略后操作者仍需保留访问的接口，避免把自己锁在权限管理之外
+const rbacGuardPath = "/api/rbac/policies"
+
+// platformAdminRole 没有平台管理员时，默认租户内拥有该角色的用户会被提升为平台管理员
+const platformAdminRole = "admin"
+
+var (
+	subjectPattern = regexp.MustCompile(`^[A-Za-z0-9_.:@-]{1,64}$`)
+	domainPattern  = regexp.MustCompile(`^[A-Za-z0-9_.:*-]{1,64}$`)
+	objectPattern  = regexp.MustCompile(`^/[A-Za-z0-9_.:*{}/-]{0,254}$`)
+	policyActions  = map[string]bool{
+		"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "HEAD": true, "OPTIONS": true, "*": true,
+	}
+)
+
+var enforcer *casbin.SyncedEnforcer
+
+// InitRBAC 设置权限管理接口使用的 Casbin 执行器，与 Authorize 中间件共用同一个实例
+func InitRBAC(e *casbin.SyncedEnforcer) {
+	enforcer = e
+}
+
+// removeUserRoles 删除用户后移除其在所有租户内的角色分配
+func removeUserRoles(userID uint) error {
+	if enforcer == nil {
+		return nil
+	}
+	_, err := enforcer.RemoveFilteredGroupingPolicy(0, middleware.UserSubject(userID))
+	return err
+}
+
+// SyncUserRoles 启动时为已有用户的角色创建角色记录，为所有用户补齐已启用角色对应的 g 策略，并确保存在平台管理员
+func SyncUserRoles() error {
+	if err := ensureRoles(); err != nil {
+		return err
+	}
+
+	var assignments []struct {
+		UserID   uint
+		TenantID uint
+		Code     string
+	}
+	err := repository.DB.Table("user_roles").
+		Select("users.id AS user_id, users.tenant_id, roles.code").
+		Joins("JOIN users ON users.id = user_roles.user_id AND users.deleted_at IS NULL").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.status = ?", model.RoleStatusEnabled).
+		Scan(&assignments).Error
+	if err != nil {
+		return err
+	}
+
+	var rules [][]string
+	for _, a := range assignments {
+		rule := []string{middleware.UserSubject(a.UserID), a.Code, middleware.TenantDomain(a.TenantID)}
+		exists, err := enforcer.HasGroupingPolicy(rule)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) > 0 {
+		if _, err := enforcer.AddGroupingPolicies(rules); err != nil {
+			return err
+		}
+		middleware.Logger.Info("已同步用户角色", zap.Int("count", len(rules)))
+	}
+	return ensurePlatformAdmin()
+}
+
+// userDomains 用户可能拥有角色的全部域：所属租户、* 域，以及 g 策略中为其分配了角色的其他租户
+func userDomains(sub string, tenantID uint) ([]string, error) {
+	doms := []string{middleware.TenantDomain(tenantID), "*"}
+	groupings, err := enforcer.GetFilteredGroupingPolicy(0, sub)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range groupings {
+		if !slices.Contains(doms, rule[2]) {
+			doms = append(doms, rule[2])
+		}
+	}
+	return doms, nil
+}
+
+// userImplicitRoles 用户在所有域内的全部角色，包括主角色、其他角色、继承的角色和其他租户内的角色
+func userImplicitRoles(user *model.User) ([]string, error) {
+	roles := []string{user.Role}
+	sub := middleware.UserSubject(user.ID)
+	doms, err := userDomains(sub, user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	for _, dom := range doms {
+		implicit, err := enforcer.GetImplicitRolesForUser(sub, dom)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range implicit {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles, nil
+}
+
+// ensurePlatformAdmin 没有任何用户可以管理 * 域的策略时（首次安装或从单租户升级），
+// 为默认租户内拥有 admin 角色的用户添加 g, user:<id>, admin, *，否则没有人能管理角色、菜单和 * 域的策略
+func ensurePlatformAdmin() error {
+	groupings, err := enforcer.GetFilteredGroupingPolicy(2, "*")
+	if err != nil {
+		return err
+	}
+	for _, rule := range groupings {
+		if !middleware.IsUserSubject(rule[0]) {
+			continue
+		}
+		ok, err := middleware.EnforceRequest(enforcer, nil, rule[0], "*", rbacGuardPath, "POST")
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	var ids []uint
+	err = repository.DB.Table("user_roles").
+		Joins("JOIN users ON users.id = user_roles.user_id AND users.deleted_at IS NULL").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("users.tenant_id = ? AND roles.code = ? AND roles.status = ?",
+			model.DefaultTenantID, platformAdminRole, model.RoleStatusEnabled).
+		Distinct().Pluck("users.id", &ids).Error
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		middleware.Logger.Warn("没有平台管理员，也没有可以提升的管理员用户，需要手动添加 g, user:<id>, admin, * 策略")
+		return nil
+	}
+
+	rules := make([][]string, 0, len(ids))
+	for _, id := range ids {
+		rules = append(rules, []string{middleware.UserSubject(id), platformAdminRole, "*"})
+	}
+	if _, err := enforcer.AddGroupingPolicies(rules); err != nil {
+		return err
+	}
+	middleware.Logger.Info("没有平台管理员，已将默认租户的管理员提升为平台管理员", zap.Uints("userIDs", ids))
+	return nil
+}
+
+// PolicyRule p 策略：主体 sub 可以在域 dom 内对 obj 执行 act，dom 为 * 时对所有租户生效
+type PolicyRule struct {
+	Sub string `json:"sub" binding:"required"`
+	Dom string `json:"dom" binding:"required"`
+	Obj string `json:"obj" binding:"required"`
+	Act string `json:"act" binding:"required"`
+}
+
+// GroupingRule g 策略：user 在域 dom 内拥有角色 role，user 也可以是另一个角色，用于角色继承
+type GroupingRule struct {
+	User string `json:"user" binding:"required"`
+	Role string `json:"role" binding:"required"`
+	Dom  string `json:"dom" binding:"required"`
+}
+
+type RoleInfo struct {
+	Role        string       `json:"role"`
+	Permissions []PolicyRule `json:"permissions"`
+	// Inherits 直接继承的角色
+	Inherits []string `json:"inherits"`
+	// Members 直接拥有该角色的用户或角色
+	Members []string `json:"members"`
+}
+
+type PolicyCheckResult struct {
+	Allowed bool `json:"allowed"`
+	// Matched 命中的策略，未命中时为空
+	Matched *PolicyRule `json:"matched"`
+	// Roles 主体拥有的全部角色，包含继承的角色
+	Roles []string `json:"roles"`
+}
+
+// RBACOperator 修改策略的操作者，用于审计日志和防止自我锁定
+type RBACOperator struct {
+	UserID   uint
+	Username string
+	// Subject 操作者在 Casbin 中的主体
+	Subject string
+	// Domain 操作者当前所在的租户域
+	Domain string
+}
+
+func (r *PolicyRule) normalize() error {
+	r.Sub = strings.TrimSpace(r.Sub)
+	r.Dom = strings.TrimSpace(r.Dom)
+	r.Obj = strings.TrimSpace(r.Obj)
+	r.Act = strings.ToUpper(strings.TrimSpace(r.Act))
+	if !subjectPattern.MatchString(r.Sub) {
+		return fmt.Errorf("%w：sub 只能包含字母、数字和 _ . : @ -，长度不超过 64", ErrInvalidPolicy)
+	}
+	if !domainPattern.MatchString(r.Dom) {
+		return fmt.Errorf("%w：dom 必须是 tenant:<租户ID> 或 *", ErrInvalidPolicy)
+	}
+	if !objectPattern.MatchString(r.Obj) {
+		return fmt.Errorf("%w：obj 必须是以 / 开头的路径，可以使用 :param 和 *", ErrInvalidPolicy)
+	}
+	if !policyActions[r.Act] {
+		return fmt.Errorf("%w：act 必须是 HTTP 方法或 *", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+func (g *GroupingRule) normalize() error {
+	g.User = strings.TrimSpace(g.User)
+	g.Role = strings.TrimSpace(g.Role)
+	g.Dom = strings.TrimSpace(g.Dom)
+	if !subjectPattern.MatchString(g.User) || !subjectPattern.MatchString(g.Role) {
+		return fmt.Errorf("%w：user 和 role 只能包含字母、数字和 _ . : @ -，长度不超过 64", ErrInvalidPolicy)
+	}
+	if !domainPattern.MatchString(g.Dom) {
+		return fmt.Errorf("%w：dom 必须是 tenant:<租户ID> 或 *", ErrInvalidPolicy)
+	}
+	if g.User == g.Role {
+		return fmt.Errorf("%w：角色不能继承自身", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+func toPolicyRules(rules [][]string) []PolicyRule {
+	list := make([]PolicyRule, 0, len(rules))
+	for _, r := range rules {
+		if len(r) < 4 {
+			continue
+		}
+		list = append(list, PolicyRule{Sub: r[0], Dom: r[1], Obj: r[2], Act: r[3]})
+	}
+	return list
+}
+
+func toGroupingRules(rules [][]string) []GroupingRule {
+	list := make([]GroupingRule, 0, len(rules))
+	for _, r := range rules {
+		if len(r) < 3 {
+			continue
+		}
+		list = append(list, GroupingRule{User: r[0], Role: r[1], Dom: r[2]})
+	}
+	return list
+}
+
+func auditPolicyChange(op RBACOperator, action string, fields ...zap.Field) {
+	middleware.Logger.Info("权限策略变更",
+		append([]zap.Field{
+			zap.Uint("operatorID", op.UserID),
+			zap.String("operator", op.Username),
+			zap.String("action", action),
+		}, fields...)...)
+}
+
+// checkLockout 修改后操作者无法再管理策略时返回 ErrRBACLockout
+func checkLockout(op RBACOperator) error {
+	if op.Subject == "" {
+		return nil
+	}
+	ok, err := middleware.EnforceRequest(enforcer, nil, op.Subject, op.Domain, rbacGuardPath, "POST")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRBACLockout
+	}
+	return nil
+}
+
+// checkDomain 操作者只能管理自己有权限管理权限策略的域，* 域要求操作者在所有租户内都有该权限（平台管理员）
+func checkDomain(op RBACOperator, dom string) error {
+	if op.Subject == "" {
+		return nil
+	}
+	ok, err := middleware.EnforceRequest(enforcer, nil, op.Subject, dom, rbacGuardPath, "POST")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRBACDomainForbidden
+	}
+	return nil
+}
+
+// visibleDomain 操作者可以查看的域，平台管理员可以查看全部（返回空字符串），其他操作者只能查看当前租户和 * 域
+func visibleDomain(op RBACOperator) (string, error) {
+	if err := checkDomain(op, "*"); err != nil {
+		if errors.Is(err, ErrRBACDomainForbidden) {
+			return op.Domain, nil
+		}
+		return "", err
+	}
+	return "", nil
+}
+
+// filterByDomain 保留在 dom 内生效的策略，column 为域所在的列，dom 为空时不过滤
+func filterByDomain(rules [][]string, column int, dom string) [][]string {
+	if dom == "" {
+		return rules
+	}
+	list := rules[:0:0]
+	for _, rule := range rules {
+		if len(rule) > column && util.KeyMatch(dom, rule[column]) {
+			list = append(list, rule)
+		}
+	}
+	return list
+}
+
+// ListPolicies 按条件列出操作者可以查看的 p 策略，条件为空时不过滤
+func ListPolicies(op RBACOperator, filter PolicyRule) ([]PolicyRule, error) {
+	dom, err := visibleDomain(op)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := enforcer.GetFilteredPolicy(0, filter.Sub, filter.Dom, filter.Obj, strings.ToUpper(filter.Act))
+	if err != nil {
+		return nil, err
+	}
+	return toPolicyRules(filterByDomain(rules, 1, dom)), nil
+}
+
+// AddPolicy 添加 p 策略，立即写入数据库并在内存中生效
+func AddPolicy(op RBACOperator, rule PolicyRule) error {
+	if err := rule.normalize(); err != nil {
+		return err
+	}
+	if err := checkDomain(op, rule.Dom); err != nil {
+		return err
+	}
+	// 策略已存在时 AddPolicy 同样返回 true，需要先检查
+	exists, err := enforcer.HasPolicy(rule.Sub, rule.Dom, rule.Obj, rule.Act)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrPolicyExists
+	}
+	if _, err := enforcer.AddPolicy(rule.Sub, rule.Dom, rule.Obj, rule.Act); err != nil {
+		return err
+	}
+	auditPolicyChange(op, "add_policy",
+		zap.String("sub", rule.Sub), zap.String("dom", rule.Dom), zap.String("obj", rule.Obj), zap.String("act", rule.Act))
+	return nil
+}
+
+// RemovePolicy 删除 p 策略，删除后操作者无法再管理策略时自动恢复
+func RemovePolicy(op RBACOperator, rule PolicyRule) error {
+	if err := rule.normalize(); err != nil {
+		return err
+	}
+	if err := checkDomain(op, rule.Dom); err != nil {
+		return err
+	}
+	removed, err := enforcer.RemovePolicy(rule.Sub, rule.Dom, rule.Obj, rule.Act)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrPolicyNotFound
+	}
+	if err := checkLockout(op); err != nil {
+		if _, restoreErr := enforcer.AddPolicy(rule.Sub, rule.Dom, rule.Obj, rule.Act); restoreErr != nil {
+			middleware.Logger.Error("恢复权限策略失败", zap.Error(restoreErr))
+		}
+		return err
+	}
+	// 手动删除的策略不再由菜单同步管理
+	if err := menuPolicyCond(repository.DB, []string{rule.Sub, rule.Dom, rule.Obj, rule.Act}).Delete(&model.MenuPolicy{}).Error; err != nil {
+		middleware.Logger.Error("删除菜单策略记录失败", zap.Error(err))
+	}
+	auditPolicyChange(op, "remove_policy",
+		zap.String("sub", rule.Sub), zap.String("dom", rule.Dom), zap.String("obj", rule.Obj), zap.String("act", rule.Act))
+	return nil
+}
+
+// ListGroupings 按条件列出操作者可以查看的 g 策略，条件为空时不过滤
+func ListGroupings(op RBACOperator, filter GroupingRule) ([]GroupingRule, error) {
+	dom, err := visibleDomain(op)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := enforcer.GetFilteredGroupingPolicy(0, filter.User, filter.Role, filter.Dom)
+	if err != nil {
+		return nil, err
+	}
+	return toGroupingRules(filterByDomain(rules, 2, dom)), nil
+}
+
+// AddGrouping 为用户分配角色，或设置角色继承
+func AddGrouping(op RBACOperator, rule GroupingRule) error {
+	if err := rule.normalize(); err != nil {
+		return err
+	}
+	if err := checkDomain(op, rule.Dom); err != nil {
+		return err
+	}
+	// 分配的角色必须已创建并启用，角色继承时子角色也必须已创建
+	if err := checkRoleAssignable(repository.DB, rule.Role); err != nil {
+		return err
+	}
+	if !middleware.IsUserSubject(rule.User) {
+		if _, err := findRoles(repository.DB, []string{rule.User}); err != nil {
+			return err
+		}
+	}
+	// 角色继承不能形成环
+	inherited, err := enforcer.GetImplicitRolesForUser(rule.Role, rule.Dom)
+	if err != nil {
+		return err
+	}
+	for _, r := range inherited {
+		if r == rule.User {
+			return fmt.Errorf("%w：角色继承不能形成环", ErrInvalidPolicy)
+		}
+	}
+
+	exists, err := enforcer.HasGroupingPolicy(rule.User, rule.Role, rule.Dom)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrPolicyExists
+	}
+	if _, err := enforcer.AddGroupingPolicy(rule.User, rule.Role, rule.Dom); err != nil {
+		return err
+	}
+	auditPolicyChange(op, "add_grouping",
+		zap.String("user", rule.User), zap.String("role", rule.Role), zap.String("dom", rule.Dom))
+	return nil
+}
+
+// RemoveGrouping 移除角色分配，移除后操作者无法再管理策略时自动恢复
+func RemoveGrouping(op RBACOperator, rule GroupingRule) error {
+	if err := rule.normalize(); err != nil {
+		return err
+	}
+	if err := checkDomain(op, rule.Dom); err != nil {
+		return err
+	}
+	removed, err := enforcer.RemoveGroupingPolicy(rule.User, rule.Role, rule.Dom)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrPolicyNotFound
+	}
+	if err := checkLockout(op); err != nil {
+		if _, restoreErr := enforcer.AddGroupingPolicy(rule.User, rule.Role, rule.Dom); restoreErr != nil {
+			middleware.Logger.Error("恢复角色分配失败", zap.Error(restoreErr))
+		}
+		return err
+	}
+	auditPolicyChange(op, "remove_grouping",
+		zap.String("user", rule.User), zap.String("role", rule.Role), zap.String("dom", rule.Dom))
+	return nil
+}
+
+// ListRoles 列出所有角色及其在操作者可以查看的域内的直接权限，角色包括 p 策略的主体和 g 策略中被分配的角色
+func ListRoles(op RBACOperator) ([]RoleInfo, error) {
+	dom, err := visibleDomain(op)
+	if err != nil {
+		return nil, err
+	}
+	subjects, err := enforcer.GetAllSubjects()
+	if err != nil {
+		return nil, err
+	}
+	roles, err := enforcer.GetAllRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append(subjects, roles...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	list := make([]RoleInfo, 0, len(names))
+	for _, name := range names {
+		info, err := roleInfo(name, dom, false)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *info)
+	}
+	return list, nil
+}
+
+// GetRole 返回角色在域 dom 内的全部权限，包含从其他角色继承的权限
+func GetRole(op RBACOperator, role, dom string) (*RoleInfo, error) {
+	if err := checkDomain(op, dom); err != nil {
+		return nil, err
+	}
+	return roleInfo(role, dom, true)
+}
+
+// roleInfo 返回角色在域 dom 内生效的权限，dom 为空时不限定域；implicit 为 true 时包含继承的权限
+func roleInfo(role, dom string, implicit bool) (*RoleInfo, error) {
+	roles := []string{role}
+	if implicit {
+		inherited, err := enforcer.GetImplicitRolesForUser(role, dom)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, inherited...)
+	}
+
+	var rules [][]string
+	for _, r := range roles {
+		direct, err := enforcer.GetFilteredPolicy(0, r)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, filterByDomain(direct, 1, dom)...)
+	}
+
+	inherits, err := groupingColumn(0, role, 1, dom)
+	if err != nil {
+		return nil, err
+	}
+	members, err := groupingColumn(1, role, 0, dom)
+	if err != nil {
+		return nil, err
+	}
+	return &RoleInfo{
+		Role:        role,
+		Permissions: toPolicyRules(rules),
+		Inherits:    inherits,
+		Members:     members,
+	}, nil
+}
+
+// groupingColumn 返回第 field 列等于 value 的 g 策略的第 column 列，去重，dom 非空时只返回在该域内生效的策略
+func groupingColumn(field int, value string, column int, dom string) ([]string, error) {
+	rules, err := enforcer.GetFilteredGroupingPolicy(field, value)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	list := []string{}
+	for _, rule := range filterByDomain(rules, 2, dom) {
+		if !seen[rule[column]] {
+			seen[rule[column]] = true
+			list = append(list, rule[column])
+		}
+	}
+	return list, nil
+}
+
+// CheckPolicy 使用当前生效的策略判断 (sub, dom, obj, act) 是否允许，不会修改任何策略
+func CheckPolicy(op RBACOperator, req PolicyRule) (*PolicyCheckResult, error) {
+	if err := checkDomain(op, req.Dom); err != nil {
+		return nil, err
+	}
+	req.Act = strings.ToUpper(strings.TrimSpace(req.Act))
+	allowed, explain, err := middleware.EnforceRequestEx(enforcer, nil, req.Sub, req.Dom, req.Obj, req.Act)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := enforcer.GetImplicitRolesForUser(req.Sub, req.Dom)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PolicyCheckResult{Allowed: allowed, Roles: nonNil(roles)}
+	if len(explain) >= 4 {
+		result.Matched = &PolicyRule{Sub: explain[0], Dom: explain[1], Obj: explain[2], Act: explain[3]}
+	}
+	return result, nil
+}
+
+// nonNil 空列表序列化为 [] 而不是 null
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// operator 用户在所属租户内的操作者身份
+func operator(user *model.User) RBACOperator {
+	return RBACOperator{
+		UserID:   user.ID,
+		Username: user.Username,
+		Subject:  middleware.UserSubject(user.ID),
+		Domain:   middleware.TenantDomain(user.TenantID),
+	}
+}
+
+// tenantRequest 使用访问令牌经过 JWTAuth 和 Authorize 访问 GET /api/users，tenant 不为空时设置租户请求头
+func tenantRequest(t *testing.T, token, tenant string) int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/users", middleware.JWTAuth(), middleware.Authorize(enforcer), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	req.Header.Set("Authorization", middleware.Bearer+token)
+	if tenant != "" {
+		req.Header.Set(middleware.TenantHeader, tenant)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestTenantUserIsolation(t *testing.T) {
+	setupTestDB(t)
+	alice := createTenantUser(t, 1, "alice", "Secret#123", "user")
+	bob := createTenantUser(t, 2, "bob", "Secret#123", "user")
+
+	scope, err := ResolveDataScope(alice.TenantID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetUser(scope, alice.ID); err != nil {
+		t.Errorf("user of the same tenant: %v", err)
+	}
+	if _, err := GetUser(scope, bob.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("user of another tenant: err = %v, want ErrUserNotFound", err)
+	}
+	if err := DeleteUser(scope, bob.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("delete user of another tenant: err = %v, want ErrUserNotFound", err)
+	}
+	users, total, err := ListUsers(scope, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(users) != 1 || users[0].ID != alice.ID {
+		t.Errorf("ListUsers = %d users (total %d), want only alice", len(users), total)
+	}
+}
+
+func TestAuthorizeTenantHeader(t *testing.T) {
+	setupTestDB(t)
+	createTenantUser(t, 1, "root", "Secret#123", "admin")
+	createTenantUser(t, 1, "t1admin", "Secret#123", "admin")
+	root := loginTestUser(t, "root", "Secret#123")
+	tenantAdmin := loginTestUser(t, "t1admin", "Secret#123")
+
+	tests := []struct {
+		name   string
+		token  string
+		tenant string
+		want   int
+	}{
+		{"own tenant", tenantAdmin.Token, "", http.StatusOK},
+		{"own tenant header", tenantAdmin.Token, "1", http.StatusOK},
+		{"other tenant", tenantAdmin.Token, "2", http.StatusForbidden},
+		{"invalid tenant", tenantAdmin.Token, "abc", http.StatusBadRequest},
+		{"platform admin in other tenant", root.Token, "2", http.StatusOK},
+	}
+	for _, tc := range tests {
+		if got := tenantRequest(t, tc.token, tc.tenant); got != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBootstrapPlatformAdmin(t *testing.T) {
+	setupTestDB(t)
+	root := createTenantUser(t, 1, "root", "Secret#123", "admin")
+
+	ok, err := enforcer.HasGroupingPolicy(middleware.UserSubject(root.ID), platformAdminRole, "*")
+	if err != nil || !ok {
+		t.Fatalf("bootstrap admin not promoted to platform admin: %v", err)
+	}
+	if _, err := CreateRole(operator(root), &CreateRoleRequest{Code: "editor", Name: "编辑"}); err != nil {
+		t.Fatalf("platform admin cannot manage roles: %v", err)
+	}
+
+	// 已有平台管理员时，其他管理员不会被自动提升
+	second := createTenantUser(t, 1, "t1admin", "Secret#123", "admin")
+	if ok, _ := enforcer.HasGroupingPolicy(middleware.UserSubject(second.ID), platformAdminRole, "*"); ok {
+		t.Error("second admin promoted to platform admin")
+	}
+	tenantAdmin := createTenantUser(t, 2, "t2admin", "Secret#123", "admin")
+	for _, op := range []RBACOperator{operator(second), operator(tenantAdmin)} {
+		if _, err := CreateRole(op, &CreateRoleRequest{Code: "auditor", Name: "审计"}); !errors.Is(err, ErrRBACDomainForbidden) {
+			t.Errorf("tenant admin %s: err = %v, want ErrRBACDomainForbidden", op.Username, err)
+		}
+	}
+}
+
+func TestRBACDomainForbidden(t *testing.T) {
+	setupTestDB(t)
+	createTenantUser(t, 1, "root", "Secret#123", "admin")
+	tenantAdmin := createTenantUser(t, 2, "t2admin", "Secret#123", "admin")
+	op := operator(tenantAdmin)
+
+	if err := checkDomain(op, middleware.TenantDomain(2)); err != nil {
+		t.Errorf("own tenant: %v", err)
+	}
+	for _, dom := range []string{middleware.TenantDomain(1), "*"} {
+		if err := checkDomain(op, dom); !errors.Is(err, ErrRBACDomainForbidden) {
+			t.Errorf("domain %s: err = %v, want ErrRBACDomainForbidden", dom, err)
+		}
+	}
+}
+
+func TestExplainDecisionTenant(t *testing.T) {
+	setupTestDB(t)
+	root := createTenantUser(t, 1, "root", "Secret#123", "admin")
+	tenantAdmin := createTenantUser(t, 1, "t1admin", "Secret#123", "admin")
+	alice := createTenantUser(t, 1, "alice", "Secret#123", "user")
+	bob := createTenantUser(t, 2, "bob", "Secret#123", "user")
+	explain := func(op RBACOperator, userID, tenantID uint) (*ExplainResult, error) {
+		return ExplainDecision(op, &ExplainRequest{UserID: userID, TenantID: tenantID, Method: "GET", Path: "/api/users"})
+	}
+
+	if result, err := explain(operator(tenantAdmin), alice.ID, 0); err != nil || result.Username != "alice" {
+		t.Errorf("user of the same tenant: result = %+v, err = %v", result, err)
+	}
+	// 租户管理员指定自己的租户也不能检查其他租户的用户
+	if result, err := explain(operator(tenantAdmin), bob.ID, 1); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("user of another tenant: result = %+v, err = %v, want ErrUserNotFound", result, err)
+	}
+	if _, err := explain(operator(tenantAdmin), bob.ID, 0); !errors.Is(err, ErrRBACDomainForbidden) {
+		t.Errorf("domain of another tenant: err = %v, want ErrRBACDomainForbidden", err)
+	}
+	for _, tenantID := range []uint{0, 1} {
+		if result, err := explain(operator(root), bob.ID, tenantID); err != nil || result.Username != "bob" {
+			t.Errorf("platform admin, tenant %d: result = %+v, err = %v", tenantID, result, err)
+		}
+	}
+}
+
+// setupPolicyManager 创建只通过 rbac-manager 角色管理 tenant:1 权限策略的用户
+func setupPolicyManager(t *testing.T) RBACOperator {
+	t.Helper()
+	setupTestDB(t)
+	if _, err := CreateRole(RBACOperator{}, &CreateRoleRequest{Code: "rbac-manager", Name: "权限管理员"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enforcer.AddPolicy("rbac-manager", "tenant:1", "/api/rbac/*", "*"); err != nil {
+		t.Fatal(err)
+	}
+	return operator(createTestUser(t, "manager", "Secret#123", "rbac-manager"))
+}
+
+func TestPolicyManagement(t *testing.T) {
+	op := setupPolicyManager(t)
+	rule := PolicyRule{Sub: " editor ", Dom: "tenant:1", Obj: "/api/reports", Act: "get"}
+
+	if err := AddPolicy(op, rule); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := enforcer.HasPolicy("editor", "tenant:1", "/api/reports", "GET"); !ok {
+		t.Fatal("normalized policy not added")
+	}
+	if err := AddPolicy(op, rule); !errors.Is(err, ErrPolicyExists) {
+		t.Errorf("add existing policy: err = %v, want ErrPolicyExists", err)
+	}
+	rules, err := ListPolicies(op, PolicyRule{Sub: "editor"})
+	if err != nil || len(rules) != 1 || rules[0].Act != "GET" {
+		t.Errorf("ListPolicies = %v, %v", rules, err)
+	}
+
+	invalid := []PolicyRule{
+		{Sub: "editor", Dom: "tenant 1", Obj: "/api/reports", Act: "GET"},
+		{Sub: "editor", Dom: "tenant:1", Obj: "api/reports", Act: "GET"},
+		{Sub: "editor", Dom: "tenant:1", Obj: "/api/reports", Act: "FETCH"},
+		{Sub: "edit or", Dom: "tenant:1", Obj: "/api/reports", Act: "GET"},
+	}
+	for _, r := range invalid {
+		if err := AddPolicy(op, r); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("AddPolicy(%+v): err = %v, want ErrInvalidPolicy", r, err)
+		}
+	}
+	// 只能管理有权限的域
+	if err := AddPolicy(op, PolicyRule{Sub: "editor", Dom: "tenant:2", Obj: "/api/reports", Act: "GET"}); !errors.Is(err, ErrRBACDomainForbidden) {
+		t.Errorf("add policy in another tenant: err = %v, want ErrRBACDomainForbidden", err)
+	}
+
+	if err := RemovePolicy(op, rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemovePolicy(op, rule); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("remove missing policy: err = %v, want ErrPolicyNotFound", err)
+	}
+}
+
+func TestPolicyLockoutRollback(t *testing.T) {
+	op := setupPolicyManager(t)
+	canManage := func() bool {
+		t.Helper()
+		ok, err := middleware.EnforceRequest(enforcer, nil, op.Subject, op.Domain, rbacGuardPath, "POST")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// 删除操作者自己赖以管理策略的 p 策略时拒绝并恢复
+	own := PolicyRule{Sub: "rbac-manager", Dom: "tenant:1", Obj: "/api/rbac/*", Act: "*"}
+	if err := RemovePolicy(op, own); !errors.Is(err, ErrRBACLockout) {
+		t.Fatalf("remove own policy: err = %v, want ErrRBACLockout", err)
+	}
+	if !canManage() {
+		t.Fatal("own policy not restored")
+	}
+
+	// 移除操作者自己的角色分配时同样拒绝并恢复
+	assignment := GroupingRule{User: op.Subject, Role: "rbac-manager", Dom: "tenant:1"}
+	if err := RemoveGrouping(op, assignment); !errors.Is(err, ErrRBACLockout) {
+		t.Fatalf("remove own role: err = %v, want ErrRBACLockout", err)
+	}
+	if !canManage() {
+		t.Fatal("own role assignment not restored")
+	}
+
+	// 还有其他授权来源时允许移除
+	if err := AddPolicy(op, PolicyRule{Sub: op.Subject, Dom: "tenant:1", Obj: rbacGuardPath, Act: "POST"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemovePolicy(op, own); err != nil {
+		t.Errorf("remove policy covered by another rule: %v", err)
+	}
+	if !canManage() {
+		t.Error("operator locked out")
+	}
+}
+
+func TestGroupingManagement(t *testing.T) {
+	op := setupPolicyManager(t)
+	for _, role := range []string{"editor", "lead"} {
+		if _, err := CreateRole(RBACOperator{}, &CreateRoleRequest{Code: role, Name: role}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := createTestUser(t, "alice", "Secret#123", "user")
+	assign := GroupingRule{User: middleware.UserSubject(alice.ID), Role: "editor", Dom: "tenant:1"}
+
+	if err := AddGrouping(op, assign); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddGrouping(op, assign); !errors.Is(err, ErrPolicyExists) {
+		t.Errorf("add existing grouping: err = %v, want ErrPolicyExists", err)
+	}
+	if err := AddGrouping(op, GroupingRule{User: assign.User, Role: "ghost", Dom: "tenant:1"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("assign unknown role: err = %v, want ErrRoleNotFound", err)
+	}
+	// 角色继承不能形成环
+	if err := AddGrouping(op, GroupingRule{User: "lead", Role: "editor", Dom: "tenant:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddGrouping(op, GroupingRule{User: "editor", Role: "lead", Dom: "tenant:1"}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("inheritance cycle: err = %v, want ErrInvalidPolicy", err)
+	}
+
+	if err := RemoveGrouping(op, assign); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveGrouping(op, assign); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("remove missing grouping: err = %v, want ErrPolicyNotFound", err)
+	}
+}
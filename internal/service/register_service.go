@@ -0,0 +1,371 @@
+package service
+
+import (
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fastgin/internal/utils"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRegistrationDisabled = errors.New("未开放注册")
+	ErrUsernameTaken        = errors.New("用户名已被使用")
+	ErrEmailTaken           = errors.New("邮箱已被使用")
+	ErrAccountNotActivated  = errors.New("账号未激活，请先验证邮箱")
+	ErrInvalidVerifyToken   = errors.New("验证链接无效或已过期")
+	ErrInvalidResetToken    = errors.New("重置密码链接无效或已过期")
+)
+
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required,max=32"`
+	Email    string `json:"email" binding:"required,email,max=128"`
+	Password string `json:"password" binding:"required"`
+	// 验证码未关闭时必填
+	CaptchaID   string `json:"captcha_id"`
+	CaptchaCode string `json:"captcha_code"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// registerPolicy 自助注册参数，未配置时使用默认值
+type registerPolicy struct {
+	enabled      bool
+	defaultRole  string
+	verifyURL    string
+	resetURL     string
+	verifyExpire time.Duration
+	resetExpire  time.Duration
+}
+
+func currentRegisterPolicy() registerPolicy {
+	conf := config.GlobalConfig.Register
+	p := registerPolicy{
+		enabled:      conf.Enabled,
+		defaultRole:  "user",
+		verifyURL:    "http://localhost:8080/api/register/verify",
+		resetURL:     "http://localhost:8080/reset-password",
+		verifyExpire: 24 * time.Hour,
+		resetExpire:  30 * time.Minute,
+	}
+	if conf.DefaultRole != "" {
+		p.defaultRole = conf.DefaultRole
+	}
+	if conf.VerifyURL != "" {
+		p.verifyURL = conf.VerifyURL
+	}
+	if conf.ResetURL != "" {
+		p.resetURL = conf.ResetURL
+	}
+	if conf.VerifyExpire > 0 {
+		p.verifyExpire = time.Duration(conf.VerifyExpire) * time.Second
+	}
+	if conf.ResetExpire > 0 {
+		p.resetExpire = time.Duration(conf.ResetExpire) * time.Second
+	}
+	return p
+}
+
+// normalizeEmail 邮箱统一保存为小写
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// withToken 在链接后追加 token 参数
+func withToken(link, token string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// emailInUse 检查邮箱是否已被其他用户使用
+func emailInUse(tx *gorm.DB, email string, excludeID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&model.User{}).Where("email = ? AND id <> ?", email, excludeID).Count(&count).Error
+	return count > 0, err
+}
+
+// emailConflict 写入用户失败时，如果邮箱已被其他用户使用，返回 ErrEmailTaken。
+// 并发写入相同邮箱时事务内的检查都能通过，由邮箱的唯一索引拒绝后写入的一方，
+// 事务回滚后重新查询才能看到另一方已提交的用户
+func emailConflict(err error, email string, excludeID uint) error {
+	if err == nil || email == "" || errors.Is(err, ErrEmailTaken) {
+		return err
+	}
+	if inUse, checkErr := emailInUse(repository.DB, email, excludeID); checkErr == nil && inUse {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// Register 自助注册，创建待激活的用户并发送邮箱验证邮件
+func Register(req *RegisterRequest, client ClientInfo) error {
+	p := currentRegisterPolicy()
+	if !p.enabled {
+		return ErrRegistrationDisabled
+	}
+	if currentCaptchaPolicy().mode != CaptchaModeOff {
+		if err := verifyCaptcha(req.CaptchaID, req.CaptchaCode); err != nil {
+			return err
+		}
+	}
+	if err := ValidatePassword(req.Password); err != nil {
+		return err
+	}
+
+	email := normalizeEmail(req.Email)
+	user := &model.User{
+		TenantID:          model.DefaultTenantID,
+		Username:          strings.TrimSpace(req.Username),
+		Password:          req.Password,
+		Role:              p.defaultRole,
+		Email:             &email,
+		PendingActivation: true,
+	}
+	if err := user.HashPassword(); err != nil {
+		return err
+	}
+
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.User{}).Unscoped().Where("username = ?", user.Username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUsernameTaken
+		}
+		inUse, err := emailInUse(tx, email, 0)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrEmailTaken
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if _, err := assignUserRoles(tx, user.ID, []string{user.Role}); err != nil {
+			return err
+		}
+		if err := recordPasswordHistory(tx, user.ID, user.Password); err != nil {
+			return err
+		}
+		return enqueueVerificationMail(tx, user, p)
+	})
+	if err != nil {
+		return emailConflict(err, email, 0)
+	}
+	if err := syncUserGroupings(user.ID, user.TenantID, nil, []string{user.Role}); err != nil {
+		return err
+	}
+	notifyOutbox()
+
+	middleware.Logger.Info("用户自助注册",
+		zap.String("username", user.Username),
+		zap.String("ip", client.IP))
+	return nil
+}
+
+func enqueueVerificationMail(tx *gorm.DB, user *model.User, p registerPolicy) error {
+	token, err := middleware.GenerateEmailVerificationToken(user.ID, user.Username, p.verifyExpire)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("%s，您好：\n\n请在 %d 小时内打开以下链接完成邮箱验证：\n\n%s\n\n如果这不是您本人的操作，请忽略此邮件。\n",
+		user.Username, int(p.verifyExpire.Hours()), withToken(p.verifyURL, token))
+	return enqueueMail(tx, user.EmailAddress(), "验证您的邮箱", body)
+}
+
+// VerifyEmail 校验邮箱验证令牌并激活账号，重复验证视为成功
+func VerifyEmail(token string) error {
+	claims, err := middleware.ParseEmailVerificationToken(token)
+	if err != nil {
+		return ErrInvalidVerifyToken
+	}
+	user, err := getUser(claims.UserID)
+	if err != nil {
+		return ErrInvalidVerifyToken
+	}
+	if !user.PendingActivation {
+		return nil
+	}
+
+	err = repository.DB.Model(user).Updates(map[string]interface{}{
+		"pending_activation": false,
+		"email_verified_at":  time.Now(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	middleware.Logger.Info("邮箱验证成功",
+		zap.String("username", user.Username))
+	return nil
+}
+
+// ResendVerification 重新发送验证邮件，邮箱不存在或已激活时同样返回成功，避免暴露注册信息
+func ResendVerification(email string) error {
+	p := currentRegisterPolicy()
+	if !p.enabled {
+		return ErrRegistrationDisabled
+	}
+	email = normalizeEmail(email)
+
+	var user model.User
+	err := repository.DB.Where("email = ? AND pending_activation = ?", email, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if throttled, err := mailThrottled(email); err != nil || throttled {
+		return err
+	}
+
+	if err := enqueueVerificationMail(repository.DB, &user, p); err != nil {
+		return err
+	}
+	notifyOutbox()
+	return nil
+}
+
+// ForgotPassword 发送重置密码邮件，邮箱不存在时同样返回成功，避免暴露注册信息
+func ForgotPassword(email string) error {
+	p := currentRegisterPolicy()
+	email = normalizeEmail(email)
+
+	var user model.User
+	err := repository.DB.Where("email = ? AND pending_activation = ?", email, false).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		middleware.Logger.Info("找回密码：邮箱不存在", zap.String("email", email))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if throttled, err := mailThrottled(email); err != nil || throttled {
+		return err
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	err = repository.DB.Transaction(func(tx *gorm.DB) error {
+		// 新的重置链接生效后，之前发送的链接全部失效
+		if err := invalidateResetTokens(tx, user.ID); err != nil {
+			return err
+		}
+		err := tx.Create(&model.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.SHA256Hex(token),
+			ExpiresAt: time.Now().Add(p.resetExpire),
+		}).Error
+		if err != nil {
+			return err
+		}
+		body := fmt.Sprintf("%s，您好：\n\n请在 %d 分钟内打开以下链接重置密码：\n\n%s\n\n如果这不是您本人的操作，请忽略此邮件，您的密码不会改变。\n",
+			user.Username, int(p.resetExpire.Minutes()), withToken(p.resetURL, token))
+		return enqueueMail(tx, user.EmailAddress(), "重置密码", body)
+	})
+	if err != nil {
+		return err
+	}
+	notifyOutbox()
+
+	middleware.Logger.Info("发送重置密码邮件",
+		zap.String("username", user.Username))
+	return nil
+}
+
+func invalidateResetTokens(tx *gorm.DB, userID uint) error {
+	return tx.Model(&model.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
+
+// ResetPassword 使用找回密码令牌设置新密码，成功后令牌失效，已签发的令牌全部失效
+func ResetPassword(req *ResetPasswordRequest) error {
+	var resetToken model.PasswordResetToken
+	err := repository.DB.Where("token_hash = ?", utils.SHA256Hex(req.Token)).First(&resetToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if resetToken.UsedAt != nil || time.Now().After(resetToken.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := getUser(resetToken.UserID)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	// 先校验新密码，不符合策略时令牌仍可继续使用
+	if err := ValidatePassword(req.NewPassword); err != nil {
+		return err
+	}
+	if err := checkPasswordHistory(repository.DB, user, req.NewPassword); err != nil {
+		return err
+	}
+	hashedPassword, err := model.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	err = repository.DB.Transaction(func(tx *gorm.DB) error {
+		// 并发使用同一个令牌时只有一个请求成功
+		result := tx.Model(&resetToken).Where("used_at IS NULL").Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+		if err := invalidateResetTokens(tx, user.ID); err != nil {
+			return err
+		}
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"password":             hashedPassword,
+			"must_change_password": false,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, user.ID, hashedPassword)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := RevokeUserTokens(user.ID); err != nil {
+		return err
+	}
+	resetLoginFailures(user.Username)
+
+	middleware.Logger.Info("用户通过邮件重置密码",
+		zap.String("username", user.Username))
+	return nil
+}
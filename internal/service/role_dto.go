@@ -0,0 +1,32 @@
+package service
+
+// CreateRoleRequests 创建角色请求
+type CreateRoleRequests struct {
+	Code        string `json:"code" binding:"required" example:"editor"`
+	Name        string `json:"name" binding:"required" example:"编辑"`
+	Description string `json:"description" example:"可以编辑内容"`
+	// enabled 或 disabled，默认为 enabled
+	Status string `json:"status" example:"enabled"`
+	Sort   int    `json:"sort" example:"1"`
+}
+
+// UpdateRoleRequests 修改角色请求
+type UpdateRoleRequests struct {
+	Name        string `json:"name" binding:"required" example:"编辑"`
+	Description string `json:"description" example:"可以编辑内容"`
+	// enabled 或 disabled
+	Status string `json:"status" binding:"required" example:"disabled"`
+	Sort   int    `json:"sort" example:"1"`
+}
+
+// RoleResponses 角色
+type RoleResponses struct {
+	ID          uint   `json:"id" example:"3"`
+	Code        string `json:"code" example:"editor"`
+	Name        string `json:"name" example:"编辑"`
+	Description string `json:"description" example:"可以编辑内容"`
+	Status      string `json:"status" example:"enabled"`
+	Sort        int    `json:"sort" example:"1"`
+	CreatedAt   string `json:"created_at" example:"2025-03-01T12:00:00Z"`
+	UpdatedAt   string `json:"updated_at" example:"2025-03-01T12:00:00Z"`
+}
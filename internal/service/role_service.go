@@ -0,0 +1,661 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNotFound = errors.New("角色不存在")
+	ErrRoleExists   = errors.New("角色已存在")
+	ErrInvalidRole  = errors.New("无效的角色")
+	// ErrRoleDisabled 禁用的角色不能分配
+	ErrRoleDisabled = errors.New("角色已禁用")
+	// ErrRoleInUse 角色仍分配给用户时不能删除
+	ErrRoleInUse = errors.New("角色已分配给用户，不能删除")
+)
+
+// reservedRoles 在策略中有特殊含义，不能作为角色名
+var reservedRoles = map[string]bool{"self": true, "*": true}
+
+type CreateRoleRequest struct {
+	Code        string `json:"code" binding:"required,max=64"`
+	Name        string `json:"name" binding:"required,max=64"`
+	Description string `json:"description" binding:"max=255"`
+	// Status 默认为 enabled
+	Status string `json:"status" binding:"omitempty,oneof=enabled disabled"`
+	Sort   int    `json:"sort"`
+}
+
+type UpdateRoleRequest struct {
+	Name        string `json:"name" binding:"required,max=64"`
+	Description string `json:"description" binding:"max=255"`
+	Status      string `json:"status" binding:"required,oneof=enabled disabled"`
+	Sort        int    `json:"sort"`
+}
+
+// getRole 按角色名查询角色
+func getRole(db *gorm.DB, code string) (*model.Role, error) {
+	var role model.Role
+	err := db.Where("code = ?", code).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleNotFound
+	}
+	return &role, err
+}
+
+// findRoles 按角色名查询角色，按 codes 的顺序返回并去掉重复的角色，有角色不存在时返回 ErrRoleNotFound
+func findRoles(db *gorm.DB, codes []string) ([]model.Role, error) {
+	if len(codes) == 0 {
+		return []model.Role{}, nil
+	}
+	var found []model.Role
+	if err := db.Where("code IN ?", codes).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]model.Role, len(found))
+	for _, r := range found {
+		byCode[r.Code] = r
+	}
+
+	roles := make([]model.Role, 0, len(codes))
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		r, ok := byCode[code]
+		if !ok {
+			return nil, fmt.Errorf("%w：%s", ErrRoleNotFound, code)
+		}
+		if !seen[code] {
+			seen[code] = true
+			roles = append(roles, r)
+		}
+	}
+	return roles, nil
+}
+
+// checkRoleAssignable 角色必须存在且已启用才能分配
+func checkRoleAssignable(db *gorm.DB, code string) error {
+	role, err := getRole(db, code)
+	if errors.Is(err, ErrRoleNotFound) {
+		return fmt.Errorf("%w：%s", ErrRoleNotFound, code)
+	}
+	if err != nil {
+		return err
+	}
+	if role.Status != model.RoleStatusEnabled {
+		return fmt.Errorf("%w：%s", ErrRoleDisabled, code)
+	}
+	return nil
+}
+
+// userRoleCodes 查询用户的全部角色，按角色排序
+func userRoleCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes := []string{}
+	err := db.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.sort, roles.id").
+		Pluck("roles.code", &codes).Error
+	return codes, err
+}
+
+// assignUserRoles 在事务中将用户的角色设置为 codes，新分配的角色必须存在且已启用，返回修改前的角色
+func assignUserRoles(tx *gorm.DB, userID uint, codes []string) ([]string, error) {
+	before, err := userRoleCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := findRoles(tx, codes)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		if r.Status != model.RoleStatusEnabled && !slices.Contains(before, r.Code) {
+			return nil, fmt.Errorf("%w：%s", ErrRoleDisabled, r.Code)
+		}
+	}
+
+	user := &model.User{}
+	user.ID = userID
+	if err := tx.Model(user).Omit("Roles.*").Association("Roles").Replace(roles); err != nil {
+		return nil, err
+	}
+	return before, nil
+}
+
+// replaceUserRole 在事务中将用户的主角色从 oldRole 替换为 newRole，保留其他角色，返回修改前后的全部角色
+func replaceUserRole(tx *gorm.DB, userID uint, oldRole, newRole string) ([]string, []string, error) {
+	current, err := userRoleCodes(tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	after := []string{newRole}
+	for _, code := range current {
+		if code != oldRole && code != newRole {
+			after = append(after, code)
+		}
+	}
+	if sameRoles(current, after) {
+		return current, after, nil
+	}
+	before, err := assignUserRoles(tx, userID, after)
+	return before, after, err
+}
+
+// updatedRoles 计算修改后用户的全部角色，主角色在最前；Roles 为 nil 时保留原来的其他角色
+func updatedRoles(oldPrimary string, current []string, req *UpdateUserRequest) []string {
+	primary := oldPrimary
+	if req.Role != "" {
+		primary = req.Role
+	}
+	others := req.Roles
+	if others == nil {
+		for _, code := range current {
+			if code != oldPrimary {
+				others = append(others, code)
+			}
+		}
+	}
+	roles := []string{primary}
+	for _, code := range others {
+		if !slices.Contains(roles, code) {
+			roles = append(roles, code)
+		}
+	}
+	return roles
+}
+
+// sameRoles 判断两组角色是否相同，不考虑顺序
+func sameRoles(a, b []string) bool {
+	for _, code := range a {
+		if !slices.Contains(b, code) {
+			return false
+		}
+	}
+	for _, code := range b {
+		if !slices.Contains(a, code) {
+			return false
+		}
+	}
+	return true
+}
+
+// syncUserGroupings 将用户角色的变化同步为用户所属租户内的 g 策略 (user:<id>, role, tenant:<id>)，
+// 禁用的角色不添加，通过权限管理接口额外分配的角色保持不变
+func syncUserGroupings(userID, tenantID uint, before, after []string) error {
+	if enforcer == nil {
+		return nil
+	}
+	sub := middleware.UserSubject(userID)
+	dom := middleware.TenantDomain(tenantID)
+	for _, code := range before {
+		if slices.Contains(after, code) {
+			continue
+		}
+		if _, err := enforcer.RemoveGroupingPolicy(sub, code, dom); err != nil {
+			return err
+		}
+	}
+
+	roles, err := findRoles(repository.DB, after)
+	if err != nil {
+		return err
+	}
+	for _, r := range roles {
+		if r.Status != model.RoleStatusEnabled {
+			continue
+		}
+		exists, err := enforcer.HasGroupingPolicy(sub, r.Code, dom)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := enforcer.AddGroupingPolicy(sub, r.Code, dom); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roleGroupings 返回分配了该角色的全部用户的 g 策略
+func roleGroupings(db *gorm.DB, role *model.Role) ([][]string, error) {
+	var users []model.User
+	err := db.Model(&model.User{}).Select("users.id", "users.tenant_id").
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Where("user_roles.role_id = ?", role.ID).
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	rules := make([][]string, 0, len(users))
+	for _, u := range users {
+		rules = append(rules, []string{middleware.UserSubject(u.ID), role.Code, middleware.TenantDomain(u.TenantID)})
+	}
+	return rules, nil
+}
+
+// ensureRoles 启动时为已有用户的角色创建角色记录，并补齐用户与角色的关联；没有任何角色时创建 admin 和 user
+func ensureRoles() error {
+	var codes []string
+	if err := repository.DB.Model(&model.User{}).Distinct("role").Where("role <> ''").Pluck("role", &codes).Error; err != nil {
+		return err
+	}
+	var count int64
+	if err := repository.DB.Model(&model.Role{}).Count(&count).Error; err != nil {
+		return err
+	}
+	names := map[string]string{}
+	if count == 0 {
+		names["admin"] = "管理员"
+		names["user"] = "普通用户"
+	}
+	for _, code := range codes {
+		if _, ok := names[code]; !ok {
+			names[code] = code
+		}
+	}
+
+	for code, name := range names {
+		role := model.Role{Code: code, Name: name, Status: model.RoleStatusEnabled}
+		if err := repository.DB.Where(model.Role{Code: code}).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+	}
+
+	// 补齐主角色的关联
+	return repository.DB.Exec(`INSERT INTO user_roles (user_id, role_id)
+		SELECT users.id, roles.id FROM users JOIN roles ON roles.code = users.role
+		WHERE users.deleted_at IS NULL AND NOT EXISTS (
+			SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id AND user_roles.role_id = roles.id)`).Error
+}
+
+// checkRoleAdmin 角色是所有租户共用的，只有平台管理员可以修改
+func checkRoleAdmin(op RBACOperator) error {
+	return checkDomain(op, "*")
+}
+
+// ListRoleDefinitions 查询全部角色，按排序返回
+func ListRoleDefinitions() ([]model.Role, error) {
+	roles := []model.Role{}
+	err := repository.DB.Order("sort, id").Find(&roles).Error
+	return roles, err
+}
+
+// CreateRole 创建角色
+func CreateRole(op RBACOperator, req *CreateRoleRequest) (*model.Role, error) {
+	if err := checkRoleAdmin(op); err != nil {
+		return nil, err
+	}
+	code := strings.TrimSpace(req.Code)
+	if !subjectPattern.MatchString(code) || middleware.IsUserSubject(code) || reservedRoles[code] {
+		return nil, fmt.Errorf("%w：角色名只能包含字母、数字和 _ . : @ -，不能以 user: 开头", ErrInvalidRole)
+	}
+	status := req.Status
+	if status == "" {
+		status = model.RoleStatusEnabled
+	}
+
+	role := &model.Role{
+		Code:        code,
+		Name:        req.Name,
+		Description: req.Description,
+		Status:      status,
+		Sort:        req.Sort,
+	}
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := getRole(tx, code); !errors.Is(err, ErrRoleNotFound) {
+			if err == nil {
+				return ErrRoleExists
+			}
+			return err
+		}
+		return tx.Create(role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auditPolicyChange(op, "create_role", zap.String("role", code))
+	return role, nil
+}
+
+// UpdateRole 修改角色。禁用时移除引用该角色的全部 g 策略（包括其他租户的授权和角色继承），
+// 不是由用户角色分配产生的记录到 role_suspended_groupings，启用时一并恢复。
+// 数据库修改在事务中完成，提交后再修改策略，策略修改失败时恢复数据库和策略
+func UpdateRole(op RBACOperator, code string, req *UpdateRoleRequest) error {
+	if err := checkRoleAdmin(op); err != nil {
+		return err
+	}
+	var old model.Role
+	var suspended []model.RoleSuspendedGrouping
+	var add, remove [][]string
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		role, err := getRole(tx, code)
+		if err != nil {
+			return err
+		}
+		// Updates 会把新值写回 role，需要先记录修改前的记录
+		old = *role
+		err = tx.Model(role).Updates(map[string]interface{}{
+			"name":        req.Name,
+			"description": req.Description,
+			"status":      req.Status,
+			"sort":        req.Sort,
+		}).Error
+		if err != nil || old.Status == req.Status {
+			return err
+		}
+		if err := tx.Where("role = ?", code).Find(&suspended).Error; err != nil {
+			return err
+		}
+		if req.Status == model.RoleStatusEnabled {
+			add, err = enableRoleGroupings(tx, role, suspended)
+		} else {
+			remove, err = disableRoleGroupings(tx, role)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := applyRoleStatus(op, add, remove); err != nil {
+		if restoreErr := restoreRole(&old, suspended); restoreErr != nil {
+			middleware.Logger.Error("恢复角色失败", zap.String("role", code), zap.Error(restoreErr))
+		}
+		return err
+	}
+
+	auditPolicyChange(op, "update_role", zap.String("role", code), zap.String("status", req.Status))
+	return nil
+}
+
+// enableRoleGroupings 在事务中删除角色禁用时记录的 g 策略，返回启用后需要添加的全部 g 策略
+func enableRoleGroupings(tx *gorm.DB, role *model.Role, suspended []model.RoleSuspendedGrouping) ([][]string, error) {
+	rules, err := roleGroupings(tx, role)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range suspended {
+		rules = append(rules, []string{s.Subject, role.Code, s.Domain})
+	}
+	if err := tx.Where("role = ?", role.Code).Delete(&model.RoleSuspendedGrouping{}).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// disableRoleGroupings 在事务中记录引用该角色、但不是由用户角色分配产生的 g 策略，返回禁用后需要移除的全部 g 策略
+func disableRoleGroupings(tx *gorm.DB, role *model.Role) ([][]string, error) {
+	rules, err := enforcer.GetFilteredGroupingPolicy(1, role.Code)
+	if err != nil {
+		return nil, err
+	}
+	assigned, err := roleGroupings(tx, role)
+	if err != nil {
+		return nil, err
+	}
+	var suspended []model.RoleSuspendedGrouping
+	for _, rule := range rules {
+		if len(rule) < 3 || slices.ContainsFunc(assigned, func(a []string) bool { return slices.Equal(a, rule[:3]) }) {
+			continue
+		}
+		suspended = append(suspended, model.RoleSuspendedGrouping{Role: role.Code, Subject: rule[0], Domain: rule[2]})
+	}
+	if len(suspended) > 0 {
+		if err := tx.Create(&suspended).Error; err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// applyRoleStatus 在角色状态修改提交后添加或移除 g 策略，失败或移除后操作者失去权限管理权限时撤销已做的修改
+func applyRoleStatus(op RBACOperator, add, remove [][]string) error {
+	if len(add) > 0 {
+		if _, err := applyGroupings(add, nil); err != nil {
+			// 禁用期间不能分配该角色，启用前引用该角色的 g 策略都是本次添加的
+			if _, restoreErr := applyGroupings(nil, add); restoreErr != nil {
+				middleware.Logger.Error("撤销角色分配失败", zap.Error(restoreErr))
+			}
+			return err
+		}
+		return nil
+	}
+	removed, err := applyGroupings(nil, remove)
+	if err == nil {
+		err = checkLockout(op)
+	}
+	if err != nil {
+		if _, restoreErr := applyGroupings(removed, nil); restoreErr != nil {
+			middleware.Logger.Error("恢复角色分配失败", zap.Error(restoreErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// restoreRole 策略修改失败时把角色恢复为修改前的记录，并恢复角色禁用时记录的 g 策略
+func restoreRole(old *model.Role, suspended []model.RoleSuspendedGrouping) error {
+	return repository.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.Role{ID: old.ID}).Updates(map[string]interface{}{
+			"name":        old.Name,
+			"description": old.Description,
+			"status":      old.Status,
+			"sort":        old.Sort,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("role = ?", old.Code).Delete(&model.RoleSuspendedGrouping{}).Error; err != nil {
+			return err
+		}
+		if len(suspended) == 0 {
+			return nil
+		}
+		return tx.Create(&suspended).Error
+	})
+}
+
+// applyGroupings 添加和移除 g 策略，跳过已存在的和不存在的策略，返回实际移除的策略
+func applyGroupings(add, remove [][]string) ([][]string, error) {
+	for _, rule := range add {
+		exists, err := enforcer.HasGroupingPolicy(rule)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if _, err := enforcer.AddGroupingPolicy(rule); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var removed [][]string
+	for _, rule := range remove {
+		ok, err := enforcer.RemoveGroupingPolicy(rule)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			removed = append(removed, rule)
+		}
+	}
+	return removed, nil
+}
+
+// deletedRole 删除角色时删除的数据库记录，策略修改失败时用于恢复
+type deletedRole struct {
+	role       model.Role
+	menus      []model.RoleMenu
+	policies   []model.MenuPolicy
+	dataScopes []model.RoleDataScope
+	mfa        []model.MFARolePolicy
+	suspended  []model.RoleSuspendedGrouping
+}
+
+// restore 重新写入删除的角色记录
+func (d *deletedRole) restore() error {
+	return repository.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&d.role).Error; err != nil {
+			return err
+		}
+		if len(d.menus) > 0 {
+			if err := tx.Create(&d.menus).Error; err != nil {
+				return err
+			}
+		}
+		if len(d.policies) > 0 {
+			if err := tx.Create(&d.policies).Error; err != nil {
+				return err
+			}
+		}
+		if len(d.dataScopes) > 0 {
+			if err := tx.Create(&d.dataScopes).Error; err != nil {
+				return err
+			}
+		}
+		if len(d.mfa) > 0 {
+			if err := tx.Create(&d.mfa).Error; err != nil {
+				return err
+			}
+		}
+		if len(d.suspended) > 0 {
+			return tx.Create(&d.suspended).Error
+		}
+		return nil
+	})
+}
+
+// DeleteRole 删除没有分配给用户的角色，同时删除该角色的 p 策略、g 策略、菜单、数据权限和两步验证策略。
+// 数据库记录在事务中删除，提交后再删除策略，策略删除失败时恢复数据库和策略
+func DeleteRole(op RBACOperator, code string) error {
+	if err := checkRoleAdmin(op); err != nil {
+		return err
+	}
+
+	var deleted deletedRole
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		role, err := getRole(tx, code)
+		if err != nil {
+			return err
+		}
+		var assigned, primary int64
+		if err := tx.Table("user_roles").Where("role_id = ?", role.ID).Count(&assigned).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.User{}).Where("role = ?", code).Count(&primary).Error; err != nil {
+			return err
+		}
+		if assigned > 0 || primary > 0 {
+			return ErrRoleInUse
+		}
+
+		deleted.role = *role
+		if err := tx.Where("role = ?", code).Find(&deleted.menus).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ?", code).Find(&deleted.policies).Error; err != nil {
+			return err
+		}
+		if err := tx.Preload("Departments").Where("role = ?", code).Find(&deleted.dataScopes).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ?", code).Find(&deleted.mfa).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ? OR subject = ?", code, code).Find(&deleted.suspended).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("role = ?", code).Delete(&model.RoleMenu{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ?", code).Delete(&model.MenuPolicy{}).Error; err != nil {
+			return err
+		}
+		if len(deleted.dataScopes) > 0 {
+			scopeIDs := make([]uint, 0, len(deleted.dataScopes))
+			for _, s := range deleted.dataScopes {
+				scopeIDs = append(scopeIDs, s.ID)
+			}
+			if err := tx.Table("role_data_scope_departments").Where("role_data_scope_id IN ?", scopeIDs).Delete(map[string]interface{}{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&model.RoleDataScope{}, scopeIDs).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("role = ?", code).Delete(&model.MFARolePolicy{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ? OR subject = ?", code, code).Delete(&model.RoleSuspendedGrouping{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	policies, groupings, err := removeRolePolicies(op, code)
+	if err != nil {
+		if restoreErr := deleted.restore(); restoreErr != nil {
+			middleware.Logger.Error("恢复角色失败", zap.String("role", code), zap.Error(restoreErr))
+		}
+		return err
+	}
+
+	auditPolicyChange(op, "delete_role",
+		zap.String("role", code),
+		zap.Int("policies", len(policies)),
+		zap.Int("groupings", len(groupings)))
+	return nil
+}
+
+// removeRolePolicies 删除角色的 p 策略和引用该角色的 g 策略，失败或操作者失去权限管理权限时恢复已删除的策略
+func removeRolePolicies(op RBACOperator, code string) ([][]string, [][]string, error) {
+	policies, err := enforcer.GetFilteredPolicy(0, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	members, err := enforcer.GetFilteredGroupingPolicy(1, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	inherits, err := enforcer.GetFilteredGroupingPolicy(0, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	groupings := append(members, inherits...)
+
+	var removed [][]string
+	_, err = enforcer.RemoveFilteredPolicy(0, code)
+	if err == nil {
+		removed, err = applyGroupings(nil, groupings)
+	}
+	if err == nil {
+		err = checkLockout(op)
+	}
+	if err != nil {
+		if len(policies) > 0 {
+			if _, restoreErr := enforcer.AddPolicies(policies); restoreErr != nil {
+				middleware.Logger.Error("恢复角色策略失败", zap.Error(restoreErr))
+			}
+		}
+		if _, restoreErr := applyGroupings(removed, nil); restoreErr != nil {
+			middleware.Logger.Error("恢复角色分配失败", zap.Error(restoreErr))
+		}
+		return nil, nil, err
+	}
+	return policies, groupings, nil
+}
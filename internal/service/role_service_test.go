@@ -0,0 +1,200 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"testing"
+)
+
+// createTestRoles 创建启用的角色
+func createTestRoles(t *testing.T, codes ...string) {
+	t.Helper()
+	for _, code := range codes {
+		if _, err := CreateRole(RBACOperator{}, &CreateRoleRequest{Code: code, Name: code}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func setRoleStatus(op RBACOperator, code, status string) error {
+	return UpdateRole(op, code, &UpdateRoleRequest{Name: code, Status: status})
+}
+
+// roleAdmin 只通过 chief 角色拥有全部租户管理权限的操作者
+func roleAdmin(t *testing.T) RBACOperator {
+	t.Helper()
+	if _, err := enforcer.AddPolicy("chief", "*", "/api/*", "*"); err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, "chief", "Secret#123", "user")
+	if _, err := enforcer.AddGroupingPolicy(middleware.UserSubject(user.ID), "chief", "*"); err != nil {
+		t.Fatal(err)
+	}
+	return operator(user)
+}
+
+func TestDisableRoleSuspendsGroupings(t *testing.T) {
+	setupTestDB(t)
+	createTestRoles(t, "editor", "chief")
+	alice := createTestUser(t, "alice", "Secret#123", "user")
+	if err := UpdateUser(adminScope(t), alice.ID, &UpdateUserRequest{Roles: []string{"editor"}}); err != nil {
+		t.Fatal(err)
+	}
+	sub := middleware.UserSubject(alice.ID)
+	if _, err := enforcer.AddPolicy("editor", "*", "/api/menus", "GET"); err != nil {
+		t.Fatal(err)
+	}
+	// 角色继承和其他租户的授权不是由用户角色分配产生的
+	for _, g := range [][]string{{"chief", "editor", "*"}, {sub, "editor", "tenant:2"}} {
+		if _, err := enforcer.AddGroupingPolicy(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	requests := [][]string{{sub, "tenant:1"}, {sub, "tenant:2"}, {"chief", "tenant:1"}}
+	allowed := func() []bool {
+		var list []bool
+		for _, r := range requests {
+			ok, _ := enforcer.Enforce(r[0], r[1], "/api/menus", "GET")
+			list = append(list, ok)
+		}
+		return list
+	}
+	suspended := func() int64 {
+		var n int64
+		repository.DB.Model(&model.RoleSuspendedGrouping{}).Where("role = ?", "editor").Count(&n)
+		return n
+	}
+
+	if err := setRoleStatus(RBACOperator{}, "editor", model.RoleStatusDisabled); err != nil {
+		t.Fatal(err)
+	}
+	for i, ok := range allowed() {
+		if ok {
+			t.Errorf("%v allowed through a disabled role", requests[i])
+		}
+	}
+	if rules, _ := enforcer.GetFilteredGroupingPolicy(1, "editor"); len(rules) != 0 {
+		t.Errorf("groupings of a disabled role kept: %v", rules)
+	}
+	if n := suspended(); n != 2 {
+		t.Errorf("suspended groupings = %d, want 2", n)
+	}
+	if err := AddGrouping(RBACOperator{}, GroupingRule{User: sub, Role: "editor", Dom: "tenant:3"}); !errors.Is(err, ErrRoleDisabled) {
+		t.Errorf("assign a disabled role: err = %v, want ErrRoleDisabled", err)
+	}
+
+	if err := setRoleStatus(RBACOperator{}, "editor", model.RoleStatusEnabled); err != nil {
+		t.Fatal(err)
+	}
+	for i, ok := range allowed() {
+		if !ok {
+			t.Errorf("%v denied after enabling the role", requests[i])
+		}
+	}
+	if n := suspended(); n != 0 {
+		t.Errorf("suspended groupings after enabling = %d, want 0", n)
+	}
+}
+
+func TestDisableRoleLockout(t *testing.T) {
+	setupTestDB(t)
+	createTestRoles(t, "chief")
+	op := roleAdmin(t)
+
+	if err := setRoleStatus(op, "chief", model.RoleStatusDisabled); !errors.Is(err, ErrRBACLockout) {
+		t.Fatalf("disable own role: err = %v, want ErrRBACLockout", err)
+	}
+	role, err := getRole(repository.DB, "chief")
+	if err != nil || role.Status != model.RoleStatusEnabled {
+		t.Errorf("role after a rejected disable = %+v, %v", role, err)
+	}
+	if err := checkRoleAdmin(op); err != nil {
+		t.Errorf("operator lost access: %v", err)
+	}
+	var n int64
+	repository.DB.Model(&model.RoleSuspendedGrouping{}).Count(&n)
+	if n != 0 {
+		t.Errorf("suspended groupings after a rejected disable = %d, want 0", n)
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	menu := setupMenuTest(t)
+	createTestRoles(t, "chief")
+	alice := createTestUser(t, "alice", "Secret#123", "editor")
+	setRoleMenus(t, "editor", menu.ID)
+	if err := SetDataScope(model.DefaultTenantID, "editor", &DataScopeRequest{Scope: model.DataScopeSelf}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMFARolePolicy("editor", &MFARolePolicyRequest{Required: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enforcer.AddGroupingPolicy("chief", "editor", "*"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteRole(RBACOperator{}, "editor"); !errors.Is(err, ErrRoleInUse) {
+		t.Fatalf("delete an assigned role: err = %v, want ErrRoleInUse", err)
+	}
+	if err := UpdateUser(adminScope(t), alice.ID, &UpdateUserRequest{Role: "user"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteRole(RBACOperator{}, "editor"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := getRole(repository.DB, "editor"); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("deleted role: err = %v, want ErrRoleNotFound", err)
+	}
+	if rules, _ := enforcer.GetFilteredPolicy(0, "editor"); len(rules) != 0 {
+		t.Errorf("policies of a deleted role kept: %v", rules)
+	}
+	if rules, _ := enforcer.GetFilteredGroupingPolicy(1, "editor"); len(rules) != 0 {
+		t.Errorf("groupings of a deleted role kept: %v", rules)
+	}
+	for _, table := range []any{&model.RoleMenu{}, &model.MenuPolicy{}, &model.RoleDataScope{}, &model.MFARolePolicy{}} {
+		var n int64
+		repository.DB.Model(table).Where("role = ?", "editor").Count(&n)
+		if n != 0 {
+			t.Errorf("%T records of a deleted role kept: %d", table, n)
+		}
+	}
+}
+
+func TestDeleteRoleLockoutRestores(t *testing.T) {
+	menu := setupMenuTest(t)
+	createTestRoles(t, "chief")
+	op := roleAdmin(t)
+	setRoleMenus(t, "chief", menu.ID)
+	if err := SetDataScope(model.DefaultTenantID, "chief", &DataScopeRequest{Scope: model.DataScopeSelf}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enforcer.AddGroupingPolicy("editor", "chief", "*"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteRole(op, "chief"); !errors.Is(err, ErrRBACLockout) {
+		t.Fatalf("delete own role: err = %v, want ErrRBACLockout", err)
+	}
+	if _, err := getRole(repository.DB, "chief"); err != nil {
+		t.Errorf("role not restored: %v", err)
+	}
+	if err := checkRoleAdmin(op); err != nil {
+		t.Errorf("operator lost access: %v", err)
+	}
+	if ok, _ := enforcer.HasGroupingPolicy("editor", "chief", "*"); !ok {
+		t.Error("inheritance not restored")
+	}
+	if ok, _ := enforcer.HasPolicy("chief", "tenant:1", "/api/users", "GET"); !ok {
+		t.Error("menu policy not restored")
+	}
+	for _, table := range []any{&model.RoleMenu{}, &model.MenuPolicy{}, &model.RoleDataScope{}} {
+		var n int64
+		repository.DB.Model(table).Where("role = ?", "chief").Count(&n)
+		if n != 1 {
+			t.Errorf("%T records after a rejected delete = %d, want 1", table, n)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/casbin/casbin/v2/util"
+)
+
+// RouteEntry 权限目录中的一个接口，Path 与 p 策略的 obj 使用相同的格式（keyMatch2），可以直接用于编写策略
+type RouteEntry struct {
+	Method  string   `json:"method"`
+	Path    string   `json:"path"`
+	Summary string   `json:"summary"`
+	Tags    []string `json:"tags"`
+	// Protected 接口是否经过 Casbin 鉴权，为 false 的接口不需要策略
+	Protected bool   `json:"protected"`
+	Handler   string `json:"handler"`
+}
+
+// RouteCatalogueQuery 权限目录的查询条件，为空的条件不过滤
+type RouteCatalogueQuery struct {
+	Tag       string
+	Protected *bool
+}
+
+// routeCatalogue 路由注册完成后生成的权限目录，启动后不再变化
+var routeCatalogue []RouteEntry
+
+// InitRouteCatalogue 保存权限目录，按路径和方法排序
+func InitRouteCatalogue(routes []RouteEntry) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	routeCatalogue = routes
+}
+
+// ListRouteCatalogue 查询权限目录
+func ListRouteCatalogue(q RouteCatalogueQuery) []RouteEntry {
+	list := []RouteEntry{}
+	for _, route := range routeCatalogue {
+		if q.Protected != nil && route.Protected != *q.Protected {
+			continue
+		}
+		if q.Tag != "" && !containsString(route.Tags, q.Tag) {
+			continue
+		}
+		list = append(list, route)
+	}
+	return list
+}
+
+// policyMatchesRoute 判断策略是否作用于接口：方法相同或为 *，且策略路径匹配路由，或策略是该路由的一个具体路径
+func policyMatchesRoute(rule PolicyRule, route RouteEntry) bool {
+	if rule.Act != "*" && !strings.EqualFold(rule.Act, route.Method) {
+		return false
+	}
+	return util.KeyMatch2(route.Path, rule.Obj) || util.KeyMatch2(rule.Obj, route.Path)
+}
+
+// CheckRouteCoverage 对比权限目录和当前的策略，返回没有任何策略覆盖的受保护接口，以及不匹配任何接口的策略
+func CheckRouteCoverage() ([]RouteEntry, []PolicyRule, error) {
+	rules, err := enforcer.GetPolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+	policies := toPolicyRules(rules)
+	used := make([]bool, len(policies))
+
+	var uncovered []RouteEntry
+	for _, route := range routeCatalogue {
+		covered := false
+		for i, rule := range policies {
+			if policyMatchesRoute(rule, route) {
+				covered = true
+				used[i] = true
+			}
+		}
+		if route.Protected && !covered {
+			uncovered = append(uncovered, route)
+		}
+	}
+
+	var unused []PolicyRule
+	for i, rule := range policies {
+		if !used[i] {
+			unused = append(unused, rule)
+		}
+	}
+	return uncovered, unused, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+)
+
+// setRouteCatalogue 设置测试使用的权限目录，测试结束后清空
+func setRouteCatalogue(t *testing.T, routes []RouteEntry) {
+	t.Helper()
+	InitRouteCatalogue(routes)
+	t.Cleanup(func() { routeCatalogue = nil })
+}
+
+func TestListRouteCatalogue(t *testing.T) {
+	setRouteCatalogue(t, []RouteEntry{
+		{Method: "POST", Path: "/api/users", Tags: []string{"用户"}, Protected: true},
+		{Method: "GET", Path: "/api/users", Tags: []string{"用户"}, Protected: true},
+		{Method: "POST", Path: "/api/login", Tags: []string{"认证"}},
+	})
+
+	all := ListRouteCatalogue(RouteCatalogueQuery{})
+	if len(all) != 3 || all[0].Path != "/api/login" || all[1].Method != "GET" || all[2].Method != "POST" {
+		t.Errorf("catalogue not sorted by path and method: %+v", all)
+	}
+	public := false
+	if list := ListRouteCatalogue(RouteCatalogueQuery{Protected: &public}); len(list) != 1 || list[0].Path != "/api/login" {
+		t.Errorf("public routes = %+v", list)
+	}
+	if list := ListRouteCatalogue(RouteCatalogueQuery{Tag: "用户"}); len(list) != 2 {
+		t.Errorf("routes tagged 用户 = %+v", list)
+	}
+}
+
+func TestCheckRouteCoverage(t *testing.T) {
+	setupTestDB(t)
+	setRouteCatalogue(t, []RouteEntry{
+		{Method: "GET", Path: "/api/users/:id", Protected: true},
+		{Method: "DELETE", Path: "/api/users/:id", Protected: true},
+		{Method: "GET", Path: "/metrics", Protected: true},
+		{Method: "GET", Path: "/health"},
+	})
+	policies := [][]string{
+		// 具体路径覆盖对应的路由
+		{"viewer", "tenant:1", "/api/users/1", "GET"},
+		// 方法不匹配任何接口
+		{"viewer", "tenant:1", "/api/users/:id", "PATCH"},
+		{"viewer", "tenant:1", "/api/legacy", "GET"},
+	}
+	for _, p := range policies {
+		if _, err := enforcer.AddPolicy(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uncovered, unused, err := CheckRouteCoverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 默认的 admin 策略覆盖 /api 下的全部接口，不需要鉴权的接口不要求策略
+	if len(uncovered) != 1 || uncovered[0].Path != "/metrics" {
+		t.Errorf("uncovered = %+v, want GET /metrics", uncovered)
+	}
+	if len(unused) != 2 {
+		t.Fatalf("unused = %+v, want 2 policies", unused)
+	}
+	for _, rule := range unused {
+		if rule.Obj == "/api/users/1" || rule.Sub == "admin" {
+			t.Errorf("policy %+v reported as unused", rule)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var ErrSessionNotFound = errors.New("会话不存在或已终止")
+
+// ClientInfo 发起登录的客户端信息，记录在会话中
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type SessionResponse struct {
+	SessionID  string    `json:"session_id"`
+	UserID     uint      `json:"user_id"`
+	Username   string    `json:"username"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current 是否为发起本次请求的会话
+	Current bool `json:"current"`
+}
+
+func newSessionResponse(session *model.UserSession, currentSessionID string) *SessionResponse {
+	return &SessionResponse{
+		SessionID:  session.SessionID,
+		UserID:     session.UserID,
+		Username:   session.User.Username,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.SessionID == currentSessionID,
+	}
+}
+
+// truncateUserAgent 截断过长的 User-Agent，与字段长度一致
+func truncateUserAgent(ua string) string {
+	return truncate(ua, 255)
+}
+
+// saveSession 登录时创建会话，刷新令牌时更新会话当前的访问令牌和客户端信息
+func saveSession(tx *gorm.DB, userID uint, sessionID, jti string, client ClientInfo, create bool) error {
+	now := time.Now()
+	expiresAt := now.Add(refreshTokenTTL())
+	if create {
+		return tx.Create(&model.UserSession{
+			SessionID:  sessionID,
+			UserID:     userID,
+			UserAgent:  truncateUserAgent(client.UserAgent),
+			IP:         client.IP,
+			JTI:        jti,
+			CreatedAt:  now,
+			LastSeenAt: now,
+			ExpiresAt:  expiresAt,
+		}).Error
+	}
+	return tx.Model(&model.UserSession{}).
+		Where("session_id = ?", sessionID).
+		Updates(map[string]interface{}{
+			"jti":          jti,
+			"user_agent":   truncateUserAgent(client.UserAgent),
+			"ip":           client.IP,
+			"last_seen_at": now,
+			"expires_at":   expiresAt,
+		}).Error
+}
+
+func activeSessions(db *gorm.DB) *gorm.DB {
+	return db.Model(&model.UserSession{}).
+		Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+}
+
+// ListSessions 查询用户当前有效的会话，按最后活跃时间倒序
+func ListSessions(userID uint, currentSessionID string) ([]*SessionResponse, error) {
+	var sessions []model.UserSession
+	err := activeSessions(repository.DB).Preload("User").
+		Where("user_id = ?", userID).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*SessionResponse, len(sessions))
+	for i := range sessions {
+		resp[i] = newSessionResponse(&sessions[i], currentSessionID)
+	}
+	return resp, nil
+}
+
+// ListOnlineSessions 分页查询数据范围内所有用户当前有效的会话（在线用户）
+func ListOnlineSessions(scope *DataScope, page, pageSize int) ([]*SessionResponse, int64, error) {
+	var sessions []model.UserSession
+	var total int64
+
+	scopedUsers := repository.DB.Model(&model.User{}).Select("id").Scopes(scope.Users())
+	if err := activeSessions(repository.DB).Where("user_id IN (?)", scopedUsers).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := activeSessions(repository.DB).Where("user_id IN (?)", scopedUsers).Preload("User").
+		Order("last_seen_at desc").
+		Offset(offset).Limit(pageSize).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp := make([]*SessionResponse, len(sessions))
+	for i := range sessions {
+		resp[i] = newSessionResponse(&sessions[i], "")
+	}
+	return resp, total, nil
+}
+
+// RevokeSession 终止用户的指定会话，会话的访问令牌和刷新令牌立即失效
+func RevokeSession(userID uint, sessionID string) error {
+	result := repository.DB.Model(&model.UserSession{}).
+		Where("session_id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	middleware.Logger.Info("终止会话",
+		zap.Uint("userID", userID),
+		zap.String("sessionID", sessionID))
+	return RevokeTokenFamily(sessionID)
+}
+
+// RevokeOtherSessions 终止用户除当前会话以外的所有会话
+func RevokeOtherSessions(userID uint, currentSessionID string) error {
+	if err := revokeSessions(userID, currentSessionID); err != nil {
+		return err
+	}
+	middleware.Logger.Info("终止其他会话",
+		zap.Uint("userID", userID),
+		zap.String("currentSessionID", currentSessionID))
+	return repository.DB.Model(&model.RefreshToken{}).
+		Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, currentSessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeSessions 将用户的会话标记为已终止，exceptSessionID 非空时保留该会话
+func revokeSessions(userID uint, exceptSessionID string) error {
+	query := repository.DB.Model(&model.UserSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptSessionID != "" {
+		query = query.Where("session_id <> ?", exceptSessionID)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
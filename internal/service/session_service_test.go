@@ -0,0 +1,120 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// loginFrom 使用指定的 User-Agent 登录，返回令牌对和会话 ID
+func loginFrom(t *testing.T, username, password, userAgent string) (*LoginResponse, string) {
+	t.Helper()
+	resp, err := Login(&LoginRequest{Username: username, Password: password}, ClientInfo{IP: testClient.IP, UserAgent: userAgent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, info := tokenContext(t, resp.Token)
+	if status != http.StatusOK {
+		t.Fatalf("login token rejected: %d", status)
+	}
+	return resp, info["sessionID"].(string)
+}
+
+func TestListSessions(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice", "Secret#123", "user")
+	createTestUser(t, "bob", "Secret#123", "user")
+	_, laptop := loginFrom(t, "alice", "Secret#123", "laptop")
+	phoneResp, phone := loginFrom(t, "alice", "Secret#123", "phone")
+	loginFrom(t, "bob", "Secret#123", "laptop")
+
+	// 刷新令牌沿用原来的会话，更新客户端信息
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: phoneResp.RefreshToken}, ClientInfo{IP: "198.51.100.7", UserAgent: "phone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := ListSessions(alice.ID, laptop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %d, want 2", len(sessions))
+	}
+	for _, s := range sessions {
+		switch s.SessionID {
+		case laptop:
+			if !s.Current || s.UserAgent != "laptop" {
+				t.Errorf("laptop session = %+v", s)
+			}
+		case phone:
+			if s.Current || s.IP != "198.51.100.7" {
+				t.Errorf("refreshed phone session = %+v", s)
+			}
+		default:
+			t.Errorf("unexpected session %+v", s)
+		}
+	}
+
+	online, total, err := ListOnlineSessions(adminScope(t), 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(online) != 3 {
+		t.Errorf("online sessions = %d (total %d), want 3", len(online), total)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice", "Secret#123", "user")
+	bob := createTestUser(t, "bob", "Secret#123", "user")
+	laptopResp, laptop := loginFrom(t, "alice", "Secret#123", "laptop")
+	phoneResp, _ := loginFrom(t, "alice", "Secret#123", "phone")
+
+	// 不能终止其他用户的会话
+	if err := RevokeSession(bob.ID, laptop); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("revoke another user's session: err = %v, want ErrSessionNotFound", err)
+	}
+	if err := RevokeSession(alice.ID, laptop); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := tokenContext(t, laptopResp.Token); status != http.StatusUnauthorized {
+		t.Errorf("access token of a revoked session: status = %d, want 401", status)
+	}
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: laptopResp.RefreshToken}, testClient); !errors.Is(err, ErrRefreshTokenRevoked) {
+		t.Errorf("refresh token of a revoked session: err = %v, want ErrRefreshTokenRevoked", err)
+	}
+	if status, _ := tokenContext(t, phoneResp.Token); status != http.StatusOK {
+		t.Errorf("other session: status = %d, want 200", status)
+	}
+	if err := RevokeSession(alice.ID, laptop); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoke a session twice: err = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice", "Secret#123", "user")
+	createTestUser(t, "bob", "Secret#123", "user")
+	currentResp, current := loginFrom(t, "alice", "Secret#123", "laptop")
+	otherResp, _ := loginFrom(t, "alice", "Secret#123", "phone")
+	bobResp, _ := loginFrom(t, "bob", "Secret#123", "laptop")
+
+	if err := RevokeOtherSessions(alice.ID, current); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := tokenContext(t, otherResp.Token); status != http.StatusUnauthorized {
+		t.Errorf("other session: status = %d, want 401", status)
+	}
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: otherResp.RefreshToken}, testClient); !errors.Is(err, ErrRefreshTokenRevoked) {
+		t.Errorf("refresh token of another session: err = %v, want ErrRefreshTokenRevoked", err)
+	}
+	for name, resp := range map[string]*LoginResponse{"current session": currentResp, "another user": bobResp} {
+		if status, _ := tokenContext(t, resp.Token); status != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", name, status)
+		}
+	}
+	if _, err := RefreshToken(&RefreshTokenRequest{RefreshToken: currentResp.RefreshToken}, testClient); err != nil {
+		t.Errorf("refresh token of the current session: %v", err)
+	}
+}
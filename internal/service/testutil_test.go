@@ -0,0 +1,117 @@
+package service
+
+import (
+	"fastgin/config"
+	"fastgin/internal/middleware"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB 为每个测试创建独立的 SQLite 数据库，初始化令牌、登录失败计数、会话和 Casbin，
+// 角色和策略与默认配置一致
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	middleware.Logger = zap.NewNop()
+	config.GlobalConfig = config.Config{}
+	// 降低密码哈希开销，测试不关心哈希强度
+	InitPasswordHasher(config.PasswordConfig{Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1})
+
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	err = db.AutoMigrate(
+		&model.User{},
+		&model.RefreshToken{},
+		&model.RevokedToken{},
+		&model.UserIdentity{},
+		&model.OAuthState{},
+		&model.UserMFA{},
+		&model.MFARecoveryCode{},
+		&model.MFARolePolicy{},
+		&model.LoginAttempt{},
+		&model.PasswordHistory{},
+		&model.APIKey{},
+		&model.UserSession{},
+		&model.CasbinChange{},
+		&model.Department{},
+		&model.RoleDataScope{},
+		&model.Menu{},
+		&model.MenuAPI{},
+		&model.RoleMenu{},
+		&model.MenuPolicy{},
+		&model.Role{},
+		&model.RoleSuspendedGrouping{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.DB = db
+
+	middleware.InitRevocationStore(db, "db")
+	middleware.InitLoginAttemptStore(db, "db")
+	middleware.InitSessionStore(db)
+	middleware.InitAPIKeyStore(db)
+	if err := middleware.InitJWTKeys(config.JWTConfig{Secret: "test-secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := middleware.NewCasbinMiddleware(db, config.CasbinConfig{
+		Model:         "../../config/rbac_model.conf",
+		DefaultPolicy: "../../config/rbac_policy.csv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQLite 只允许一个写连接，策略只保存在内存中
+	e.EnableAutoSave(false)
+	InitRBAC(e)
+	// 与启动时相同，空数据库中创建 admin 和 user 角色
+	if err := SyncUserRoles(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// createTestUser 创建默认租户内的用户，并同步角色和 g 策略
+func createTestUser(t *testing.T, username, password, role string) *model.User {
+	t.Helper()
+	return createTenantUser(t, model.DefaultTenantID, username, password, role)
+}
+
+// createTenantUser 创建指定租户内的用户，并同步角色和 g 策略
+func createTenantUser(t *testing.T, tenantID uint, username, password, role string) *model.User {
+	t.Helper()
+	user := &model.User{
+		TenantID: tenantID,
+		Username: username,
+		Password: password,
+		Role:     role,
+	}
+	if err := user.HashPassword(); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := SyncUserRoles(); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// testClient 测试使用的客户端信息
+var testClient = ClientInfo{IP: "192.0.2.1", UserAgent: "go-test"}
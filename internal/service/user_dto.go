@@ -4,11 +4,35 @@ package service
 type LoginRequests struct {
 	Username string `json:"username" binding:"required" example:"admin"`
 	Password string `json:"password" binding:"required" example:"123456"`
+	// 登录需要验证码时必填
+	CaptchaID   string `json:"captcha_id" example:"Jx3k9QbV0fW2mY7tRzL8cA"`
+	CaptchaCode string `json:"captcha_code" example:"4821"`
 }
 
 // LoginResponse 登录响应
 type LoginResponses struct {
-	Token string `json:"token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	ExpiresIn    int64  `json:"expires_in" example:"7200"`
+	RefreshToken string `json:"refresh_token" example:"Q2hhbmdlTWVQbGVhc2U..."`
+	Username     string `json:"username" example:"admin"`
+	Role         string `json:"role" example:"admin"`
+	// 需要两步验证时不返回 token，使用 mfa_token 调用 /login/mfa 完成登录
+	MFARequired      bool     `json:"mfa_required" example:"false"`
+	MFASetupRequired bool     `json:"mfa_setup_required" example:"false"`
+	MFAToken         string   `json:"mfa_token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	RecoveryCodes    []string `json:"recovery_codes" example:"3f9a2c-81b0d4"`
+	// 为 true 时 token 只能用于调用 /me/password 修改密码
+	MustChangePassword bool `json:"must_change_password" example:"false"`
+}
+
+// RefreshTokenRequests 刷新令牌请求参数
+type RefreshTokenRequests struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"Q2hhbmdlTWVQbGVhc2U..."`
+}
+
+// LogoutRequests 退出登录请求参数
+type LogoutRequests struct {
+	RefreshToken string `json:"refresh_token" example:"Q2hhbmdlTWVQbGVhc2U..."`
 }
 
 // CreateUserRequest 创建用户请求
@@ -17,6 +41,11 @@ type CreateUserRequests struct {
 	Password string `json:"password" binding:"required" example:"123456"`
 	Email    string `json:"email" binding:"required,email" example:"user@example.com"`
 	Nickname string `json:"nickname" example:"新用户"`
+	// 主角色和其他角色，必须是已启用的角色
+	Role  string   `json:"role" binding:"required" example:"user"`
+	Roles []string `json:"roles" example:"editor"`
+	// 所属部门，必须在操作者的数据权限范围内
+	DepartmentID uint `json:"department_id" example:"2"`
 }
 
 // UpdateUserRequest 更新用户请求
@@ -24,16 +53,38 @@ type UpdateUserRequests struct {
 	Email    string `json:"email" binding:"omitempty,email" example:"user@example.com"`
 	Nickname string `json:"nickname" example:"用户昵称"`
 	Password string `json:"password" example:"123456"`
+	// 主角色，为空时不修改
+	Role string `json:"role" example:"user"`
+	// 主角色之外的其他角色，为 null 时不修改
+	Roles []string `json:"roles" example:"editor"`
+	// 所属部门，0 表示不修改
+	DepartmentID uint `json:"department_id" example:"2"`
+}
+
+// ChangePasswordRequests 修改密码请求
+type ChangePasswordRequests struct {
+	OldPassword string `json:"old_password" binding:"required" example:"OldPassw0rd"`
+	NewPassword string `json:"new_password" binding:"required" example:"NewPassw0rd!"`
+}
+
+// ImpersonateRequests 模拟登录请求
+type ImpersonateRequests struct {
+	Reason string `json:"reason" example:"工单 #1024：复现用户看到的页面"`
 }
 
 // UserInfo 用户信息
 type UserInfo struct {
-	ID        uint   `json:"id" example:"1"`
-	Username  string `json:"username" example:"admin"`
-	Email     string `json:"email" example:"admin@example.com"`
-	Nickname  string `json:"nickname" example:"管理员"`
-	CreatedAt string `json:"created_at" example:"2023-01-01 12:00:00"`
-	UpdatedAt string `json:"updated_at" example:"2023-01-01 12:00:00"`
+	ID           uint   `json:"id" example:"1"`
+	TenantID     uint   `json:"tenant_id" example:"1"`
+	DepartmentID uint   `json:"department_id" example:"2"`
+	Username     string `json:"username" example:"admin"`
+	Email        string `json:"email" example:"admin@example.com"`
+	Nickname     string `json:"nickname" example:"管理员"`
+	Role         string `json:"role" example:"admin"`
+	// Roles 用户的全部角色，包含主角色
+	Roles     []RoleResponses `json:"roles"`
+	CreatedAt string          `json:"created_at" example:"2023-01-01 12:00:00"`
+	UpdatedAt string          `json:"updated_at" example:"2023-01-01 12:00:00"`
 }
 
 // PageResponse 分页响应
@@ -43,3 +94,64 @@ type PageResponse struct {
 	Page     int         `json:"page"`
 	PageSize int         `json:"page_size"`
 }
+
+// CreateAPIKeyRequests 创建 API Key 请求
+type CreateAPIKeyRequests struct {
+	Name      string   `json:"name" binding:"required" example:"ci-deploy"`
+	Scopes    []string `json:"scopes" example:"GET:/api/users,GET:/api/users/*"`
+	ExpiresIn int64    `json:"expires_in" example:"2592000"`
+}
+
+// APIKeyResponses API Key 信息
+type APIKeyResponses struct {
+	ID         uint     `json:"id" example:"1"`
+	Name       string   `json:"name" example:"ci-deploy"`
+	Prefix     string   `json:"prefix" example:"fgk_3f9a2c81"`
+	Scopes     []string `json:"scopes" example:"GET:/api/users"`
+	ExpiresAt  string   `json:"expires_at" example:"2025-04-01T12:00:00Z"`
+	LastUsedAt string   `json:"last_used_at" example:"2025-03-01T12:00:00Z"`
+	RevokedAt  string   `json:"revoked_at" example:"2025-03-15T12:00:00Z"`
+	CreatedAt  string   `json:"created_at" example:"2025-03-01T12:00:00Z"`
+	// 完整密钥，只在创建时返回一次
+	Key string `json:"key" example:"fgk_3f9a2c81_Q2hhbmdlTWVQbGVhc2U..."`
+}
+
+// SessionResponses 登录会话信息
+type SessionResponses struct {
+	SessionID  string `json:"session_id" example:"Zm9vYmFyYmF6cXV4"`
+	UserID     uint   `json:"user_id" example:"1"`
+	Username   string `json:"username" example:"admin"`
+	UserAgent  string `json:"user_agent" example:"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)"`
+	IP         string `json:"ip" example:"192.168.1.10"`
+	CreatedAt  string `json:"created_at" example:"2025-03-01T12:00:00Z"`
+	LastSeenAt string `json:"last_seen_at" example:"2025-03-01T12:30:00Z"`
+	ExpiresAt  string `json:"expires_at" example:"2025-03-08T12:30:00Z"`
+	Current    bool   `json:"current" example:"true"`
+}
+
+// CaptchaResponses 验证码响应
+type CaptchaResponses struct {
+	CaptchaID string `json:"captcha_id" example:"Jx3k9QbV0fW2mY7tRzL8cA"`
+	Image     string `json:"image" example:"data:image/png;base64,iVBORw0KGgo..."`
+	ExpiresIn int64  `json:"expires_in" example:"300"`
+}
+
+// RegisterRequests 自助注册请求
+type RegisterRequests struct {
+	Username    string `json:"username" binding:"required,max=32" example:"alice"`
+	Email       string `json:"email" binding:"required,email" example:"alice@example.com"`
+	Password    string `json:"password" binding:"required" example:"Passw0rd!"`
+	CaptchaID   string `json:"captcha_id" example:"Jx3k9QbV0fW2mY7tRzL8cA"`
+	CaptchaCode string `json:"captcha_code" example:"4821"`
+}
+
+// EmailRequests 邮箱请求
+type EmailRequests struct {
+	Email string `json:"email" binding:"required,email" example:"alice@example.com"`
+}
+
+// ResetPasswordRequests 重置密码请求
+type ResetPasswordRequests struct {
+	Token       string `json:"token" binding:"required" example:"b3J0aGFuZGVyLXJlc2V0LXRva2Vu"`
+	NewPassword string `json:"new_password" binding:"required" example:"NewPassw0rd!"`
+}
@@ -5,127 +5,447 @@ import (
 	"fastgin/internal/middleware"
 	"fastgin/internal/model"
 	"fastgin/internal/repository"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOldPasswordIncorrect 修改密码时原密码错误
+	ErrOldPasswordIncorrect = errors.New("原密码错误")
+	ErrUserNotFound         = errors.New("用户不存在")
+	// ErrUpdateSelfRestricted 修改自己的密码需要校验原密码，角色和部门只能由其他管理员修改
+	ErrUpdateSelfRestricted = errors.New("不能通过该接口修改自己的角色、部门或密码")
 )
 
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// 需要验证码时填写 /api/captcha 返回的 captcha_id 和图片中的答案
+	CaptchaID   string `json:"captcha_id"`
+	CaptchaCode string `json:"captcha_code"`
 }
 
 type LoginResponse struct {
-	Token    string `json:"token"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Token        string `json:"token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	// 需要两步验证时不返回 token，客户端使用 MFAToken 调用 /api/login/mfa 完成登录
+	MFARequired      bool     `json:"mfa_required,omitempty"`
+	MFASetupRequired bool     `json:"mfa_setup_required,omitempty"`
+	MFAToken         string   `json:"mfa_token,omitempty"`
+	RecoveryCodes    []string `json:"recovery_codes,omitempty"`
+	// 为 true 时 token 只能用于调用 /api/me/password 修改密码
+	MustChangePassword bool `json:"must_change_password,omitempty"`
 }
 
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
-	Role     string `json:"role" binding:"required"`
+	// Role 主角色，Roles 为主角色之外的其他角色，都必须是已启用的角色
+	Role         string   `json:"role" binding:"required"`
+	Roles        []string `json:"roles"`
+	Email        string   `json:"email" binding:"omitempty,email,max=128"`
+	DepartmentID uint     `json:"department_id"`
 }
 
 type UpdateUserRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
-	Role     string `json:"role"`
+	// Role 为空时不修改主角色，Roles 为 null 时不修改其他角色
+	Role         string   `json:"role"`
+	Roles        []string `json:"roles"`
+	Email        string   `json:"email" binding:"omitempty,email,max=128"`
+	DepartmentID uint     `json:"department_id"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// dummyPassword 用户不存在时用于校验的密码哈希，使响应时间与密码错误时一致。
+// 必须使用当前配置的算法和参数生成，InitPasswordHasher 修改配置时重新生成
+var dummyPassword atomic.Pointer[string]
+
+// dummyUser 用户不存在时仍执行一次密码校验的用户，哈希尚未生成时使用当前的哈希算法生成
+func dummyUser() *model.User {
+	hashed := dummyPassword.Load()
+	if hashed == nil {
+		hashed = resetDummyPassword()
+	}
+	return &model.User{Password: *hashed}
+}
+
+// resetDummyPassword 使用当前的哈希算法重新生成 dummyPassword
+func resetDummyPassword() *string {
+	hashed, _ := model.HashPassword("fastgin-dummy-password")
+	dummyPassword.Store(&hashed)
+	return &hashed
 }
 
-func Login(req *LoginRequest) (*LoginResponse, error) {
+func Login(req *LoginRequest, client ClientInfo) (*LoginResponse, error) {
 	middleware.Logger.Info("用户尝试登录",
-		zap.String("username", req.Username))
+		zap.String("username", req.Username),
+		zap.String("ip", client.IP))
+
+	if err := checkLoginAllowed(req.Username, client.IP); err != nil {
+		middleware.Logger.Warn("登录已被临时锁定",
+			zap.String("username", req.Username),
+			zap.String("ip", client.IP))
+		return nil, err
+	}
+
+	if CaptchaRequired(req.Username, client.IP) {
+		if err := verifyCaptcha(req.CaptchaID, req.CaptchaCode); err != nil {
+			middleware.Logger.Warn("验证码校验失败",
+				zap.String("username", req.Username),
+				zap.String("ip", client.IP),
+				zap.Error(err))
+			return nil, err
+		}
+	}
 
 	var user model.User
 	result := repository.DB.Where("username = ?", req.Username).First(&user)
 	if result.Error != nil {
+		dummyUser().CheckPassword(req.Password)
+		recordLoginFailure(req.Username, client.IP)
 		middleware.Logger.Warn("用户不存在",
 			zap.String("username", req.Username),
 			zap.Error(result.Error))
-		return nil, errors.New("用户不存在")
+		return nil, ErrLoginFailed
 	}
 
 	if !user.CheckPassword(req.Password) {
+		recordLoginFailure(req.Username, client.IP)
 		middleware.Logger.Warn("密码错误",
 			zap.String("username", req.Username))
-		return nil, errors.New("密码错误")
+		return nil, ErrLoginFailed
+	}
+
+	rehashPassword(&user, req.Password)
+
+	return completeLogin(&user, client)
+}
+
+// completeLogin 密码或单点登录验证身份后的统一流程：检查账号是否已激活，
+// 已启用或角色要求两步验证时先返回两步验证令牌，否则签发令牌
+func completeLogin(user *model.User, client ClientInfo) (*LoginResponse, error) {
+	if user.PendingActivation {
+		middleware.Logger.Warn("账号未激活",
+			zap.String("username", user.Username))
+		return nil, ErrAccountNotActivated
+	}
+
+	// 两步验证通过之前不清除失败计数，否则可以通过反复输入正确的密码无限次猜测验证码
+	resp, err := mfaChallenge(user)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil {
+		middleware.Logger.Info("等待两步验证",
+			zap.String("username", user.Username))
+		return resp, nil
 	}
 
-	// 生成 JWT token
-	token, err := middleware.GenerateToken(user.ID, user.Username, user.Role)
+	// 生成 JWT token 和刷新令牌
+	resp, err = issueTokenPair(repository.DB, user, "", client)
 	if err != nil {
 		middleware.Logger.Error("生成token失败",
 			zap.String("username", user.Username),
 			zap.Error(err))
 		return nil, err
 	}
+	resetLoginFailures(user.Username)
 
 	middleware.Logger.Info("用户登录成功",
 		zap.String("username", user.Username),
 		zap.String("role", user.Role))
 
-	return &LoginResponse{
-		Token:    token,
-		Username: user.Username,
-		Role:     user.Role,
-	}, nil
+	return resp, nil
 }
 
-func CreateUser(req *CreateUserRequest) error {
+// rehashPassword 密码校验通过后，将旧算法或旧参数生成的哈希升级为当前配置，失败时不影响登录
+func rehashPassword(user *model.User, password string) {
+	if !user.PasswordNeedsRehash() {
+		return
+	}
+	hashed, err := model.HashPassword(password)
+	if err == nil {
+		err = repository.DB.Model(user).Update("password", hashed).Error
+	}
+	if err != nil {
+		middleware.Logger.Error("升级密码哈希失败",
+			zap.String("username", user.Username),
+			zap.Error(err))
+		return
+	}
+	middleware.Logger.Info("已升级密码哈希",
+		zap.String("username", user.Username))
+}
+
+// CreateUser 在操作者的租户内创建用户，用户的部门必须在操作者的数据范围内
+func CreateUser(scope *DataScope, req *CreateUserRequest) error {
+	if err := ValidatePassword(req.Password); err != nil {
+		return err
+	}
+	if err := scope.checkDepartment(req.DepartmentID); err != nil {
+		return err
+	}
+	roles := append([]string{req.Role}, req.Roles...)
+
 	user := &model.User{
-		Username: req.Username,
-		Password: req.Password,
-		Role:     req.Role,
+		TenantID:     scope.TenantID,
+		DepartmentID: req.DepartmentID,
+		Username:     req.Username,
+		Password:     req.Password,
+		Role:         req.Role,
+	}
+	// 管理员填写的邮箱视为已验证
+	email := normalizeEmail(req.Email)
+	if email != "" {
+		now := time.Now()
+		user.Email = &email
+		user.EmailVerifiedAt = &now
 	}
 
 	if err := user.HashPassword(); err != nil {
 		return err
 	}
 
-	return repository.DB.Create(user).Error
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		if email != "" {
+			inUse, err := emailInUse(tx, email, 0)
+			if err != nil {
+				return err
+			}
+			if inUse {
+				return ErrEmailTaken
+			}
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if _, err := assignUserRoles(tx, user.ID, roles); err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, user.ID, user.Password)
+	})
+	if err != nil {
+		return emailConflict(err, email, 0)
+	}
+	return syncUserGroupings(user.ID, user.TenantID, nil, roles)
 }
 
-func UpdateUser(id uint, req *UpdateUserRequest) error {
+// UpdateUser 修改数据范围内的用户，用户不在范围内时返回 ErrUserNotFound
+func UpdateUser(scope *DataScope, id uint, req *UpdateUserRequest) error {
+	user, err := GetUser(scope, id)
+	if err != nil {
+		return err
+	}
+	current, err := userRoleCodes(repository.DB, id)
+	if err != nil {
+		return err
+	}
+	roles := updatedRoles(user.Role, current, req)
+	rolesChanged := !sameRoles(current, roles) || req.Role != "" && req.Role != user.Role
+	if id == scope.UserID && (req.Password != "" || rolesChanged ||
+		req.DepartmentID != 0 && req.DepartmentID != user.DepartmentID) {
+		return ErrUpdateSelfRestricted
+	}
 	updates := make(map[string]interface{})
 
 	if req.Username != "" {
 		updates["username"] = req.Username
 	}
 	if req.Password != "" {
+		if err := ValidatePassword(req.Password); err != nil {
+			return err
+		}
+		if err := checkPasswordHistory(repository.DB, user, req.Password); err != nil {
+			return err
+		}
 		hashedPassword, err := model.HashPassword(req.Password)
 		if err != nil {
 			return err
 		}
 		updates["password"] = hashedPassword
+		// 管理员重置的密码，用户下次登录后必须修改
+		updates["must_change_password"] = true
 	}
 	if req.Role != "" {
 		updates["role"] = req.Role
 	}
+	if req.Email != "" {
+		updates["email"] = normalizeEmail(req.Email)
+		updates["email_verified_at"] = time.Now()
+	}
+	if req.DepartmentID != 0 {
+		if err := scope.checkDepartment(req.DepartmentID); err != nil {
+			return err
+		}
+		updates["department_id"] = req.DepartmentID
+	}
+
+	err = repository.DB.Transaction(func(tx *gorm.DB) error {
+		if email, ok := updates["email"].(string); ok {
+			inUse, err := emailInUse(tx, email, id)
+			if err != nil {
+				return err
+			}
+			if inUse {
+				return ErrEmailTaken
+			}
+		}
+		if err := tx.Model(&model.User{}).Scopes(scope.Users()).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return err
+		}
+		if rolesChanged {
+			if _, err := assignUserRoles(tx, id, roles); err != nil {
+				return err
+			}
+		}
+		if hashed, ok := updates["password"].(string); ok {
+			return recordPasswordHistory(tx, id, hashed)
+		}
+		return nil
+	})
+	if email, ok := updates["email"].(string); ok {
+		err = emailConflict(err, email, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if rolesChanged {
+		if err := syncUserGroupings(id, user.TenantID, current, roles); err != nil {
+			return err
+		}
+	}
+
+	// 修改密码或角色后，之前签发的令牌全部失效
+	if req.Password != "" || rolesChanged {
+		return RevokeUserTokens(id)
+	}
+	return nil
+}
+
+// ChangePassword 用户修改自己的密码，成功后其他会话全部失效，并为当前客户端签发新令牌
+func ChangePassword(userID uint, req *ChangePasswordRequest, client ClientInfo) (*LoginResponse, error) {
+	user, err := getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.CheckPassword(req.OldPassword) {
+		return nil, ErrOldPasswordIncorrect
+	}
+	if req.NewPassword == req.OldPassword {
+		return nil, &PasswordPolicyError{Violations: []PasswordViolation{
+			{"same_as_old", "新密码不能与原密码相同"},
+		}}
+	}
+	if err := ValidatePassword(req.NewPassword); err != nil {
+		return nil, err
+	}
+	if err := checkPasswordHistory(repository.DB, user, req.NewPassword); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := model.HashPassword(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+	err = repository.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"password":             hashedPassword,
+			"must_change_password": false,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return recordPasswordHistory(tx, user.ID, hashedPassword)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := RevokeUserTokens(user.ID); err != nil {
+		return nil, err
+	}
 
-	return repository.DB.Model(&model.User{}).Where("id = ?", id).Updates(updates).Error
+	middleware.Logger.Info("用户修改密码",
+		zap.String("username", user.Username))
+	return issueTokenPair(repository.DB, user, "", client)
 }
 
-func DeleteUser(id uint) error {
-	return repository.DB.Delete(&model.User{}, id).Error
+// DeleteUser 删除数据范围内的用户，用户不在范围内时返回 ErrUserNotFound
+func DeleteUser(scope *DataScope, id uint) error {
+	if _, err := GetUser(scope, id); err != nil {
+		return err
+	}
+	if err := RevokeUserTokens(id); err != nil {
+		return err
+	}
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		// 邮箱有唯一索引，删除后释放邮箱，可以由其他用户使用
+		if err := tx.Model(&model.User{}).Scopes(scope.Users()).Where("id = ?", id).Update("email", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Scopes(scope.Users()).Delete(&model.User{}, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Table("user_roles").Where("user_id = ?", id).Delete(map[string]interface{}{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("subject = ?", middleware.UserSubject(id)).Delete(&model.RoleSuspendedGrouping{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return removeUserRoles(id)
+}
+
+// tenantScope 将查询限定在指定租户内
+func tenantScope(tenantID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("tenant_id = ?", tenantID)
+	}
+}
+
+// GetUser 查询数据范围内的用户，用户不在范围内时返回 ErrUserNotFound
+func GetUser(scope *DataScope, id uint) (*model.User, error) {
+	var user model.User
+	err := repository.DB.Scopes(scope.Users()).Preload("Roles").First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return &user, err
 }
 
-func GetUser(id uint) (*model.User, error) {
+// getUser 按 ID 查询用户，不限定租户，只用于用户本人的操作
+func getUser(id uint) (*model.User, error) {
 	var user model.User
 	err := repository.DB.First(&user, id).Error
 	return &user, err
 }
 
-func ListUsers(page, pageSize int) ([]model.User, int64, error) {
+// ListUsers 分页查询数据范围内的用户
+func ListUsers(scope *DataScope, page, pageSize int) ([]model.User, int64, error) {
 	var users []model.User
 	var total int64
 
 	offset := (page - 1) * pageSize
 
-	err := repository.DB.Model(&model.User{}).Count(&total).Error
+	err := repository.DB.Model(&model.User{}).Scopes(scope.Users()).Count(&total).Error
 	if err != nil {
 		return nil, 0, err
 	}
 
-	err = repository.DB.Offset(offset).Limit(pageSize).Find(&users).Error
+	err = repository.DB.Scopes(scope.Users()).Preload("Roles").Offset(offset).Limit(pageSize).Find(&users).Error
 	return users, total, err
 }
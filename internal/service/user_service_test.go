@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"fastgin/config"
+	"fastgin/internal/model"
+	"fastgin/internal/repository"
+	"fastgin/internal/utils"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestDummyUserUsesCurrentHasher(t *testing.T) {
+	setupTestDB(t)
+	confs := map[string]config.PasswordConfig{
+		"bcrypt":   {Algorithm: "bcrypt", BcryptCost: 4},
+		"argon2id": {Argon2Memory: 2048, Argon2Iterations: 2, Argon2Parallelism: 1},
+	}
+	for name, conf := range confs {
+		InitPasswordHasher(conf)
+		// 用户不存在时校验的哈希与真实用户的哈希使用相同的算法和参数，耗时一致
+		if hashed := dummyUser().Password; utils.PasswordNeedsRehash(hashed) {
+			t.Errorf("%s: dummy hash %q does not match the configured hasher", name, hashed)
+		}
+	}
+}
+
+// adminScope 默认租户管理员的数据范围
+func adminScope(t *testing.T) *DataScope {
+	t.Helper()
+	admin := createTestUser(t, "root", "Secret#123", "admin")
+	scope, err := ResolveDataScope(admin.TenantID, admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scope
+}
+
+func TestCreateUserEmailUnique(t *testing.T) {
+	setupTestDB(t)
+	scope := adminScope(t)
+
+	// 没有邮箱的用户保存为 NULL，不受唯一索引限制
+	for _, username := range []string{"alice", "bob"} {
+		if err := CreateUser(scope, &CreateUserRequest{Username: username, Password: "Secret#123", Role: "user"}); err != nil {
+			t.Fatalf("create %s without email: %v", username, err)
+		}
+	}
+	var noEmail int64
+	repository.DB.Model(&model.User{}).Where("email IS NULL").Count(&noEmail)
+	if noEmail != 3 {
+		t.Errorf("%d users without email, want 3", noEmail)
+	}
+
+	req := &CreateUserRequest{Username: "carol", Password: "Secret#123", Role: "user", Email: "Carol@Example.com"}
+	if err := CreateUser(scope, req); err != nil {
+		t.Fatal(err)
+	}
+	req = &CreateUserRequest{Username: "dave", Password: "Secret#123", Role: "user", Email: "carol@example.com"}
+	if err := CreateUser(scope, req); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("duplicate email: err = %v, want ErrEmailTaken", err)
+	}
+	// 绕过检查直接写入时由唯一索引拒绝
+	duplicate := "carol@example.com"
+	if err := repository.DB.Create(&model.User{Username: "eve", Password: "x", Email: &duplicate}).Error; err == nil {
+		t.Error("duplicate email accepted by the database")
+	}
+
+	// 删除用户后邮箱可以再次使用
+	var carol model.User
+	if err := repository.DB.Where("username = ?", "carol").First(&carol).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteUser(scope, carol.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateUser(scope, req); err != nil {
+		t.Errorf("email of a deleted user: %v", err)
+	}
+}
+
+func TestCreateUserEmailRace(t *testing.T) {
+	db := setupTestDB(t)
+	scope := adminScope(t)
+	// WAL 模式下事务读取邮箱后，其他连接仍然可以提交，模拟并发创建
+	if err := db.Exec("PRAGMA journal_mode=WAL").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 检查邮箱之后、写入之前，另一个请求使用相同的邮箱创建了用户
+	email := "alice@example.com"
+	raced := false
+	err := db.Callback().Create().Before("gorm:create").Register("test:email_race", func(tx *gorm.DB) {
+		user, ok := tx.Statement.Dest.(*model.User)
+		if !ok || raced || user.Username != "alice" {
+			return
+		}
+		raced = true
+		other := &model.User{Username: "bob", Password: "x", Email: &email}
+		if err := db.Session(&gorm.Session{NewDB: true}).Create(other).Error; err != nil {
+			t.Errorf("concurrent create: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CreateUser(scope, &CreateUserRequest{Username: "alice", Password: "Secret#123", Role: "user", Email: email})
+	if !raced {
+		t.Fatal("concurrent create not triggered")
+	}
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("err = %v, want ErrEmailTaken", err)
+	}
+	var count int64
+	db.Model(&model.User{}).Where("email = ?", email).Count(&count)
+	if count != 1 {
+		t.Errorf("%d users with the same email, want 1", count)
+	}
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownPasswordHash 无法识别密码哈希的算法
+var ErrUnknownPasswordHash = errors.New("无法识别的密码哈希格式")
+
+// PasswordHasher 密码哈希算法，哈希结果为自描述格式，包含算法标识和参数
+type PasswordHasher interface {
+	// Hash 生成密码哈希
+	Hash(password string) (string, error)
+	// Verify 校验密码是否与哈希匹配
+	Verify(encoded, password string) (bool, error)
+	// Identify 判断哈希是否由该算法生成
+	Identify(encoded string) bool
+	// NeedsRehash 哈希参数与当前配置不一致时返回 true
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	hasherMu      sync.RWMutex
+	currentHasher PasswordHasher = NewArgon2idHasher(DefaultArgon2Params)
+	// verifyHashers 校验时可识别的算法，校验参数均从哈希本身解析，与配置无关
+	verifyHashers = []PasswordHasher{
+		NewArgon2idHasher(DefaultArgon2Params),
+		NewBcryptHasher(bcrypt.DefaultCost),
+	}
+)
+
+// SetPasswordHasher 设置生成新密码哈希使用的算法，已有的哈希仍可按各自的算法校验
+func SetPasswordHasher(h PasswordHasher) {
+	hasherMu.Lock()
+	defer hasherMu.Unlock()
+	currentHasher = h
+}
+
+// RegisterPasswordHasher 注册额外的可校验算法，用于迁移其他系统导入的密码哈希
+func RegisterPasswordHasher(h PasswordHasher) {
+	hasherMu.Lock()
+	defer hasherMu.Unlock()
+	verifyHashers = append(verifyHashers, h)
+}
+
+// findHasher 根据哈希格式找到对应的算法，优先使用当前算法
+func findHasher(encoded string) PasswordHasher {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	if currentHasher.Identify(encoded) {
+		return currentHasher
+	}
+	for _, h := range verifyHashers {
+		if h.Identify(encoded) {
+			return h
+		}
+	}
+	return nil
+}
+
+func getPasswordHasher() PasswordHasher {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	return currentHasher
+}
+
+// HashPassword 使用当前算法生成密码哈希
+func HashPassword(password string) (string, error) {
+	return getPasswordHasher().Hash(password)
+}
+
+// VerifyPassword 校验密码，支持当前算法和历史算法生成的哈希
+func VerifyPassword(encoded, password string) bool {
+	h := findHasher(encoded)
+	if h == nil {
+		return false
+	}
+	ok, err := h.Verify(encoded, password)
+	return err == nil && ok
+}
+
+// PasswordNeedsRehash 哈希不是由当前算法和参数生成时返回 true，调用方应在密码校验通过后重新哈希
+func PasswordNeedsRehash(encoded string) bool {
+	current := getPasswordHasher()
+	if !current.Identify(encoded) {
+		return true
+	}
+	return current.NeedsRehash(encoded)
+}
+
+// BcryptHasher bcrypt 算法，哈希格式为 $2a$<cost>$...
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{Cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *BcryptHasher) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2Params argon2id 参数，Memory 单位为 KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params RFC 9106 推荐的第二组参数
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher argon2id 算法，哈希格式为 $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+func NewArgon2idHasher(params Argon2Params) *Argon2idHasher {
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2Params.Memory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = DefaultArgon2Params.Iterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = DefaultArgon2Params.Parallelism
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = DefaultArgon2Params.SaltLength
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = DefaultArgon2Params.KeyLength
+	}
+	return &Argon2idHasher{Params: params}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.Params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	actual := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func (h *Argon2idHasher) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, salt, _, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.Memory != h.Params.Memory ||
+		p.Iterations != h.Params.Iterations ||
+		p.Parallelism != h.Params.Parallelism ||
+		p.KeyLength != h.Params.KeyLength ||
+		uint32(len(salt)) != h.Params.SaltLength
+}
+
+// decodeArgon2id 解析 argon2id 哈希中的参数、盐和密钥
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("不支持的 argon2 版本: %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(salt) == 0 || len(key) == 0 {
+		return p, nil, nil, ErrUnknownPasswordHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
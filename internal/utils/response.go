@@ -42,6 +42,15 @@ func Error(c *gin.Context, code int, message string) {
 	})
 }
 
+// ErrorWithData 返回错误并附带详细信息，例如参数校验失败的字段列表
+func ErrorWithData(c *gin.Context, code int, message string, data interface{}) {
+	c.JSON(code, Response{
+		Code:    code,
+		Message: message,
+		Data:    data,
+	})
+}
+
 func SuccessWithPage(c *gin.Context, list interface{}, total int64, page, pageSize int) {
 	c.JSON(200, Response{
 		Code:    200,